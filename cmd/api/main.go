@@ -2,20 +2,53 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/alexdunne/gs-onboarding/internal/api"
+	"github.com/alexdunne/gs-onboarding/internal/auth"
 	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/tlsconfig"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
 )
 
 type Config struct {
 	Port        int
 	DatabaseDSN string
 	RedisURL    string
+	// CacheNamespace is bumped on deploys that change what is cached to invalidate everything at once
+	CacheNamespace string
+	// CacheMaxStale is how long expired values may be served while they are refreshed
+	CacheMaxStale time.Duration
+	// MetricsPort serves expvar counters on /debug/vars when set
+	MetricsPort     int
+	Reflection      bool
+	ShutdownTimeout time.Duration
+	// RequestTimeout is the deadline applied to calls that arrive without one
+	RequestTimeout time.Duration
+	// TLSCertFile and TLSKeyFile serve the API over TLS when set
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile verifies client certificates for mTLS authentication when set
+	TLSClientCAFile string
+	// TLSRequireClientCert rejects connections without a client certificate, otherwise they are optional
+	// so callers can authenticate with a bearer token instead
+	TLSRequireClientCert bool
+	// AuthPolicyFile enables authentication and lists the scopes each method requires
+	AuthPolicyFile string
+	// AuthJWKSFile enables bearer token authentication with the keys it contains
+	AuthJWKSFile    string
+	AuthJWTIssuer   string
+	AuthJWTAudience string
 }
 
 func loadConfig() (*Config, error) {
@@ -24,7 +57,7 @@ func loadConfig() (*Config, error) {
 		return nil, errors.Wrap(err, "failed to read env file")
 	}
 
-	return &Config{
+	c := &Config{
 		Port: viper.GetInt("API_PORT"),
 		DatabaseDSN: fmt.Sprintf(
 			"postgres://%s:%s@%s:%s/%s",
@@ -34,8 +67,37 @@ func loadConfig() (*Config, error) {
 			viper.GetString("DATABASE_PORT"),
 			viper.GetString("DATABASE_DB"),
 		),
-		RedisURL: viper.GetString("REDIS_URL"),
-	}, nil
+		RedisURL:             viper.GetString("REDIS_URL"),
+		CacheNamespace:       viper.GetString("CACHE_NAMESPACE"),
+		MetricsPort:          viper.GetInt("METRICS_PORT"),
+		Reflection:           viper.GetBool("GRPC_REFLECTION"),
+		TLSCertFile:          viper.GetString("TLS_CERT_FILE"),
+		TLSKeyFile:           viper.GetString("TLS_KEY_FILE"),
+		TLSClientCAFile:      viper.GetString("TLS_CLIENT_CA_FILE"),
+		TLSRequireClientCert: viper.GetBool("TLS_REQUIRE_CLIENT_CERT"),
+		AuthPolicyFile:       viper.GetString("AUTH_POLICY_FILE"),
+		AuthJWKSFile:         viper.GetString("AUTH_JWKS_FILE"),
+		AuthJWTIssuer:        viper.GetString("AUTH_JWT_ISSUER"),
+		AuthJWTAudience:      viper.GetString("AUTH_JWT_AUDIENCE"),
+	}
+
+	maxStaleSeconds := viper.GetInt("CACHE_MAX_STALE_SECONDS")
+	if maxStaleSeconds != 0 {
+		c.CacheMaxStale = time.Duration(maxStaleSeconds) * time.Second
+	}
+
+	c.RequestTimeout = 30 * time.Second
+	requestSeconds := viper.GetInt("REQUEST_TIMEOUT_SECONDS")
+	if requestSeconds != 0 {
+		c.RequestTimeout = time.Duration(requestSeconds) * time.Second
+	}
+
+	shutdownSeconds := viper.GetInt("SHUTDOWN_TIMEOUT_SECONDS")
+	if shutdownSeconds != 0 {
+		c.ShutdownTimeout = time.Duration(shutdownSeconds) * time.Second
+	}
+
+	return c, nil
 }
 
 func main() {
@@ -50,7 +112,14 @@ func main() {
 	}
 	defer logger.Sync()
 
-	ctx := context.Background()
+	// client certificates are only presented over TLS, without it mTLS would silently authenticate nobody
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		logger.Fatal("TLS_CLIENT_CA_FILE is set without TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+
+	// ctx is cancelled on SIGINT or SIGTERM and gracefully stops the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	db, err := database.New(ctx, cfg.DatabaseDSN)
 	if err != nil {
@@ -58,18 +127,133 @@ func main() {
 	}
 	defer db.Close()
 
-	cache, err := api.NewCache(ctx, cfg.RedisURL, db, logger)
+	var cacheOpts []api.CacheOption
+	if cfg.CacheNamespace != "" {
+		cacheOpts = append(cacheOpts, api.WithNamespace(cfg.CacheNamespace))
+	}
+	if cfg.CacheMaxStale != 0 {
+		cacheOpts = append(cacheOpts, api.WithMaxStale(cfg.CacheMaxStale))
+	}
+
+	cache, err := api.NewCache(ctx, cfg.RedisURL, db, logger, cacheOpts...)
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "opening cache connection"))
 	}
 	defer cache.Close()
 
+	go cache.WatchInvalidations(ctx)
+
+	expvar.Publish("item_cache", expvar.Func(func() interface{} {
+		return cache.Stats()
+	}))
+
+	if cfg.MetricsPort != 0 {
+		go func() {
+			// expvar registers /debug/vars on the default mux
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.MetricsPort), nil); err != nil {
+				logger.Error("serving metrics", zap.Error(err))
+			}
+		}()
+	}
+
+	events := api.NewEventHub(db, logger)
+	go events.Run(ctx)
+
 	h := api.Handler{
-		Cache: cache,
+		Cache:  cache,
+		DB:     db,
+		Events: events,
+	}
+
+	interceptors := []api.Interceptor{
+		api.Recovery(logger),
+		api.RequestID(),
+		api.Logging(logger),
+		api.Metrics(expvar.NewMap("rpc")),
+	}
+
+	guard, err := newGuard(cfg, logger)
+	if err != nil {
+		logger.Fatal("configuring authentication", zap.Error(err))
+	}
+	if guard != nil {
+		interceptors = append(interceptors, api.Interceptor{Unary: guard.Unary(), Stream: guard.Stream()})
+	} else {
+		logger.Warn("authentication is disabled, set AUTH_POLICY_FILE to enable it")
 	}
 
-	s := api.NewServer(cfg.Port, logger, h)
-	if err := s.Start(); err != nil {
+	// watches stay open for as long as the client wants updates
+	interceptors = append(interceptors, api.Deadline(cfg.RequestTimeout, "/api.API/WatchItems"))
+
+	serverOpts := []api.ServerOption{
+		api.WithInterceptors(interceptors...),
+		api.WithHealthChecks(
+			api.HealthCheck{Name: "database", Check: db.Ping},
+			// the cache degrades to the local cache and database so redis is not required to serve
+			api.HealthCheck{Name: "redis", Check: cache.Ping, Optional: true},
+		),
+	}
+	if cfg.Reflection {
+		serverOpts = append(serverOpts, api.WithReflection())
+	}
+	if cfg.ShutdownTimeout != 0 {
+		serverOpts = append(serverOpts, api.WithShutdownTimeout(cfg.ShutdownTimeout))
+	}
+	if cfg.TLSCertFile != "" {
+		certs, err := tlsconfig.NewReloader(tlsconfig.Files{
+			CertFile: cfg.TLSCertFile,
+			KeyFile:  cfg.TLSKeyFile,
+			CAFile:   cfg.TLSClientCAFile,
+		}, logger)
+		if err != nil {
+			logger.Fatal("loading certificates", zap.Error(err))
+		}
+
+		go func() {
+			if err := certs.Watch(ctx); err != nil {
+				logger.Error("watching certificates", zap.Error(err))
+			}
+		}()
+
+		serverOpts = append(serverOpts, api.WithCredentials(credentials.NewTLS(certs.ServerConfig(cfg.TLSRequireClientCert))))
+	}
+
+	s := api.NewServer(cfg.Port, logger, h, serverOpts...)
+	if err := s.Start(ctx); err != nil {
 		logger.Fatal("running server", zap.Error(err))
 	}
+
+	logger.Info("server stopped")
+}
+
+// newGuard builds the authentication guard from config. It returns nil when authentication is disabled
+func newGuard(cfg *Config, logger *zap.Logger) (*auth.Guard, error) {
+	if cfg.AuthPolicyFile == "" {
+		return nil, nil
+	}
+
+	policy, err := auth.LoadPolicy(cfg.AuthPolicyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var authenticators []auth.Authenticator
+	if cfg.TLSClientCAFile != "" {
+		authenticators = append(authenticators, auth.NewMTLSAuthenticator(policy.Clients))
+	}
+
+	if cfg.AuthJWKSFile != "" {
+		keys, err := auth.LoadJWKS(cfg.AuthJWKSFile)
+		if err != nil {
+			return nil, err
+		}
+
+		authenticators = append(authenticators, auth.NewJWTAuthenticator(keys, cfg.AuthJWTIssuer, cfg.AuthJWTAudience))
+	}
+
+	if len(authenticators) == 0 {
+		return nil, errors.New("a policy is set but neither TLS_CLIENT_CA_FILE nor AUTH_JWKS_FILE is configured")
+	}
+
+	return auth.NewGuard(policy, logger, authenticators...), nil
 }
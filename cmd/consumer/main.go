@@ -8,10 +8,13 @@ import (
 	"os/signal"
 	"runtime"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alexdunne/gs-onboarding/internal/consumer"
 	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/invalidation"
+	"github.com/alexdunne/gs-onboarding/internal/leader"
 	"github.com/alexdunne/gs-onboarding/internal/queue"
 	"github.com/alexdunne/gs-onboarding/pkg/hn"
 	"github.com/pkg/errors"
@@ -21,13 +24,27 @@ import (
 
 const (
 	queueName = "items"
+	leaseName = "seeder"
+
+	// eventRetention is how long item events are kept for watchers to resume from
+	eventRetention = 24 * time.Hour
+	// scoreRetention is how long every recorded score is kept, older scores are pruned except the last
+	// of each item
+	scoreRetention = 30 * 24 * time.Hour
 )
 
 type Config struct {
 	WorkerCount            int
 	WorkerIntervalDuration time.Duration
+	BatchSize              int
+	BatchFlushInterval     time.Duration
+	ShutdownTimeout        time.Duration
+	LeaderLeaseTTL         time.Duration
 	DatabaseDSN            string
 	RabbitMQURL            string
+	RedisURL               string
+	// FetchComments queues the new comments and poll options of every stored item
+	FetchComments bool
 }
 
 func loadConfig() (*Config, error) {
@@ -39,6 +56,10 @@ func loadConfig() (*Config, error) {
 	c := &Config{
 		WorkerCount:            runtime.NumCPU(),
 		WorkerIntervalDuration: 300 * time.Second,
+		BatchSize:              100,
+		BatchFlushInterval:     time.Second,
+		ShutdownTimeout:        30 * time.Second,
+		LeaderLeaseTTL:         15 * time.Second,
 		DatabaseDSN: fmt.Sprintf(
 			"postgres://%s:%s@%s:%s/%s",
 			viper.GetString("DATABASE_USER"),
@@ -54,6 +75,7 @@ func loadConfig() (*Config, error) {
 			viper.GetString("RABBITMQ_HOST"),
 			viper.GetString("RABBITMQ_PORT"),
 		),
+		RedisURL: viper.GetString("REDIS_URL"),
 	}
 
 	intervalSeconds := viper.GetInt("WORKER_INTERVAL_SECONDS")
@@ -61,20 +83,39 @@ func loadConfig() (*Config, error) {
 		c.WorkerIntervalDuration = time.Duration(intervalSeconds) * time.Second
 	}
 
+	batchSize := viper.GetInt("BATCH_SIZE")
+	if batchSize != 0 {
+		c.BatchSize = batchSize
+	}
+
+	flushMilliseconds := viper.GetInt("BATCH_FLUSH_INTERVAL_MS")
+	if flushMilliseconds != 0 {
+		c.BatchFlushInterval = time.Duration(flushMilliseconds) * time.Millisecond
+	}
+
+	shutdownSeconds := viper.GetInt("SHUTDOWN_TIMEOUT_SECONDS")
+	if shutdownSeconds != 0 {
+		c.ShutdownTimeout = time.Duration(shutdownSeconds) * time.Second
+	}
+
+	leaseSeconds := viper.GetInt("LEADER_LEASE_SECONDS")
+	if leaseSeconds != 0 {
+		c.LeaderLeaseTTL = time.Duration(leaseSeconds) * time.Second
+	}
+
+	c.FetchComments = viper.GetBool("FETCH_COMMENTS")
+
 	return c, nil
 }
 
 func main() {
-	ctx, cancelFn := context.WithCancel(context.Background())
-	defer cancelFn()
+	// ctx is cancelled on SIGINT or SIGTERM and stops seeding and consuming new messages
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	go func() {
-		// handle interrupts and propagate the changes across the consumer pipeline
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		<-c
-		cancelFn()
-	}()
+	// workCtx is only cancelled once the shutdown deadline has passed and aborts any in-flight items
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
 
 	cfg, err := loadConfig()
 	if err != nil {
@@ -96,7 +137,7 @@ func main() {
 	logger.Info("creating HN client")
 	hackerNewsClient := hn.New()
 
-	queueClient, err := queue.New(cfg.RabbitMQURL, queueName, logger)
+	queueClient, err := queue.New(cfg.RabbitMQURL, queueName, logger, queue.WithPrefetch(cfg.WorkerCount*cfg.BatchSize))
 	if err != nil {
 		logger.Fatal("failed to create RabbitMQ connection", zap.Error(err))
 	}
@@ -107,28 +148,93 @@ func main() {
 		logger.Fatal("failed to consumer message from RabbitMQ", zap.Error(err))
 	}
 
-	w := consumer.NewWorker(logger, db, hackerNewsClient)
+	// the api caches are evicted once written items are committed
+	invalidator := invalidation.New(cfg.RedisURL)
+	defer invalidator.Close()
+
+	w := consumer.NewWorker(
+		logger,
+		db,
+		hackerNewsClient,
+		consumer.WithBatchSize(cfg.BatchSize),
+		consumer.WithFlushInterval(cfg.BatchFlushInterval),
+		consumer.WithInvalidator(invalidator),
+	)
+	if cfg.FetchComments {
+		w.AddSink(consumer.EnqueueChildren(queueClient, db))
+	}
 	wg := &sync.WaitGroup{}
 
 	for i := 0; i < cfg.WorkerCount; i++ {
 		wg.Add(1)
-		go w.Run(ctx, messages, wg)
+		go w.Run(workCtx, messages, wg)
 	}
 
-	if err := seed(ctx, hackerNewsClient, queueClient, cfg.WorkerIntervalDuration, logger); err != nil {
-		logger.Error("failed to seed ids", zap.Error(err))
+	// every instance consumes, but only the elected leader seeds the queue
+	elector := leader.NewElector(db, leaseName, instanceID(), logger, leader.WithLeaseTTL(cfg.LeaderLeaseTTL))
+	elector.Run(ctx, func(ctx context.Context) {
+		go prune(ctx, "item events", func(ctx context.Context) (int64, error) {
+			return db.PruneEvents(ctx, eventRetention)
+		}, logger)
+		go prune(ctx, "item scores", func(ctx context.Context) (int64, error) {
+			return db.PruneScores(ctx, scoreRetention)
+		}, logger)
+
+		if err := seed(ctx, hackerNewsClient, queueClient, cfg.WorkerIntervalDuration, logger); err != nil {
+			logger.Error("failed to seed ids", zap.Error(err))
+		}
+	})
+
+	logger.Info("shutting down", zap.Duration("timeout", cfg.ShutdownTimeout))
+
+	if !waitTimeout(wg, cfg.ShutdownTimeout) {
+		logger.Warn("shutdown timeout exceeded, aborting in-flight items")
+		cancelWork()
+		wg.Wait()
 	}
 
-	wg.Wait()
+	logger.Info("workers stopped")
+}
+
+// instanceID identifies this process when campaigning for leadership
+func instanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// waitTimeout waits for the wait group to finish and reports whether it did so before the timeout
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
 }
 
 func seed(ctx context.Context, hackerNewsClient hn.Client, queueClient queue.Queue, interval time.Duration, logger *zap.Logger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-time.Tick(interval):
-			ids, err := hackerNewsClient.FetchTopStories()
+		case <-ticker.C:
+			ids, err := hackerNewsClient.FetchTopStories(ctx)
 			if err != nil {
 				return errors.Wrap(err, "fetching top stores")
 			}
@@ -144,3 +250,24 @@ func seed(ctx context.Context, hackerNewsClient hn.Client, queueClient queue.Que
 		}
 	}
 }
+
+// prune periodically deletes what is older than its retention period with del until ctx is cancelled
+func prune(ctx context.Context, what string, del func(ctx context.Context) (int64, error), logger *zap.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		count, err := del(ctx)
+		if err != nil {
+			logger.Error("failed to prune "+what, zap.Error(err))
+		} else {
+			logger.Info("pruned "+what, zap.Int64("count", count))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
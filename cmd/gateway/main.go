@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"time"
 
+	"github.com/alexdunne/gs-onboarding/internal/auth"
 	"github.com/alexdunne/gs-onboarding/internal/gateway"
 	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/alexdunne/gs-onboarding/internal/tlsconfig"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/pkg/errors"
@@ -16,6 +21,25 @@ import (
 type Config struct {
 	Addr           string
 	GRPCServerAddr string
+	// APICAFile enables TLS to the API, verifying its certificate against this CA
+	APICAFile string
+	// TLSCertFile and TLSKeyFile are the client certificate presented to the API as the gateway's identity
+	TLSCertFile string
+	TLSKeyFile  string
+	// TokenFile holds a bearer token sent to the API as the gateway's identity
+	TokenFile string
+	// DialTimeout bounds how long startup waits for a connection to the API
+	DialTimeout time.Duration
+	// CallTimeout is the deadline of each call to the API
+	CallTimeout time.Duration
+	// BreakerThreshold consecutive failed calls stop calls to the API for BreakerCooldown
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// CacheControl is sent with successful responses
+	CacheControl string
+	// GraphQLMaxDepth and GraphQLMaxComplexity reject GraphQL queries that would be expensive to resolve
+	GraphQLMaxDepth      int
+	GraphQLMaxComplexity int
 }
 
 func loadConfig() (*Config, error) {
@@ -24,10 +48,24 @@ func loadConfig() (*Config, error) {
 		return nil, errors.Wrap(err, "failed to read env file")
 	}
 
-	return &Config{
-		Addr:           viper.GetString("GATEWAY_ADDR"),
-		GRPCServerAddr: viper.GetString("GRPC_SERVER_ADDR"),
-	}, nil
+	c := &Config{
+		Addr:             viper.GetString("GATEWAY_ADDR"),
+		GRPCServerAddr:   viper.GetString("GRPC_SERVER_ADDR"),
+		APICAFile:        viper.GetString("API_CA_FILE"),
+		TLSCertFile:      viper.GetString("GATEWAY_TLS_CERT_FILE"),
+		TLSKeyFile:       viper.GetString("GATEWAY_TLS_KEY_FILE"),
+		TokenFile:        viper.GetString("GATEWAY_TOKEN_FILE"),
+		DialTimeout:      time.Duration(viper.GetInt("API_DIAL_TIMEOUT_SECONDS")) * time.Second,
+		CallTimeout:      time.Duration(viper.GetInt("API_CALL_TIMEOUT_SECONDS")) * time.Second,
+		BreakerThreshold: viper.GetInt("API_BREAKER_THRESHOLD"),
+		BreakerCooldown:  time.Duration(viper.GetInt("API_BREAKER_COOLDOWN_SECONDS")) * time.Second,
+		CacheControl:     viper.GetString("GATEWAY_CACHE_CONTROL"),
+
+		GraphQLMaxDepth:      viper.GetInt("GRAPHQL_MAX_DEPTH"),
+		GraphQLMaxComplexity: viper.GetInt("GRAPHQL_MAX_COMPLEXITY"),
+	}
+
+	return c, nil
 }
 
 func main() {
@@ -42,29 +80,142 @@ func main() {
 	}
 	defer logger.Sync()
 
-	client, err := hackernews.New(cfg.GRPCServerAddr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clientOpts, err := clientOptions(ctx, cfg, logger)
+	if err != nil {
+		logger.Fatal("configuring grpc client", zap.Error(err))
+	}
+
+	client, err := hackernews.New(cfg.GRPCServerAddr, clientOpts...)
 	if err != nil {
 		logger.Fatal("creating grpc client", zap.Error(err))
 	}
 	defer client.Close()
 
+	proxy, err := gateway.NewProxy(ctx, client.APIClient(), logger)
+	if err != nil {
+		logger.Fatal("creating api proxy", zap.Error(err))
+	}
+
+	graphQL, err := gateway.NewGraphQL(client, logger, graphQLOptions(cfg)...)
+	if err != nil {
+		logger.Fatal("creating graphql handler", zap.Error(err))
+	}
+
+	router := newRouter(&gateway.Handler{HNClient: client, CacheControl: cfg.CacheControl}, proxy, graphQL, logger)
+
+	logger.Info(fmt.Sprintf("starting server at %s", cfg.Addr))
+	if err := router.Start(cfg.Addr); err != nil {
+		logger.Fatal("starting server", zap.Error(err))
+	}
+}
+
+// clientOptions configures how the gateway connects and identifies itself to the API. Certificates are
+// reloaded when they change until ctx is cancelled
+func clientOptions(ctx context.Context, cfg *Config, logger *zap.Logger) ([]hackernews.ClientOption, error) {
+	var opts []hackernews.ClientOption
+
+	if cfg.APICAFile != "" {
+		certs, err := tlsconfig.NewReloader(tlsconfig.Files{
+			CertFile: cfg.TLSCertFile,
+			KeyFile:  cfg.TLSKeyFile,
+			CAFile:   cfg.APICAFile,
+		}, logger)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading certificates")
+		}
+
+		go func() {
+			if err := certs.Watch(ctx); err != nil {
+				logger.Error("watching certificates", zap.Error(err))
+			}
+		}()
+
+		opts = append(opts, hackernews.WithTransportCredentials(certs.ClientCredentials()))
+	}
+
+	if cfg.TokenFile != "" {
+		opts = append(opts, hackernews.WithPerRPCCredentials(auth.NewTokenFileCredentials(cfg.TokenFile, cfg.APICAFile != "")))
+	}
+
+	// unset values keep the client's defaults
+	if cfg.DialTimeout != 0 {
+		opts = append(opts, hackernews.WithDialTimeout(cfg.DialTimeout))
+	}
+	if cfg.CallTimeout != 0 {
+		opts = append(opts, hackernews.WithCallTimeout(cfg.CallTimeout))
+	}
+	if cfg.BreakerThreshold != 0 && cfg.BreakerCooldown != 0 {
+		opts = append(opts, hackernews.WithCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown))
+	}
+
+	return opts, nil
+}
+
+// graphQLOptions sets the GraphQL query limits, unset values keep the handler's defaults
+func graphQLOptions(cfg *Config) []gateway.GraphQLOption {
+	var opts []gateway.GraphQLOption
+	if cfg.GraphQLMaxDepth != 0 {
+		opts = append(opts, gateway.WithMaxDepth(cfg.GraphQLMaxDepth))
+	}
+	if cfg.GraphQLMaxComplexity != 0 {
+		opts = append(opts, gateway.WithMaxComplexity(cfg.GraphQLMaxComplexity))
+	}
+
+	return opts
+}
+
+// newRouter registers the gateway routes and middleware. Routes are served under /v1 and, for clients
+// that predate versioning, deprecated at their original unversioned paths. The proxy generated from
+// api.proto serves /v2 and the GraphQL handler /graphql when given
+func newRouter(h *gateway.Handler, proxy, graphQL http.Handler, logger *zap.Logger) *echo.Echo {
 	router := echo.New()
 	router.HideBanner = true
+	router.HTTPErrorHandler = gateway.ErrorHandler(logger)
 	router.Use(
-		middleware.Recover(),
+		gateway.Recover(),
 		middleware.Logger(),
 	)
 
-	h := gateway.Handler{
-		HNClient: client,
+	routes := map[string]echo.HandlerFunc{
+		"/all":       h.GetAllItems,
+		"/stories":   h.GetStories,
+		"/jobs":      h.GetJobs,
+		"/items":     h.GetItems,
+		"/items/:id": h.GetItem,
+		"/search":    h.Search,
 	}
 
-	router.GET("/all", h.GetAllItems)
-	router.GET("/stories", h.GetStories)
-	router.GET("/jobs", h.GetJobs)
+	v1 := router.Group("/v1")
+	for path, handler := range routes {
+		v1.GET(path, handler)
+		router.GET(path, handler, deprecated)
+	}
 
-	logger.Info(fmt.Sprintf("starting server at %s", cfg.Addr))
-	if err := router.Start(cfg.Addr); err != nil {
-		logger.Fatal("starting server", zap.Error(err))
+	v1.GET("/openapi.json", h.GetOpenAPI)
+	v1.GET("/feeds/:feed", h.GetFeed)
+	v1.GET("/export/:list", h.Export)
+
+	if proxy != nil {
+		router.Any("/v2/*", echo.WrapHandler(proxy))
+	}
+
+	if graphQL != nil {
+		router.Match([]string{http.MethodGet, http.MethodPost}, "/graphql", echo.WrapHandler(graphQL))
+	}
+
+	return router
+}
+
+// deprecated marks responses as deprecated and links to the /v1 route replacing them
+func deprecated(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Response().Header()
+		header.Set("Deprecation", "true")
+		header.Add("Link", fmt.Sprintf("</v1%s>; rel=\"successor-version\"", c.Request().URL.Path))
+
+		return next(c)
 	}
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -9,151 +8,87 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alexdunne/gs-onboarding/internal/gateway"
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
 	"github.com/alexdunne/gs-onboarding/internal/models"
-	"github.com/alexdunne/gs-onboarding/pkg/hn"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-type StubItemStore struct {
-	items            map[int]models.Item
-	getAllCalled     int
-	getStoriesCalled int
-	getJobsCalled    int
+var storedItems = []models.Item{
+	{
+		ID:        1,
+		Type:      "story",
+		Content:   "Hello, world!",
+		URL:       "gymshark.com",
+		Score:     128,
+		Title:     "Intro",
+		CreatedAt: time.Now(),
+		CreatedBy: "Some rando",
+	},
+	{
+		ID:        3,
+		Type:      "job",
+		Content:   "Software Engineer role",
+		URL:       "gymshark.com/careers",
+		Score:     512,
+		Title:     "Software Engineer",
+		CreatedAt: time.Now(),
+		CreatedBy: "Shark Boi",
+	},
 }
 
-func (s *StubItemStore) GetAll(ctx context.Context) ([]models.Item, error) {
-	s.getAllCalled++
-
-	items := []models.Item{}
-	for _, v := range s.items {
-		items = append(items, v)
-	}
-
-	return items, nil
-}
-
-func (s *StubItemStore) GetStories(ctx context.Context) ([]models.Item, error) {
-	s.getStoriesCalled++
-
-	items := []models.Item{}
-	for _, v := range s.items {
-		if v.Type == "story" {
+func itemsOfType(itemType string) []models.Item {
+	var items []models.Item
+	for _, v := range storedItems {
+		if v.Type == itemType {
 			items = append(items, v)
 		}
 	}
 
-	return items, nil
+	return items
 }
 
-func (s *StubItemStore) GetJobs(ctx context.Context) ([]models.Item, error) {
-	s.getJobsCalled++
+func serve(hn hackernews.Client, target string) *httptest.ResponseRecorder {
+	router := newRouter(&gateway.Handler{HNClient: hn}, nil, nil, zap.NewNop())
 
-	items := []models.Item{}
-	for _, v := range s.items {
-		if v.Type == "job" {
-			items = append(items, v)
-		}
-	}
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
 
-	return items, nil
+	return rec
 }
 
 func TestGetAllItems(t *testing.T) {
-	store := &StubItemStore{
-		items: map[int]models.Item{
-			1: {
-				ID:        1,
-				Type:      "story",
-				Content:   "Hello, world!",
-				URL:       "gymshark.com",
-				Score:     128,
-				Title:     "Intro",
-				CreatedAt: time.Now(),
-				CreatedBy: "Some rando",
-			},
-			2: {
-				ID:        2,
-				Type:      "story",
-				Content:   "Hello Reloaded",
-				URL:       "gymshark.com",
-				Score:     256,
-				Title:     "I'll be back",
-				CreatedAt: time.Now(),
-				CreatedBy: "Some rando",
-			},
-			3: {
-				ID:        3,
-				Type:      "job",
-				Content:   "Software Engineer role",
-				URL:       "gymshark.com/careers",
-				Score:     512,
-				Title:     "Software Engineer",
-				CreatedAt: time.Now(),
-				CreatedBy: "Shark Boi",
-			},
-		},
-	}
-	server := NewServer(store)
+	hn := &hackernews.Mock{}
+	hn.On("FetchAll", mock.Anything, hackernews.ListOptions{}).Return(storedItems, "", nil)
 
-	req := httptest.NewRequest(http.MethodGet, "/all", nil)
-	rec := httptest.NewRecorder()
-	c := server.router.NewContext(req, rec)
-
-	server.handleGetAllItems(c)
-
-	if store.getAllCalled != 1 {
-		t.Errorf("expected GetAll to be called once, got %v", store.getAllCalled)
-	}
+	rec := serve(hn, "/v1/all")
 
+	hn.AssertNumberOfCalls(t, "FetchAll", 1)
 	assertStatusCode(t, rec.Code, http.StatusOK)
 
 	res := decodeResponse(t, rec.Body)
-	if len(res.Items) != 3 {
-		t.Errorf("received the wrong number of items. got %v, want %v", len(res.Items), 3)
+	if len(res.Items) != 2 {
+		t.Errorf("received the wrong number of items. got %v, want %v", len(res.Items), 2)
 	}
 }
 
 func TestGetStories(t *testing.T) {
-	store := &StubItemStore{
-		items: map[int]models.Item{
-			1: {
-				ID:        1,
-				Type:      "story",
-				Content:   "Hello, world!",
-				URL:       "gymshark.com",
-				Score:     128,
-				Title:     "Intro",
-				CreatedAt: time.Now(),
-				CreatedBy: "Some rando",
-			},
-			3: {
-				ID:        3,
-				Type:      "job",
-				Content:   "Software Engineer role",
-				URL:       "gymshark.com/careers",
-				Score:     512,
-				Title:     "Software Engineer",
-				CreatedAt: time.Now(),
-				CreatedBy: "Shark Boi",
-			},
-		},
-	}
-	server := NewServer(store)
-
-	req := httptest.NewRequest(http.MethodGet, "/stories", nil)
-	rec := httptest.NewRecorder()
-	c := server.router.NewContext(req, rec)
+	hn := &hackernews.Mock{}
+	hn.On("FetchStories", mock.Anything, hackernews.ListOptions{}).Return(itemsOfType("story"), "", nil)
 
-	server.handleGetStories(c)
-
-	if store.getStoriesCalled != 1 {
-		t.Errorf("expected GetStories to be called once, got %v", store.getStoriesCalled)
-	}
+	rec := serve(hn, "/v1/stories")
 
+	hn.AssertNumberOfCalls(t, "FetchStories", 1)
 	assertStatusCode(t, rec.Code, http.StatusOK)
 
 	res := decodeResponse(t, rec.Body)
 	if len(res.Items) != 1 {
-		t.Errorf("received the wrong number of items. got %v, want %v", len(res.Items), 1)
+		t.Fatalf("received the wrong number of items. got %v, want %v", len(res.Items), 1)
 	}
 
 	if res.Items[0].ID != 1 {
@@ -162,51 +97,89 @@ func TestGetStories(t *testing.T) {
 }
 
 func TestGetJobs(t *testing.T) {
-	store := &StubItemStore{
-		items: map[int]models.Item{
-			1: {
-				ID:        1,
-				Type:      "story",
-				Content:   "Hello, world!",
-				URL:       "gymshark.com",
-				Score:     128,
-				Title:     "Intro",
-				CreatedAt: time.Now(),
-				CreatedBy: "Some rando",
+	hn := &hackernews.Mock{}
+	hn.On("FetchJobs", mock.Anything, hackernews.ListOptions{}).Return(itemsOfType("job"), "", nil)
+
+	rec := serve(hn, "/v1/jobs")
+
+	hn.AssertNumberOfCalls(t, "FetchJobs", 1)
+	assertStatusCode(t, rec.Code, http.StatusOK)
+
+	res := decodeResponse(t, rec.Body)
+	if len(res.Items) != 1 {
+		t.Fatalf("received the wrong number of items. got %v, want %v", len(res.Items), 1)
+	}
+
+	if res.Items[0].ID != 3 {
+		t.Errorf("expected first returned job to have id %v, got: %v", 3, res.Items[0].ID)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	type testcase struct {
+		name               string
+		target             string
+		expectMocks        func(hn *hackernews.Mock)
+		expectedStatusCode int
+	}
+
+	tests := []testcase{
+		{
+			name:               "bad request from the gateway",
+			target:             "/v1/items/abc",
+			expectMocks:        func(hn *hackernews.Mock) {},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "unavailable api",
+			target: "/v1/all",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("FetchAll", mock.Anything, hackernews.ListOptions{}).Return(nil, "", errors.Wrap(status.Error(codes.Unavailable, "connection refused"), "streaming all items"))
 			},
-			3: {
-				ID:        3,
-				Type:      "job",
-				Content:   "Software Engineer role",
-				URL:       "gymshark.com/careers",
-				Score:     512,
-				Title:     "Software Engineer",
-				CreatedAt: time.Now(),
-				CreatedBy: "Shark Boi",
+			expectedStatusCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:   "unexpected error",
+			target: "/v1/jobs",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("FetchJobs", mock.Anything, hackernews.ListOptions{}).Return(nil, "", errors.New("boom"))
 			},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:               "unknown route",
+			target:             "/nope",
+			expectMocks:        func(hn *hackernews.Mock) {},
+			expectedStatusCode: http.StatusNotFound,
 		},
 	}
-	server := NewServer(store)
 
-	req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
-	rec := httptest.NewRecorder()
-	c := server.router.NewContext(req, rec)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hn := &hackernews.Mock{}
+			tc.expectMocks(hn)
 
-	server.handleGetJobs(c)
+			rec := serve(hn, tc.target)
 
-	if store.getJobsCalled != 1 {
-		t.Errorf("expected GetJobs to be called once, got %v", store.getJobsCalled)
-	}
+			assertStatusCode(t, rec.Code, tc.expectedStatusCode)
 
-	assertStatusCode(t, rec.Code, http.StatusOK)
+			if ct := rec.Header().Get("Content-Type"); ct != gateway.MIMEApplicationProblemJSON {
+				t.Errorf("received the wrong content type. got %v, want %v", ct, gateway.MIMEApplicationProblemJSON)
+			}
 
-	res := decodeResponse(t, rec.Body)
-	if len(res.Items) != 1 {
-		t.Errorf("received the wrong number of items. got %v, want %v", len(res.Items), 1)
-	}
+			var p gateway.Problem
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("unable to decode problem body: %v", err)
+			}
 
-	if res.Items[0].ID != 3 {
-		t.Errorf("expected first returned story to have id %v, got: %v", 3, res.Items[0].ID)
+			if p.Status != tc.expectedStatusCode {
+				t.Errorf("received the wrong problem status. got %v, want %v", p.Status, tc.expectedStatusCode)
+			}
+
+			if p.Instance != tc.target {
+				t.Errorf("received the wrong problem instance. got %v, want %v", p.Instance, tc.target)
+			}
+		})
 	}
 }
 
@@ -219,7 +192,7 @@ func assertStatusCode(t testing.TB, got, want int) {
 }
 
 type successResponse struct {
-	Items []hn.Item `json:"items"`
+	Items []models.Item `json:"items"`
 }
 
 func decodeResponse(t testing.TB, r io.Reader) successResponse {
@@ -233,3 +206,69 @@ func decodeResponse(t testing.TB, r io.Reader) successResponse {
 
 	return res
 }
+
+func TestUnversionedRoutes(t *testing.T) {
+	hn := &hackernews.Mock{}
+	hn.On("FetchStories", mock.Anything, hackernews.ListOptions{}).Return(itemsOfType("story"), "", nil)
+
+	rec := serve(hn, "/stories")
+
+	assertStatusCode(t, rec.Code, http.StatusOK)
+
+	if got := rec.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("received the wrong deprecation header. got %v, want %v", got, "true")
+	}
+
+	want := `</v1/stories>; rel="successor-version"`
+	if got := rec.Header().Get("Link"); got != want {
+		t.Errorf("received the wrong link header. got %v, want %v", got, want)
+	}
+}
+
+func TestProxyRoutes(t *testing.T) {
+	var paths []string
+	proxy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	router := newRouter(&gateway.Handler{}, proxy, nil, zap.NewNop())
+
+	targets := []string{"/v2/items/1", "/v2/items:search?query=go", "/v2/stories"}
+	for _, target := range targets {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		assertStatusCode(t, rec.Code, http.StatusNoContent)
+	}
+
+	want := []string{"/v2/items/1", "/v2/items:search", "/v2/stories"}
+	if len(paths) != len(want) {
+		t.Fatalf("proxied the wrong paths. got %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("proxied the wrong path. got %v, want %v", paths[i], want[i])
+		}
+	}
+}
+
+func TestGraphQLRoute(t *testing.T) {
+	graphQL := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	router := newRouter(&gateway.Handler{}, nil, graphQL, zap.NewNop())
+
+	methods := map[string]int{
+		http.MethodGet:    http.StatusNoContent,
+		http.MethodPost:   http.StatusNoContent,
+		http.MethodDelete: http.StatusMethodNotAllowed,
+	}
+	for method, code := range methods {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, "/graphql", nil))
+
+		assertStatusCode(t, rec.Code, code)
+	}
+}
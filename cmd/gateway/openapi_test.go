@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway"
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pathParam matches echo path parameters
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	spec, err := openapi3.NewLoader().LoadFromData(gateway.OpenAPISpec)
+	require.NoError(t, err)
+	require.NoError(t, spec.Validate(context.Background()))
+
+	return spec
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	spec := loadSpec(t)
+
+	var documented []string
+	for path := range spec.Paths {
+		documented = append(documented, path)
+	}
+
+	var registered []string
+	for _, r := range newRouter(&gateway.Handler{}, nil, nil, zap.NewNop()).Routes() {
+		if r.Method != http.MethodGet || !strings.HasPrefix(r.Path, "/v1/") {
+			continue
+		}
+
+		// echo's :param is {param} in OpenAPI
+		path := strings.TrimPrefix(r.Path, "/v1")
+		path = pathParam.ReplaceAllString(path, "{$1}")
+		registered = append(registered, path)
+	}
+
+	sort.Strings(documented)
+	sort.Strings(registered)
+	assert.Equal(t, documented, registered, "every /v1 route must be documented in openapi.json")
+}
+
+func TestOpenAPIConformance(t *testing.T) {
+	spec := loadSpec(t)
+
+	// the router matches against the spec's servers, which are relative
+	spec.Servers = openapi3.Servers{{URL: "http://example.com/v1"}}
+	specRouter, err := gorillamux.NewRouter(spec)
+	require.NoError(t, err)
+
+	// feeds are checked as opaque strings here, their structure is checked by the gateway tests
+	openapi3filter.RegisterBodyDecoder(gateway.MIMEApplicationRSS, openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(gateway.MIMEApplicationAtom, openapi3filter.FileBodyDecoder)
+
+	// as are exports, which the gateway tests read back in each format
+	openapi3filter.RegisterBodyDecoder(gateway.MIMEApplicationNDJSON, openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(gateway.MIMETextCSV, openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(gateway.MIMEApplicationParquet, openapi3filter.FileBodyDecoder)
+
+	item := models.Item{ID: 1, Type: "story", Title: "Intro", Score: 128, CreatedAt: time.Unix(1633046400, 0).UTC(), CreatedBy: "pg"}
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+
+	type testcase struct {
+		name        string
+		target      string
+		expectMocks func(hn *hackernews.Mock)
+		// invalidRequest skips request validation for requests the spec rejects
+		invalidRequest     bool
+		expectedStatusCode int
+	}
+
+	tests := []testcase{
+		{
+			name:   "list with every filter",
+			target: "/v1/stories?limit=1&sort=top&author=pg&min_score=10&since=2021-09-01T00:00:00Z&until=1633046401",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("FetchStories", mock.Anything, mock.Anything).Return([]models.Item{item}, "abc", nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "list with invalid parameters",
+			target:             "/v1/all?limit=0&sort=random",
+			expectMocks:        func(hn *hackernews.Mock) {},
+			invalidRequest:     true,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "list with the api unavailable",
+			target: "/v1/jobs",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("FetchJobs", mock.Anything, mock.Anything).Return(nil, "", unavailable)
+			},
+			expectedStatusCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:   "get item",
+			target: "/v1/items/1",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("FetchItem", mock.Anything, 1).Return(item, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:   "get missing item",
+			target: "/v1/items/2",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("FetchItem", mock.Anything, 2).Return(nil, hackernews.ErrNotFound)
+			},
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:   "get items",
+			target: "/v1/items?ids=1,2",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("FetchItems", mock.Anything, []int{1, 2}).Return([]models.Item{item, item}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:   "search",
+			target: "/v1/search?q=compiler&limit=1",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("Search", mock.Anything, "compiler", hackernews.SearchOptions{Limit: 1}).
+					Return([]models.SearchResult{{Item: item, Snippet: "<mark>compiler</mark>", Rank: 0.5}}, "", nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "search without a query",
+			target:             "/v1/search",
+			expectMocks:        func(hn *hackernews.Mock) {},
+			invalidRequest:     true,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "rss feed",
+			target: "/v1/feeds/stories.rss?author=pg&min_score=10",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("FetchStories", mock.Anything, mock.Anything).Return([]models.Item{item}, "abc", nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:   "atom feed",
+			target: "/v1/feeds/jobs.atom",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("FetchJobs", mock.Anything, mock.Anything).Return([]models.Item{item}, "", nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "unknown feed",
+			target:             "/v1/feeds/stories.json",
+			expectMocks:        func(hn *hackernews.Mock) {},
+			invalidRequest:     true,
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:   "ndjson export",
+			target: "/v1/export/all?limit=50000&author=pg",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("Export", mock.Anything, mock.Anything).Return([]models.Item{item}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:   "csv export",
+			target: "/v1/export/stories?format=csv",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("Export", mock.Anything, mock.Anything).Return([]models.Item{item}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:   "parquet export",
+			target: "/v1/export/jobs?format=parquet",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("Export", mock.Anything, mock.Anything).Return([]models.Item{item}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "export in an unknown format",
+			target:             "/v1/export/all?format=xlsx",
+			expectMocks:        func(hn *hackernews.Mock) {},
+			invalidRequest:     true,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:   "export with the api unavailable",
+			target: "/v1/export/all",
+			expectMocks: func(hn *hackernews.Mock) {
+				hn.On("Export", mock.Anything, mock.Anything).Return(nil, unavailable)
+			},
+			expectedStatusCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:               "specification",
+			target:             "/v1/openapi.json",
+			expectMocks:        func(hn *hackernews.Mock) {},
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hn := &hackernews.Mock{}
+			tc.expectMocks(hn)
+
+			rec := serve(hn, tc.target)
+			require.Equal(t, tc.expectedStatusCode, rec.Code)
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com"+tc.target, nil)
+			route, pathParams, err := specRouter.FindRoute(req)
+			require.NoError(t, err)
+
+			requestInput := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+			}
+
+			err = openapi3filter.ValidateRequest(context.Background(), requestInput)
+			if tc.invalidRequest {
+				assert.Error(t, err, "the request should violate the specification")
+			} else {
+				assert.NoError(t, err)
+			}
+
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: requestInput,
+				Status:                 rec.Code,
+				Header:                 rec.Header(),
+				Body:                   io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
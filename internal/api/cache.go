@@ -3,135 +3,620 @@ package api
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/invalidation"
 	"github.com/alexdunne/gs-onboarding/internal/models"
 	"github.com/go-redis/cache/v8"
 	"github.com/go-redis/redis/v8"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
+// fetchTimeout bounds how long a fetch shared between callers, or refreshing a stale entry in the
+// background, may take. These fetches outlive the request that started them
+const fetchTimeout = 10 * time.Second
+
 // Cache is an interace to expose cache methods
 type Cache interface {
-	GetAll(ctx context.Context) ([]models.Item, error)
-	GetStories(ctx context.Context) ([]models.Item, error)
-	GetJobs(ctx context.Context) ([]models.Item, error)
+	List(ctx context.Context, q database.ListQuery) ([]models.Item, error)
+	Get(ctx context.Context, id int) (models.Item, error)
+	GetMany(ctx context.Context, ids []int) ([]models.Item, error)
+	Search(ctx context.Context, q database.SearchQuery) ([]models.SearchResult, error)
 }
 
 type itemCache struct {
-	db     database.Database
-	cache  *cache.Cache
-	ring   *redis.Ring
-	ttl    time.Duration
-	logger *zap.Logger
+	stats cacheCounters
+
+	db       database.Database
+	cache    *cache.Cache
+	ring     *redis.Ring
+	keys     keys
+	ttl      time.Duration
+	maxStale time.Duration
+	group    singleflight.Group
+	logger   *zap.Logger
+
+	// localQueries are the list and search keys this replica may hold in its local cache. The shared
+	// set in redis is emptied by whichever replica handles an invalidation first, so each replica
+	// evicts its own local entries from this set
+	mu           sync.Mutex
+	localQueries map[string]struct{}
+}
+
+// CacheStats counts how cache reads were served
+type CacheStats struct {
+	// Hits are reads served a fresh value from redis or the local cache
+	Hits int64 `json:"hits"`
+	// Misses are reads that had to wait for the database
+	Misses int64 `json:"misses"`
+	// Stale are reads served an expired value while it is refreshed in the background
+	Stale int64 `json:"stale"`
+	// Errors are failed cache reads and writes, usually because redis is unavailable
+	Errors int64 `json:"errors"`
+}
+
+type cacheCounters struct {
+	hits, misses, stale, errors int64
+}
+
+// entry wraps a cached value with when it was fetched so expired values can still be served
+type entry struct {
+	Value     []byte
+	FetchedAt time.Time
 }
 
 // CacheOption is an interface for a functional option
 type CacheOption func(c *itemCache)
 
-// WithTTL is a functional option to configure the cache TTL
+// WithTTL is a functional option to configure how long cached values are fresh for
 func WithTTL(ttl time.Duration) CacheOption {
 	return func(c *itemCache) {
 		c.ttl = ttl
 	}
 }
 
-// NewCache creates a new cache
+// WithMaxStale is a functional option to configure how long after the TTL a value may still be served
+// while it is refreshed
+func WithMaxStale(maxStale time.Duration) CacheOption {
+	return func(c *itemCache) {
+		c.maxStale = maxStale
+	}
+}
+
+// WithNamespace is a functional option to configure the version all cache keys are stored under
+func WithNamespace(namespace string) CacheOption {
+	return func(c *itemCache) {
+		c.keys.namespace = namespace
+	}
+}
+
+// NewCache creates a new cache. An unreachable redis is not fatal, reads fall back to the local cache
+// and the database until it recovers
 func NewCache(ctx context.Context, redisAddr string, db database.Database, logger *zap.Logger, opts ...CacheOption) (*itemCache, error) {
 	ring := redis.NewRing(&redis.RingOptions{
 		Addrs: map[string]string{
 			"leader": redisAddr,
 		},
+		DialTimeout:  time.Second,
+		ReadTimeout:  500 * time.Millisecond,
+		WriteTimeout: 500 * time.Millisecond,
 	})
 
-	c := cache.New(&cache.Options{
+	if err := ring.Ping(ctx).Err(); err != nil {
+		logger.Warn("redis is unavailable, serving from the local cache and database", zap.Error(err))
+	}
+
+	return newItemCache(ring, db, logger, opts...), nil
+}
+
+func newItemCache(ring *redis.Ring, db database.Database, logger *zap.Logger, opts ...CacheOption) *itemCache {
+	c := &itemCache{
+		db:           db,
+		ring:         ring,
+		keys:         keys{namespace: defaultNamespace},
+		ttl:          5 * time.Minute,
+		maxStale:     time.Hour,
+		logger:       logger,
+		localQueries: map[string]struct{}{},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// local entries are kept as long as stale values may be served so they can stand in for redis
+	c.cache = cache.New(&cache.Options{
 		Redis:      ring,
-		LocalCache: cache.NewTinyLFU(1000, time.Minute),
+		LocalCache: cache.NewTinyLFU(1000, c.ttl+c.maxStale),
 	})
 
-	_, err := ring.Ping(ctx).Result()
+	return c
+}
+
+// Stats returns the number of reads served so far by outcome
+func (c *itemCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&c.stats.hits),
+		Misses: atomic.LoadInt64(&c.stats.misses),
+		Stale:  atomic.LoadInt64(&c.stats.stale),
+		Errors: atomic.LoadInt64(&c.stats.errors),
+	}
+}
+
+// load reads key into dst. Fresh values are returned as is, stale values are returned while fetch
+// refreshes them in the background and anything else waits for fetch. Concurrent fetches of the same
+// key are shared
+func (c *itemCache) load(ctx context.Context, key string, dst interface{}, fetch func(ctx context.Context) (interface{}, error)) error {
+	return c.loadAndTrack(ctx, key, dst, fetch, nil)
+}
+
+// loadQuery loads a list or search key and tracks it so invalidations can find it. The key is tracked
+// after its value is written, so an invalidation between the fetch and the write can't leave a stale
+// value that is never evicted
+func (c *itemCache) loadQuery(ctx context.Context, key string, dst interface{}, fetch func(ctx context.Context) (interface{}, error)) error {
+	if err := c.loadAndTrack(ctx, key, dst, fetch, c.trackQueryKey); err != nil {
+		return err
+	}
+
+	// values read from redis are copied into the local cache too
+	c.trackLocalQuery(key)
+
+	return nil
+}
+
+// loadAndTrack is load, calling stored, when it isn't nil, after a fetched value is written
+func (c *itemCache) loadAndTrack(ctx context.Context, key string, dst interface{}, fetch func(ctx context.Context) (interface{}, error), stored func(ctx context.Context, key string)) error {
+	e, ok := c.read(ctx, key)
+	if ok {
+		age := time.Since(e.FetchedAt)
+		if age <= c.ttl {
+			atomic.AddInt64(&c.stats.hits, 1)
+			return c.cache.Unmarshal(e.Value, dst)
+		}
+
+		if age <= c.ttl+c.maxStale {
+			atomic.AddInt64(&c.stats.stale, 1)
+			go c.refresh(key, fetch, stored)
+			return c.cache.Unmarshal(e.Value, dst)
+		}
+	}
+
+	atomic.AddInt64(&c.stats.misses, 1)
+	c.logger.Info(fmt.Sprintf("%s cache missed. fetching from source", key))
+
+	e, err := c.fetchShared(ctx, key, fetch, stored)
 	if err != nil {
-		return nil, errors.Wrap(err, "pinging with new client")
+		return err
 	}
 
-	ret := &itemCache{
-		db:     db,
-		cache:  c,
-		ring:   ring,
-		ttl:    5 * time.Minute,
-		logger: logger,
+	return c.cache.Unmarshal(e.Value, dst)
+}
+
+// fetchShared fetches and stores key, sharing the fetch with concurrent callers. The fetch runs detached
+// from ctx so one caller giving up doesn't fail every other caller waiting on it, while the caller
+// itself stops waiting as soon as ctx is done
+func (c *itemCache) fetchShared(ctx context.Context, key string, fetch func(ctx context.Context) (interface{}, error), stored func(ctx context.Context, key string)) (entry, error) {
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(detach(ctx), fetchTimeout)
+		defer cancel()
+
+		return c.fetchAndStore(ctx, key, fetch, stored)
+	})
+
+	select {
+	case <-ctx.Done():
+		return entry{}, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return entry{}, res.Err
+		}
+
+		return res.Val.(entry), nil
 	}
+}
 
-	for _, opt := range opts {
-		opt(ret)
+// detachedContext carries the values of its parent but none of its deadline or cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// read fetches the entry for key from the local cache or redis. Redis errors are counted and treated as a miss
+func (c *itemCache) read(ctx context.Context, key string) (entry, bool) {
+	var e entry
+	if err := c.cache.Get(ctx, key, &e); err != nil {
+		if err != cache.ErrCacheMiss {
+			atomic.AddInt64(&c.stats.errors, 1)
+			c.logger.Warn("reading from cache", zap.String("key", key), zap.Error(err))
+		}
+
+		return entry{}, false
 	}
 
-	return ret, nil
+	return e, true
 }
 
-// GetAll fetches all items from the cache and falls back to fetching from the database
-func (c *itemCache) GetAll(ctx context.Context) ([]models.Item, error) {
-	var items []models.Item
+// refresh fetches and stores a stale key without holding up the request that found it
+func (c *itemCache) refresh(key string, fetch func(ctx context.Context) (interface{}, error), stored func(ctx context.Context, key string)) {
+	if _, err := c.fetchShared(context.Background(), key, fetch, stored); err != nil {
+		c.logger.Warn("refreshing stale cache entry", zap.String("key", key), zap.Error(err))
+	}
+}
+
+func (c *itemCache) fetchAndStore(ctx context.Context, key string, fetch func(ctx context.Context) (interface{}, error), stored func(ctx context.Context, key string)) (interface{}, error) {
+	v, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.cache.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding cache value")
+	}
+
+	e := entry{Value: b, FetchedAt: time.Now()}
+	c.store(ctx, key, e)
+
+	if stored != nil {
+		stored(ctx, key)
+	}
+
+	return e, nil
+}
 
-	key := "items:all"
-	err := c.cache.Once(&cache.Item{
+// store writes an entry to the local cache and redis. Redis errors are counted and logged as the
+// local copy is still written
+func (c *itemCache) store(ctx context.Context, key string, e entry) {
+	if err := c.cache.Set(&cache.Item{
+		Ctx:   ctx,
 		Key:   key,
-		Value: &items,
-		TTL:   c.ttl,
-		Do: func(*cache.Item) (interface{}, error) {
-			c.logger.Info(fmt.Sprintf("%s cache missed. fetching from source", key))
-			return c.db.GetAll(ctx)
-		},
-	})
+		Value: e,
+		TTL:   c.ttl + c.maxStale,
+	}); err != nil {
+		atomic.AddInt64(&c.stats.errors, 1)
+		c.logger.Warn("writing to cache", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// List fetches a page of items from the cache and falls back to fetching from the database. Only the
+// ids of the page are cached against the query, the items themselves are cached individually
+func (c *itemCache) List(ctx context.Context, q database.ListQuery) ([]models.Item, error) {
+	var ids []int
+
+	key := c.keys.list(q)
+	fetch := func(ctx context.Context) (interface{}, error) {
+		items, err := c.db.List(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+
+		c.setItems(ctx, items)
+
+		return itemIDs(items), nil
+	}
+
+	if err := c.loadQuery(ctx, key, &ids, fetch); err != nil {
+		return nil, err
+	}
+
+	items, err := c.GetMany(ctx, ids)
+	if err != nil || len(items) == len(ids) {
+		return items, err
+	}
+
+	// an item on the page has been deleted since it was cached. The page is short, which would hide
+	// the next page, so it's treated as a miss and fetched again
+	atomic.AddInt64(&c.stats.misses, 1)
+
+	e, err := c.fetchShared(ctx, key, fetch, c.trackQueryKey)
 	if err != nil {
 		return nil, err
 	}
 
-	return items, nil
+	if err := c.cache.Unmarshal(e.Value, &ids); err != nil {
+		return nil, err
+	}
+
+	return c.GetMany(ctx, ids)
 }
 
-// GetStories fetches all story items from the cache and falls back to fetching from the database
-func (c *itemCache) GetStories(ctx context.Context) ([]models.Item, error) {
-	var items []models.Item
+// Get fetches a single item from the cache and falls back to fetching from the database
+func (c *itemCache) Get(ctx context.Context, id int) (models.Item, error) {
+	var item models.Item
 
-	key := "items:stories"
-	err := c.cache.Once(&cache.Item{
-		Key:   key,
-		Value: &items,
-		TTL:   c.ttl,
-		Do: func(*cache.Item) (interface{}, error) {
-			c.logger.Info(fmt.Sprintf("%s cache missed. fetching from source", key))
-			return c.db.GetStories(ctx)
-		},
+	err := c.load(ctx, c.keys.item(id), &item, func(ctx context.Context) (interface{}, error) {
+		return c.db.Get(ctx, id)
 	})
 	if err != nil {
-		return nil, err
+		return models.Item{}, err
+	}
+
+	return item, nil
+}
+
+// GetMany fetches items from the cache one id at a time and fetches any misses from the database in one query.
+// Stale items are returned and refreshed in the background. Items are returned in the order of ids and ids
+// that do not exist are skipped
+func (c *itemCache) GetMany(ctx context.Context, ids []int) ([]models.Item, error) {
+	found := make(map[int]models.Item, len(ids))
+
+	var missed, stale []int
+	for _, id := range ids {
+		e, ok := c.read(ctx, c.keys.item(id))
+		age := time.Since(e.FetchedAt)
+		if !ok || age > c.ttl+c.maxStale {
+			missed = append(missed, id)
+			continue
+		}
+
+		var item models.Item
+		if err := c.cache.Unmarshal(e.Value, &item); err != nil {
+			c.logger.Warn("decoding cached item", zap.Int("id", id), zap.Error(err))
+			missed = append(missed, id)
+			continue
+		}
+
+		if age > c.ttl {
+			stale = append(stale, id)
+		}
+
+		found[id] = item
+	}
+
+	atomic.AddInt64(&c.stats.hits, int64(len(found)-len(stale)))
+	atomic.AddInt64(&c.stats.stale, int64(len(stale)))
+	atomic.AddInt64(&c.stats.misses, int64(len(missed)))
+
+	if len(stale) > 0 {
+		go c.refreshItems(stale)
+	}
+
+	if len(missed) > 0 {
+		c.logger.Info(fmt.Sprintf("%d item cache misses. fetching from source", len(missed)))
+		fetched, err := c.db.GetMany(ctx, missed)
+		if err != nil {
+			return nil, err
+		}
+
+		c.setItems(ctx, fetched)
+
+		for _, item := range fetched {
+			found[item.ID] = item
+		}
+	}
+
+	items := make([]models.Item, 0, len(found))
+	for _, id := range ids {
+		if item, ok := found[id]; ok {
+			items = append(items, item)
+		}
 	}
 
 	return items, nil
 }
 
-// GetJobs fetches all job items from the cache and falls back to fetching from the database
-func (c *itemCache) GetJobs(ctx context.Context) ([]models.Item, error) {
-	var items []models.Item
+// refreshItems fetches and stores stale items in one query without holding up the request that found them
+func (c *itemCache) refreshItems(ids []int) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
 
-	key := "items:jobs"
-	err := c.cache.Once(&cache.Item{
-		Key:   key,
-		Value: &items,
-		TTL:   c.ttl,
-		Do: func(*cache.Item) (interface{}, error) {
-			c.logger.Info(fmt.Sprintf("%s cache missed. fetching from source", key))
-			return c.db.GetJobs(ctx)
-		},
+	items, err := c.db.GetMany(ctx, ids)
+	if err != nil {
+		c.logger.Warn("refreshing stale items", zap.Int("count", len(ids)), zap.Error(err))
+		return
+	}
+
+	c.setItems(ctx, items)
+}
+
+// searchHit is the cached form of a search result, the item itself is cached individually
+type searchHit struct {
+	ID      int
+	Snippet string
+	Rank    float64
+}
+
+// Search fetches a page of search results from the cache and falls back to searching the database
+func (c *itemCache) Search(ctx context.Context, q database.SearchQuery) ([]models.SearchResult, error) {
+	var hits []searchHit
+
+	err := c.loadQuery(ctx, c.keys.search(q), &hits, func(ctx context.Context) (interface{}, error) {
+		results, err := c.db.Search(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]searchHit, len(results))
+		items := make([]models.Item, len(results))
+		for i, r := range results {
+			ret[i] = searchHit{ID: r.Item.ID, Snippet: r.Snippet, Rank: r.Rank}
+			items[i] = r.Item
+		}
+
+		c.setItems(ctx, items)
+
+		return ret, nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return items, nil
+	ids := make([]int, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+
+	items, err := c.GetMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]models.Item, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+
+	results := make([]models.SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		item, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+
+		results = append(results, models.SearchResult{Item: item, Snippet: hit.Snippet, Rank: hit.Rank})
+	}
+
+	return results, nil
+}
+
+// setItems caches each item individually. Failures are logged as the items can be fetched again
+func (c *itemCache) setItems(ctx context.Context, items []models.Item) {
+	now := time.Now()
+	for _, item := range items {
+		b, err := c.cache.Marshal(item)
+		if err != nil {
+			c.logger.Warn("encoding item", zap.Int("id", item.ID), zap.Error(err))
+			continue
+		}
+
+		c.store(ctx, c.keys.item(item.ID), entry{Value: b, FetchedAt: now})
+	}
+}
+
+func itemIDs(items []models.Item) []int {
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+
+	return ids
+}
+
+// trackQueryKey records a query key so it can be found again when invalidating. Any item change can
+// affect the results of any query so they are all evicted on invalidation
+func (c *itemCache) trackQueryKey(ctx context.Context, key string) {
+	c.trackLocalQuery(key)
+
+	if err := c.ring.SAdd(ctx, c.keys.queries(), key).Err(); err != nil {
+		c.logger.Warn("tracking cache key", zap.String("key", key), zap.Error(err))
+	}
+}
+
+func (c *itemCache) trackLocalQuery(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.localQueries[key] = struct{}{}
+}
+
+// untrackLocalQueries returns the query keys this replica may hold locally and stops tracking them
+func (c *itemCache) untrackLocalQueries() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.localQueries))
+	for key := range c.localQueries {
+		keys = append(keys, key)
+	}
+	c.localQueries = map[string]struct{}{}
+
+	return keys
+}
+
+// WatchInvalidations evicts items announced as changed by the consumer until ctx is cancelled. Every
+// replica runs this so their local caches are cleared along with the shared redis keys
+func (c *itemCache) WatchInvalidations(ctx context.Context) {
+	pubsub := c.ring.Subscribe(ctx, invalidation.Channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			m, err := invalidation.Decode(msg.Payload)
+			if err != nil {
+				c.logger.Error("reading invalidation message", zap.Error(err))
+				continue
+			}
+
+			c.invalidate(ctx, m.IDs)
+		}
+	}
+}
+
+// invalidate evicts the given items and every cached query from both redis and the local cache
+func (c *itemCache) invalidate(ctx context.Context, ids []int) {
+	evict := make([]string, 0, len(ids))
+	for _, id := range ids {
+		evict = append(evict, c.keys.item(id))
+	}
+
+	// local entries are evicted even when redis can't be reached or another replica already emptied the shared set
+	localKeys := c.untrackLocalQueries()
+	evict = append(evict, localKeys...)
+
+	queryKeys, err := c.ring.SMembers(ctx, c.keys.queries()).Result()
+	if err != nil {
+		c.logger.Error("reading cached query keys", zap.Error(err))
+	}
+	evict = append(evict, queryKeys...)
+
+	for _, key := range evict {
+		c.cache.DeleteFromLocalCache(key)
+	}
+
+	if err := c.ring.Del(ctx, evict...).Err(); err != nil {
+		c.logger.Error("evicting cache keys", zap.Error(err))
+		return
+	}
+
+	if len(queryKeys) > 0 {
+		members := make([]interface{}, len(queryKeys))
+		for i, key := range queryKeys {
+			members[i] = key
+		}
+
+		if err := c.ring.SRem(ctx, c.keys.queries(), members...).Err(); err != nil {
+			c.logger.Error("untracking cache keys", zap.Error(err))
+		}
+	}
+
+	c.logger.Info("invalidated cache", zap.Int("items", len(ids)), zap.Int("queries", len(queryKeys)), zap.Int("local_queries", len(localKeys)))
+}
+
+// Ping checks redis can be reached
+func (c *itemCache) Ping(ctx context.Context) error {
+	return c.ring.Ping(ctx).Err()
 }
 
 func (c *itemCache) Close() {
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newUnavailableCache creates a cache whose redis cannot be reached so only the local cache is used
+func newUnavailableCache(t *testing.T, db database.Database, opts ...CacheOption) *itemCache {
+	ring := redis.NewRing(&redis.RingOptions{
+		Addrs:       map[string]string{"leader": "127.0.0.1:1"},
+		DialTimeout: 10 * time.Millisecond,
+		MaxRetries:  -1,
+	})
+	t.Cleanup(func() { ring.Close() })
+
+	return newItemCache(ring, db, zap.NewNop(), opts...)
+}
+
+func TestCacheGet(t *testing.T) {
+	t.Run("falls back to the local cache and database when redis is unavailable", func(t *testing.T) {
+		db := &database.Mock{}
+		db.On("Get", mock.Anything, 1).Return(models.Item{ID: 1, Title: "first"}, nil).Once()
+
+		c := newUnavailableCache(t, db)
+
+		for i := 0; i < 2; i++ {
+			item, err := c.Get(context.Background(), 1)
+			require.NoError(t, err)
+			assert.Equal(t, "first", item.Title)
+		}
+
+		db.AssertExpectations(t)
+
+		stats := c.Stats()
+		assert.Equal(t, int64(1), stats.Misses)
+		assert.Equal(t, int64(1), stats.Hits)
+		assert.NotZero(t, stats.Errors)
+	})
+
+	t.Run("serves stale items while refreshing them", func(t *testing.T) {
+		db := &database.Mock{}
+		db.On("Get", mock.Anything, 1).Return(models.Item{ID: 1, Title: "first"}, nil).Once()
+		db.On("Get", mock.Anything, 1).Return(models.Item{ID: 1, Title: "second"}, nil)
+
+		c := newUnavailableCache(t, db, WithTTL(10*time.Millisecond), WithMaxStale(time.Minute))
+
+		item, err := c.Get(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, "first", item.Title)
+
+		time.Sleep(20 * time.Millisecond)
+
+		item, err = c.Get(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, "first", item.Title)
+		assert.Equal(t, int64(1), c.Stats().Stale)
+
+		assert.Eventually(t, func() bool {
+			item, err := c.Get(context.Background(), 1)
+			return err == nil && item.Title == "second"
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("serves stale items while the database is down", func(t *testing.T) {
+		db := &database.Mock{}
+		db.On("Get", mock.Anything, 1).Return(models.Item{ID: 1, Title: "first"}, nil).Once()
+		db.On("Get", mock.Anything, 1).Return(nil, errors.New("connection refused"))
+
+		c := newUnavailableCache(t, db, WithTTL(time.Millisecond), WithMaxStale(time.Minute))
+
+		_, err := c.Get(context.Background(), 1)
+		require.NoError(t, err)
+
+		time.Sleep(5 * time.Millisecond)
+
+		for i := 0; i < 3; i++ {
+			item, err := c.Get(context.Background(), 1)
+			require.NoError(t, err)
+			assert.Equal(t, "first", item.Title)
+		}
+	})
+
+	t.Run("waits for the database once past the maximum staleness", func(t *testing.T) {
+		db := &database.Mock{}
+		db.On("Get", mock.Anything, 1).Return(models.Item{ID: 1, Title: "first"}, nil).Once()
+		db.On("Get", mock.Anything, 1).Return(nil, errors.New("connection refused"))
+
+		c := newUnavailableCache(t, db, WithTTL(time.Millisecond), WithMaxStale(time.Millisecond))
+
+		_, err := c.Get(context.Background(), 1)
+		require.NoError(t, err)
+
+		time.Sleep(5 * time.Millisecond)
+
+		_, err = c.Get(context.Background(), 1)
+		assert.Error(t, err)
+	})
+}
+
+// blockingDB holds item lookups until released, failing them if their context is done first
+type blockingDB struct {
+	database.Mock
+	release chan struct{}
+}
+
+func (d *blockingDB) Get(ctx context.Context, id int) (models.Item, error) {
+	select {
+	case <-d.release:
+		return models.Item{ID: id}, nil
+	case <-ctx.Done():
+		return models.Item{}, ctx.Err()
+	}
+}
+
+func TestCacheSharedFetch(t *testing.T) {
+	db := &blockingDB{release: make(chan struct{})}
+	c := newUnavailableCache(t, db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := c.Get(ctx, 1)
+		first <- err
+	}()
+
+	// the second caller joins the fetch the first one started
+	time.Sleep(20 * time.Millisecond)
+	second := make(chan error)
+	go func() {
+		_, err := c.Get(context.Background(), 1)
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+
+	close(db.release)
+	assert.NoError(t, <-second)
+}
+
+func TestCacheList(t *testing.T) {
+	db := &database.Mock{}
+	q := database.ListQuery{Type: "story", Limit: 2}
+	db.On("List", mock.Anything, q).Return([]models.Item{{ID: 2}, {ID: 1}}, nil).Once()
+
+	c := newUnavailableCache(t, db)
+
+	for i := 0; i < 2; i++ {
+		items, err := c.List(context.Background(), q)
+		require.NoError(t, err)
+		assert.Equal(t, []int{2, 1}, itemIDs(items))
+	}
+
+	// the page items are cached individually so no item lookups reach the database
+	db.AssertExpectations(t)
+	db.AssertNotCalled(t, "GetMany", mock.Anything, mock.Anything)
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	db := &database.Mock{}
+	q := database.ListQuery{Type: "story", Limit: 2}
+	db.On("List", mock.Anything, q).Return([]models.Item{{ID: 2, Title: "first"}, {ID: 1}}, nil).Once()
+	db.On("List", mock.Anything, q).Return([]models.Item{{ID: 2, Title: "second"}, {ID: 1}}, nil).Once()
+
+	// redis is unavailable so the shared set of query keys can't be read, only this replica's own
+	c := newUnavailableCache(t, db)
+
+	items, err := c.List(context.Background(), q)
+	require.NoError(t, err)
+	assert.Equal(t, "first", items[0].Title)
+
+	c.invalidate(context.Background(), []int{2})
+
+	items, err = c.List(context.Background(), q)
+	require.NoError(t, err)
+	assert.Equal(t, "second", items[0].Title)
+
+	db.AssertExpectations(t)
+}
+
+func TestCacheListDeletedItem(t *testing.T) {
+	db := &database.Mock{}
+	q := database.ListQuery{Type: "story", Limit: 2}
+	db.On("List", mock.Anything, q).Return([]models.Item{{ID: 2}, {ID: 1}}, nil).Once()
+	db.On("List", mock.Anything, q).Return([]models.Item{{ID: 2}, {ID: 3}}, nil).Once()
+	db.On("GetMany", mock.Anything, []int{1}).Return([]models.Item{}, nil).Once()
+
+	c := newUnavailableCache(t, db)
+
+	items, err := c.List(context.Background(), q)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 1}, itemIDs(items))
+
+	// the item is deleted after the page was cached
+	c.cache.DeleteFromLocalCache(c.keys.item(1))
+
+	items, err = c.List(context.Background(), q)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, itemIDs(items))
+
+	db.AssertExpectations(t)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/golang/protobuf/proto"
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// unavailableRetryDelay is how long clients are told to wait before retrying an unavailable call
+const unavailableRetryDelay = time.Second
+
+// statusError is a status sent to clients without its cause. The cause stays in Error so the Logging
+// interceptor records it, but database and network errors can reveal SQL, schema and addresses
+type statusError struct {
+	st    *status.Status
+	cause error
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.st.Message(), e.cause)
+}
+
+func (e *statusError) Unwrap() error {
+	return e.cause
+}
+
+func (e *statusError) GRPCStatus() *status.Status {
+	return e.st
+}
+
+// toStatus converts an error from the cache, database or stream into a gRPC status error. msg
+// describes what was being done when it failed. Unexpected failures are returned with a generic
+// message, their cause is only logged
+func toStatus(err error, msg string) error {
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) {
+		return se.GRPCStatus().Err()
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, msg+": call cancelled")
+	case errors.Is(err, context.DeadlineExceeded), pgconn.Timeout(err):
+		return status.Error(codes.DeadlineExceeded, msg+": deadline exceeded")
+	case errors.Is(err, database.ErrNotFound):
+		return status.Error(codes.NotFound, msg+": not found")
+	case isUnavailable(err):
+		st := status.New(codes.Unavailable, msg+": temporarily unavailable")
+		if ds, dErr := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(unavailableRetryDelay)}); dErr == nil {
+			st = ds
+		}
+
+		return &statusError{st: st, cause: err}
+	default:
+		return &statusError{st: status.New(codes.Internal, msg+": internal error"), cause: err}
+	}
+}
+
+// isUnavailable reports whether err was caused by a dependency that could not be reached
+func isUnavailable(err error) bool {
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// class 08 is connection exceptions, 57P01-03 are the server shutting down or starting up
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+
+	return false
+}
+
+// invalidArgument builds an InvalidArgument status describing which request field is wrong
+func invalidArgument(field, description string) error {
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("%s: %s", field, description))
+	return withDetails(st, &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: field, Description: description},
+		},
+	})
+}
+
+// itemsNotFound builds a NotFound status naming each missing item
+func itemsNotFound(ids ...int) error {
+	var msg string
+	if len(ids) == 1 {
+		msg = fmt.Sprintf("item %d not found", ids[0])
+	} else {
+		msg = fmt.Sprintf("%d items not found", len(ids))
+	}
+
+	details := make([]proto.Message, len(ids))
+	for i, id := range ids {
+		details[i] = &errdetails.ResourceInfo{
+			ResourceType: "item",
+			ResourceName: strconv.Itoa(id),
+			Description:  "item does not exist",
+		}
+	}
+
+	return withDetails(status.New(codes.NotFound, msg), details...)
+}
+
+// withDetails attaches details to a status and returns it as an error. The status is returned without
+// details if they cannot be encoded
+func withDetails(st *status.Status, details ...proto.Message) error {
+	ds, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+
+	return ds.Err()
+}
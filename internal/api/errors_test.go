@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToStatus(t *testing.T) {
+	type testcase struct {
+		name         string
+		err          error
+		expectedCode codes.Code
+	}
+
+	tests := []testcase{
+		{
+			name:         "existing status",
+			err:          errors.Wrap(status.Error(codes.ResourceExhausted, "slow down"), "fetching"),
+			expectedCode: codes.ResourceExhausted,
+		},
+		{
+			name:         "cancelled",
+			err:          errors.Wrap(context.Canceled, "fetching"),
+			expectedCode: codes.Canceled,
+		},
+		{
+			name:         "deadline exceeded",
+			err:          errors.Wrap(context.DeadlineExceeded, "fetching"),
+			expectedCode: codes.DeadlineExceeded,
+		},
+		{
+			name:         "not found",
+			err:          errors.Wrap(database.ErrNotFound, "fetching"),
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "connection refused",
+			err:          errors.Wrap(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, "fetching"),
+			expectedCode: codes.Unavailable,
+		},
+		{
+			name:         "database shutting down",
+			err:          errors.Wrap(&pgconn.PgError{Code: "57P01"}, "fetching"),
+			expectedCode: codes.Unavailable,
+		},
+		{
+			name:         "query error",
+			err:          errors.Wrap(&pgconn.PgError{Code: "42P01"}, "fetching"),
+			expectedCode: codes.Internal,
+		},
+		{
+			name:         "unknown error",
+			err:          errors.New("boom"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedCode, status.Code(toStatus(tc.err, "fetching items")))
+		})
+	}
+}
+
+func TestStatusDetails(t *testing.T) {
+	t.Run("invalid argument names the field", func(t *testing.T) {
+		st := status.Convert(invalidArgument("page_size", "must not be negative"))
+		require.Len(t, st.Details(), 1)
+
+		br, ok := st.Details()[0].(*errdetails.BadRequest)
+		require.True(t, ok)
+		assert.Equal(t, "page_size", br.GetFieldViolations()[0].GetField())
+		assert.Equal(t, "must not be negative", br.GetFieldViolations()[0].GetDescription())
+	})
+
+	t.Run("not found names each item", func(t *testing.T) {
+		st := status.Convert(itemsNotFound(1, 2))
+		assert.Equal(t, codes.NotFound, st.Code())
+		require.Len(t, st.Details(), 2)
+
+		for i, name := range []string{"1", "2"} {
+			ri, ok := st.Details()[i].(*errdetails.ResourceInfo)
+			require.True(t, ok)
+			assert.Equal(t, name, ri.GetResourceName())
+		}
+	})
+
+	t.Run("internal errors hide their cause from clients", func(t *testing.T) {
+		err := toStatus(&pgconn.PgError{Code: "42P01", Message: `relation "items" does not exist`}, "fetching items")
+
+		st := status.Convert(err)
+		assert.Equal(t, codes.Internal, st.Code())
+		assert.Equal(t, "fetching items: internal error", st.Message())
+
+		// the cause is kept for the logs
+		assert.Contains(t, err.Error(), `relation "items" does not exist`)
+	})
+
+	t.Run("unavailable suggests a retry delay", func(t *testing.T) {
+		st := status.Convert(toStatus(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "fetching items"))
+		require.Len(t, st.Details(), 1)
+
+		_, ok := st.Details()[0].(*errdetails.RetryInfo)
+		assert.True(t, ok)
+		assert.NotContains(t, st.Message(), "connection refused")
+	})
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// eventPageSize is the number of events read from the store at a time
+	eventPageSize = 500
+	// subscriberBuffer is the number of events a subscriber can fall behind by before it is dropped
+	subscriberBuffer = 256
+	// eventPollInterval is how often events are read without a notification. Events held back behind a
+	// transaction still in progress are only readable once it finishes, which may not notify
+	eventPollInterval = time.Second
+)
+
+// EventStore is a interface to expose methods to read recorded item events
+type EventStore interface {
+	ListenEvents(ctx context.Context, notify func()) error
+	EventsAfter(ctx context.Context, after models.EventPosition, limit int) ([]models.ItemEvent, error)
+	LatestEventPosition(ctx context.Context) (models.EventPosition, error)
+}
+
+// EventSource is a interface to expose methods to follow item events
+type EventSource interface {
+	Subscribe() (<-chan models.ItemEvent, func())
+	EventsAfter(ctx context.Context, after models.EventPosition, limit int) ([]models.ItemEvent, error)
+}
+
+// EventHub shares a single database listener between every watcher and fans events out to them
+type EventHub struct {
+	store  EventStore
+	logger *zap.Logger
+
+	mu          sync.Mutex
+	subscribers map[chan models.ItemEvent]struct{}
+}
+
+// NewEventHub creates a new event hub
+func NewEventHub(store EventStore, logger *zap.Logger) *EventHub {
+	return &EventHub{
+		store:       store,
+		logger:      logger,
+		subscribers: map[chan models.ItemEvent]struct{}{},
+	}
+}
+
+// Run listens for events until ctx is cancelled, reconnecting if the listener fails. Events
+// recorded while disconnected are delivered once the listener reconnects
+func (h *EventHub) Run(ctx context.Context) {
+	last, err := h.store.LatestEventPosition(ctx)
+	for err != nil {
+		h.logger.Error("fetching latest event position", zap.Error(err))
+		if !sleep(ctx, time.Second) {
+			return
+		}
+
+		last, err = h.store.LatestEventPosition(ctx)
+	}
+
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+
+	for {
+		wake := make(chan struct{}, 1)
+		listenCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+
+		go func() {
+			done <- h.store.ListenEvents(listenCtx, func() {
+				select {
+				case wake <- struct{}{}:
+				default:
+					// a catch up is already pending and will pick this event up
+				}
+			})
+		}()
+
+		// catch up on anything recorded before the listener was ready
+		last = h.catchUp(ctx, last)
+
+	listen:
+		for {
+			select {
+			case <-wake:
+				last = h.catchUp(ctx, last)
+			case <-poll.C:
+				last = h.catchUp(ctx, last)
+			case err := <-done:
+				if err != nil {
+					h.logger.Error("listening for item events", zap.Error(err))
+				}
+				break listen
+			}
+		}
+
+		cancel()
+
+		if !sleep(ctx, time.Second) {
+			return
+		}
+	}
+}
+
+// catchUp broadcasts every event after last and returns the position of the last one sent
+func (h *EventHub) catchUp(ctx context.Context, last models.EventPosition) models.EventPosition {
+	for {
+		events, err := h.store.EventsAfter(ctx, last, eventPageSize)
+		if err != nil {
+			h.logger.Error("fetching item events", zap.Error(err))
+			return last
+		}
+
+		for _, e := range events {
+			h.broadcast(e)
+			last = e.Position()
+		}
+
+		if len(events) < eventPageSize {
+			return last
+		}
+	}
+}
+
+func (h *EventHub) broadcast(e models.ItemEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// the subscriber has fallen too far behind, closing the channel tells it to resume from its last event
+			h.logger.Warn("dropping slow event subscriber")
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel of events recorded from now on and a function to unsubscribe. The
+// channel is closed if the subscriber falls too far behind
+func (h *EventHub) Subscribe() (<-chan models.ItemEvent, func()) {
+	ch := make(chan models.ItemEvent, subscriberBuffer)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// EventsAfter fetches recorded events so subscribers can replay missed events
+func (h *EventHub) EventsAfter(ctx context.Context, after models.EventPosition, limit int) ([]models.ItemEvent, error) {
+	return h.store.EventsAfter(ctx, after, limit)
+}
+
+// sleep waits for d and reports false if ctx was cancelled first
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
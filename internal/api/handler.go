@@ -1,62 +1,282 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/alexdunne/gs-onboarding/internal/database"
 	"github.com/alexdunne/gs-onboarding/internal/models"
 	"github.com/pkg/errors"
-	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 // Handler contains the endpoint handlers
 type Handler struct {
 	pb.UnimplementedAPIServer
 	Cache Cache
+	// DB is read directly for pages too large to cache
+	DB     database.Database
+	Events EventSource
+	// HeartbeatInterval is how often WatchItems sends a heartbeat while idle, defaults to 15 seconds
+	HeartbeatInterval time.Duration
+}
+
+// ListAll streams a page of items to a client
+func (h Handler) ListAll(req *pb.ListItemsRequest, s pb.API_ListAllServer) error {
+	return h.list(req, "", s)
 }
 
-// ListAll streams a collection of items to a client
-func (h Handler) ListAll(empty *emptypb.Empty, s pb.API_ListAllServer) error {
-	items, err := h.Cache.GetAll(s.Context())
+// ListStories streams a page of story items to a client
+func (h Handler) ListStories(req *pb.ListItemsRequest, s pb.API_ListStoriesServer) error {
+	return h.list(req, "story", s)
+}
+
+// ListJobs streams a page of job items to a client
+func (h Handler) ListJobs(req *pb.ListItemsRequest, s pb.API_ListJobsServer) error {
+	return h.list(req, "job", s)
+}
+
+type itemServerStream interface {
+	grpc.ServerStream
+	Send(*pb.Item) error
+}
+
+func (h Handler) list(req *pb.ListItemsRequest, itemType string, s itemServerStream) error {
+	q, err := parseListRequest(req, itemType)
+	if err != nil {
+		return err
+	}
+
+	if q.Limit > maxCachedPageSize {
+		return h.streamList(q, s)
+	}
+
+	// fetch an extra item to find out whether there is another page
+	pageSize := q.Limit
+	q.Limit++
+
+	items, err := h.Cache.List(s.Context(), q)
 	if err != nil {
-		return errors.Wrap(err, "fetching all items")
+		return toStatus(err, "fetching items")
+	}
+
+	if len(items) > pageSize {
+		items = items[:pageSize]
+		s.SetTrailer(metadata.Pairs(NextPageTokenKey, encodePageToken(q.Sort, items[len(items)-1])))
 	}
 
 	for _, v := range items {
 		if err := s.Send(models.Itop(v)); err != nil {
-			return errors.Wrap(err, "streaming item to client")
+			return toStatus(err, "streaming item to client")
 		}
 	}
 
 	return nil
 }
 
-// ListStories streams a collection of story items to a client
-func (h Handler) ListStories(empty *emptypb.Empty, s pb.API_ListStoriesServer) error {
-	items, err := h.Cache.GetStories(s.Context())
+// streamList sends items to the client as they are read from the database. Send blocks while the
+// client isn't reading, which in turn stops rows being read, so memory use doesn't grow with the page size
+func (h Handler) streamList(q database.ListQuery, s itemServerStream) error {
+	// fetch an extra item to find out whether there is another page
+	pageSize := q.Limit
+	q.Limit++
+
+	it, err := h.DB.Iterate(s.Context(), q)
 	if err != nil {
-		return errors.Wrap(err, "fetching all items")
+		return toStatus(err, "fetching items")
 	}
+	defer it.Close()
 
-	for _, v := range items {
-		if err := s.Send(models.Itop(v)); err != nil {
-			return errors.Wrap(err, "streaming item to client")
+	var (
+		last models.Item
+		sent int
+	)
+
+	for it.Next() {
+		if sent == pageSize {
+			s.SetTrailer(metadata.Pairs(NextPageTokenKey, encodePageToken(q.Sort, last)))
+			break
+		}
+
+		last = it.Item()
+		if err := s.Send(models.Itop(last)); err != nil {
+			return toStatus(err, "streaming item to client")
 		}
+		sent++
+	}
+
+	if err := it.Err(); err != nil {
+		return toStatus(err, "reading items")
 	}
 
 	return nil
 }
 
-// ListJobs streams a collection of job items to a client
-func (h Handler) ListJobs(empty *emptypb.Empty, s pb.API_ListJobsServer) error {
-	items, err := h.Cache.GetJobs(s.Context())
+// maxBatchGetSize is the most ids the batch RPCs accept in one request
+const maxBatchGetSize = 100
+
+const (
+	// defaultScoreSamples and maxScoreSamples bound how many scores are returned for each item
+	defaultScoreSamples = 100
+	maxScoreSamples     = 1000
+)
+
+// GetItem returns a single item
+func (h Handler) GetItem(ctx context.Context, req *pb.GetItemRequest) (*pb.Item, error) {
+	if req.GetId() <= 0 {
+		return nil, invalidArgument("id", "must be positive")
+	}
+
+	item, err := h.Cache.Get(ctx, int(req.GetId()))
 	if err != nil {
-		return errors.Wrap(err, "fetching all items")
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, itemsNotFound(int(req.GetId()))
+		}
+
+		return nil, toStatus(err, "fetching item")
 	}
 
-	for _, v := range items {
-		if err := s.Send(models.Itop(v)); err != nil {
-			return errors.Wrap(err, "streaming item to client")
+	return models.Itop(item), nil
+}
+
+// BatchGetItems returns a collection of items by id. It fails if any of the items do not exist
+func (h Handler) BatchGetItems(ctx context.Context, req *pb.BatchGetItemsRequest) (*pb.BatchGetItemsResponse, error) {
+	ids, err := parseBatchIDs(req.GetIds())
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := h.Cache.GetMany(ctx, ids)
+	if err != nil {
+		return nil, toStatus(err, "fetching items")
+	}
+
+	byID := make(map[int]models.Item, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+
+	res := &pb.BatchGetItemsResponse{}
+	var missing []int
+	for _, id := range ids {
+		item, ok := byID[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
 		}
+
+		res.Items = append(res.Items, models.Itop(item))
 	}
 
-	return nil
+	if len(missing) > 0 {
+		return nil, itemsNotFound(missing...)
+	}
+
+	return res, nil
+}
+
+// BatchGetScoreHistory returns the recorded scores of a collection of items. Histories are read from
+// the database as they change too often to be worth caching
+func (h Handler) BatchGetScoreHistory(ctx context.Context, req *pb.BatchGetScoreHistoryRequest) (*pb.BatchGetScoreHistoryResponse, error) {
+	ids, err := parseBatchIDs(req.GetIds())
+	if err != nil {
+		return nil, err
+	}
+
+	limit := int(req.GetMaxSamples())
+	switch {
+	case limit < 0:
+		return nil, invalidArgument("max_samples", "must not be negative")
+	case limit == 0:
+		limit = defaultScoreSamples
+	case limit > maxScoreSamples:
+		limit = maxScoreSamples
+	}
+
+	var since time.Time
+	if req.GetRecordedAfter() != 0 {
+		since = time.Unix(req.GetRecordedAfter(), 0).UTC()
+	}
+
+	histories, err := h.DB.ScoreHistories(ctx, ids, since, limit)
+	if err != nil {
+		return nil, toStatus(err, "fetching score histories")
+	}
+
+	res := &pb.BatchGetScoreHistoryResponse{Histories: make([]*pb.ScoreHistory, len(ids))}
+	for i, id := range ids {
+		history := &pb.ScoreHistory{ItemId: int32(id)}
+		for _, sample := range histories[id] {
+			history.Samples = append(history.Samples, &pb.ScoreSample{
+				Score:      int32(sample.Score),
+				RecordedAt: sample.RecordedAt.Unix(),
+			})
+		}
+
+		res.Histories[i] = history
+	}
+
+	return res, nil
+}
+
+// parseBatchIDs validates the ids of a batch request, dropping duplicates but keeping the order
+func parseBatchIDs(reqIDs []int32) ([]int, error) {
+	if len(reqIDs) == 0 {
+		return nil, invalidArgument("ids", "must not be empty")
+	}
+
+	if len(reqIDs) > maxBatchGetSize {
+		return nil, invalidArgument("ids", fmt.Sprintf("at most %d ids can be requested at once", maxBatchGetSize))
+	}
+
+	var ids []int
+	seen := map[int]bool{}
+	for _, id := range reqIDs {
+		if id <= 0 {
+			return nil, invalidArgument("ids", "must be positive")
+		}
+
+		if !seen[int(id)] {
+			seen[int(id)] = true
+			ids = append(ids, int(id))
+		}
+	}
+
+	return ids, nil
+}
+
+// SearchItems returns a page of items matching a full-text search
+func (h Handler) SearchItems(ctx context.Context, req *pb.SearchItemsRequest) (*pb.SearchItemsResponse, error) {
+	q, err := parseSearchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch an extra result to find out whether there is another page
+	pageSize := q.Limit
+	q.Limit++
+
+	results, err := h.Cache.Search(ctx, q)
+	if err != nil {
+		return nil, toStatus(err, "searching items")
+	}
+
+	res := &pb.SearchItemsResponse{}
+	if len(results) > pageSize {
+		results = results[:pageSize]
+		res.NextPageToken = encodeSearchPageToken(q.Offset + pageSize)
+	}
+
+	for _, r := range results {
+		res.Results = append(res.Results, &pb.SearchResult{
+			Item:    models.Itop(r.Item),
+			Snippet: r.Snippet,
+			Rank:    r.Rank,
+		})
+	}
+
+	return res, nil
 }
@@ -0,0 +1,382 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGetItem(t *testing.T) {
+	type testcase struct {
+		name         string
+		cache        *Mock
+		id           int32
+		expectMocks  func(t *testing.T, cache *Mock)
+		expectedCode codes.Code
+	}
+
+	tests := []testcase{
+		{
+			name:  "existing item",
+			cache: &Mock{},
+			id:    1,
+			expectMocks: func(t *testing.T, cache *Mock) {
+				cache.On("Get", context.TODO(), 1).Return(models.Item{ID: 1}, nil)
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name:  "missing item",
+			cache: &Mock{},
+			id:    2,
+			expectMocks: func(t *testing.T, cache *Mock) {
+				cache.On("Get", context.TODO(), 2).Return(nil, database.ErrNotFound)
+			},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "invalid id",
+			cache:        &Mock{},
+			id:           0,
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expectMocks != nil {
+				tt.expectMocks(t, tt.cache)
+			}
+
+			h := Handler{Cache: tt.cache}
+			item, err := h.GetItem(context.TODO(), &pb.GetItemRequest{Id: tt.id})
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			if tt.expectedCode == codes.OK {
+				assert.Equal(t, tt.id, item.Id)
+			}
+			tt.cache.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBatchGetItems(t *testing.T) {
+	type testcase struct {
+		name          string
+		cache         *Mock
+		ids           []int32
+		expectMocks   func(t *testing.T, cache *Mock)
+		expectedCode  codes.Code
+		expectedItems []int32
+	}
+
+	tests := []testcase{
+		{
+			name:  "keeps request order and drops duplicates",
+			cache: &Mock{},
+			ids:   []int32{3, 1, 3},
+			expectMocks: func(t *testing.T, cache *Mock) {
+				cache.On("GetMany", context.TODO(), []int{3, 1}).Return([]models.Item{{ID: 1}, {ID: 3}}, nil)
+			},
+			expectedCode:  codes.OK,
+			expectedItems: []int32{3, 1},
+		},
+		{
+			name:  "missing item",
+			cache: &Mock{},
+			ids:   []int32{1, 2},
+			expectMocks: func(t *testing.T, cache *Mock) {
+				cache.On("GetMany", context.TODO(), []int{1, 2}).Return([]models.Item{{ID: 1}}, nil)
+			},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "no ids",
+			cache:        &Mock{},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "too many ids",
+			cache:        &Mock{},
+			ids:          make([]int32, maxBatchGetSize+1),
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expectMocks != nil {
+				tt.expectMocks(t, tt.cache)
+			}
+
+			h := Handler{Cache: tt.cache}
+			res, err := h.BatchGetItems(context.TODO(), &pb.BatchGetItemsRequest{Ids: tt.ids})
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			if tt.expectedCode == codes.OK {
+				ids := []int32{}
+				for _, item := range res.Items {
+					ids = append(ids, item.Id)
+				}
+				assert.Equal(t, tt.expectedItems, ids)
+			}
+			tt.cache.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBatchGetScoreHistory(t *testing.T) {
+	recordedAt := time.Unix(1633046400, 0)
+
+	type testcase struct {
+		name              string
+		req               *pb.BatchGetScoreHistoryRequest
+		expectMocks       func(t *testing.T, db *database.Mock)
+		expectedCode      codes.Code
+		expectedHistories []*pb.ScoreHistory
+	}
+
+	tests := []testcase{
+		{
+			name: "keeps request order and includes items without history",
+			req:  &pb.BatchGetScoreHistoryRequest{Ids: []int32{3, 1, 3}},
+			expectMocks: func(t *testing.T, db *database.Mock) {
+				db.On("ScoreHistories", context.TODO(), []int{3, 1}, time.Time{}, defaultScoreSamples).Return(map[int][]models.ScoreSample{
+					3: {{Score: 1, RecordedAt: recordedAt}, {Score: 5, RecordedAt: recordedAt.Add(time.Hour)}},
+				}, nil)
+			},
+			expectedCode: codes.OK,
+			expectedHistories: []*pb.ScoreHistory{
+				{ItemId: 3, Samples: []*pb.ScoreSample{
+					{Score: 1, RecordedAt: 1633046400},
+					{Score: 5, RecordedAt: 1633050000},
+				}},
+				{ItemId: 1},
+			},
+		},
+		{
+			name: "passes the recorded after time and sample limit",
+			req:  &pb.BatchGetScoreHistoryRequest{Ids: []int32{1}, RecordedAfter: 1633046400, MaxSamples: 10},
+			expectMocks: func(t *testing.T, db *database.Mock) {
+				db.On("ScoreHistories", context.TODO(), []int{1}, recordedAt.UTC(), 10).Return(nil, nil)
+			},
+			expectedCode:      codes.OK,
+			expectedHistories: []*pb.ScoreHistory{{ItemId: 1}},
+		},
+		{
+			name: "caps the sample limit",
+			req:  &pb.BatchGetScoreHistoryRequest{Ids: []int32{1}, MaxSamples: 5000},
+			expectMocks: func(t *testing.T, db *database.Mock) {
+				db.On("ScoreHistories", context.TODO(), []int{1}, time.Time{}, maxScoreSamples).Return(nil, nil)
+			},
+			expectedCode:      codes.OK,
+			expectedHistories: []*pb.ScoreHistory{{ItemId: 1}},
+		},
+		{
+			name:         "negative sample limit",
+			req:          &pb.BatchGetScoreHistoryRequest{Ids: []int32{1}, MaxSamples: -1},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "database failure",
+			req:  &pb.BatchGetScoreHistoryRequest{Ids: []int32{1}},
+			expectMocks: func(t *testing.T, db *database.Mock) {
+				db.On("ScoreHistories", context.TODO(), []int{1}, time.Time{}, defaultScoreSamples).Return(nil, errors.New("disk full"))
+			},
+			expectedCode: codes.Internal,
+		},
+		{
+			name:         "no ids",
+			req:          &pb.BatchGetScoreHistoryRequest{},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "invalid id",
+			req:          &pb.BatchGetScoreHistoryRequest{Ids: []int32{1, -1}},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &database.Mock{}
+			if tt.expectMocks != nil {
+				tt.expectMocks(t, db)
+			}
+
+			h := Handler{DB: db}
+			res, err := h.BatchGetScoreHistory(context.TODO(), tt.req)
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			if tt.expectedCode == codes.OK {
+				assert.True(t, proto.Equal(&pb.BatchGetScoreHistoryResponse{Histories: tt.expectedHistories}, res))
+			}
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSearchItems(t *testing.T) {
+	type testcase struct {
+		name              string
+		cache             *Mock
+		req               *pb.SearchItemsRequest
+		expectMocks       func(t *testing.T, cache *Mock)
+		expectedCode      codes.Code
+		expectedResults   int
+		expectedNextToken string
+	}
+
+	tests := []testcase{
+		{
+			name:  "last page",
+			cache: &Mock{},
+			req:   &pb.SearchItemsRequest{Query: "compiler", PageSize: 2},
+			expectMocks: func(t *testing.T, cache *Mock) {
+				cache.On("Search", context.TODO(), database.SearchQuery{Text: "compiler", Limit: 3, TopLevel: true}).
+					Return([]models.SearchResult{{Item: models.Item{ID: 1}}, {Item: models.Item{ID: 2}}}, nil)
+			},
+			expectedCode:    codes.OK,
+			expectedResults: 2,
+		},
+		{
+			name:  "more pages",
+			cache: &Mock{},
+			req:   &pb.SearchItemsRequest{Query: "compiler", PageSize: 2, PageToken: encodeSearchPageToken(2)},
+			expectMocks: func(t *testing.T, cache *Mock) {
+				cache.On("Search", context.TODO(), database.SearchQuery{Text: "compiler", Limit: 3, Offset: 2, TopLevel: true}).
+					Return([]models.SearchResult{{Item: models.Item{ID: 3}}, {Item: models.Item{ID: 4}}, {Item: models.Item{ID: 5}}}, nil)
+			},
+			expectedCode:      codes.OK,
+			expectedResults:   2,
+			expectedNextToken: encodeSearchPageToken(4),
+		},
+		{
+			name:         "empty query",
+			cache:        &Mock{},
+			req:          &pb.SearchItemsRequest{Query: "  "},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expectMocks != nil {
+				tt.expectMocks(t, tt.cache)
+			}
+
+			h := Handler{Cache: tt.cache}
+			res, err := h.SearchItems(context.TODO(), tt.req)
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			if tt.expectedCode == codes.OK {
+				assert.Equal(t, tt.expectedResults, len(res.Results))
+				assert.Equal(t, tt.expectedNextToken, res.NextPageToken)
+			}
+			tt.cache.AssertExpectations(t)
+		})
+	}
+}
+
+type stubListServer struct {
+	grpc.ServerStream
+	sent    []*pb.Item
+	trailer metadata.MD
+}
+
+func (s *stubListServer) Context() context.Context {
+	return context.TODO()
+}
+
+func (s *stubListServer) Send(item *pb.Item) error {
+	s.sent = append(s.sent, item)
+	return nil
+}
+
+func (s *stubListServer) SetTrailer(md metadata.MD) {
+	s.trailer = md
+}
+
+func TestListAll(t *testing.T) {
+	items := func(ids ...int) []models.Item {
+		var items []models.Item
+		for _, id := range ids {
+			items = append(items, models.Item{ID: id})
+		}
+		return items
+	}
+
+	type testcase struct {
+		name          string
+		cache         *Mock
+		db            *database.Mock
+		req           *pb.ListItemsRequest
+		expectMocks   func(t *testing.T, cache *Mock, db *database.Mock)
+		expectedItems int
+		expectNext    bool
+	}
+
+	tests := []testcase{
+		{
+			name:  "cached last page",
+			cache: &Mock{},
+			db:    &database.Mock{},
+			req:   &pb.ListItemsRequest{PageSize: 2},
+			expectMocks: func(t *testing.T, cache *Mock, db *database.Mock) {
+				cache.On("List", context.TODO(), database.ListQuery{Limit: 3, TopLevel: true}).Return(items(1, 2), nil)
+			},
+			expectedItems: 2,
+		},
+		{
+			name:  "cached page with more to come",
+			cache: &Mock{},
+			db:    &database.Mock{},
+			req:   &pb.ListItemsRequest{PageSize: 2},
+			expectMocks: func(t *testing.T, cache *Mock, db *database.Mock) {
+				cache.On("List", context.TODO(), database.ListQuery{Limit: 3, TopLevel: true}).Return(items(1, 2, 3), nil)
+			},
+			expectedItems: 2,
+			expectNext:    true,
+		},
+		{
+			name:  "large page streamed from the database",
+			cache: &Mock{},
+			db:    &database.Mock{},
+			req:   &pb.ListItemsRequest{PageSize: maxCachedPageSize + 1},
+			expectMocks: func(t *testing.T, cache *Mock, db *database.Mock) {
+				db.On("Iterate", context.TODO(), database.ListQuery{Limit: maxCachedPageSize + 2, TopLevel: true}).Return(items(1, 2, 3), nil)
+			},
+			expectedItems: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expectMocks != nil {
+				tt.expectMocks(t, tt.cache, tt.db)
+			}
+
+			h := Handler{Cache: tt.cache, DB: tt.db}
+			s := &stubListServer{}
+
+			err := h.ListAll(tt.req, s)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedItems, len(s.sent))
+			assert.Equal(t, tt.expectNext, len(s.trailer.Get(NextPageTokenKey)) > 0)
+			tt.cache.AssertExpectations(t)
+			tt.db.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"expvar"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDKey is the metadata key a request id is read from and returned in
+const RequestIDKey = "x-request-id"
+
+// maxRequestIDLength bounds incoming request ids, which are copied into logs and response headers
+const maxRequestIDLength = 128
+
+// Interceptor pairs the unary and stream forms of a server middleware
+type Interceptor struct {
+	Unary  grpc.UnaryServerInterceptor
+	Stream grpc.StreamServerInterceptor
+}
+
+type requestIDContextKey struct{}
+
+// RequestIDFromContext returns the id of the request being handled, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// wrappedStream overrides the context of a server stream
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *wrappedStream) Context() context.Context {
+	return s.ctx
+}
+
+// RequestID reads the request id from the incoming metadata, or generates one when it's missing or
+// invalid, stores it in the context and returns it in the response headers
+func RequestID() Interceptor {
+	withID := func(ctx context.Context) (context.Context, string) {
+		var id string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(RequestIDKey); len(values) > 0 {
+				id = values[0]
+			}
+		}
+
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		return context.WithValue(ctx, requestIDContextKey{}, id), id
+	}
+
+	return Interceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, id := withID(ctx)
+			_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, id))
+
+			return handler(ctx, req)
+		},
+		Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, id := withID(ss.Context())
+			_ = ss.SetHeader(metadata.Pairs(RequestIDKey, id))
+
+			return handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+		},
+	}
+}
+
+// validRequestID reports whether id is at most maxRequestIDLength letters, digits, '-', '_' or '.'
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// Logging writes a structured log line for every call once it completes
+func Logging(logger *zap.Logger) Interceptor {
+	log := func(ctx context.Context, method string, start time.Time, err error) {
+		code := status.Code(err)
+
+		fields := []zap.Field{
+			zap.String("method", method),
+			zap.String("code", code.String()),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("request_id", RequestIDFromContext(ctx)),
+		}
+		if p, ok := peer.FromContext(ctx); ok {
+			fields = append(fields, zap.String("peer", p.Addr.String()))
+		}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		}
+
+		logger.Check(logLevel(code), "handled call").Write(fields...)
+	}
+
+	return Interceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			start := time.Now()
+			res, err := handler(ctx, req)
+			log(ctx, info.FullMethod, start, err)
+
+			return res, err
+		},
+		Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			err := handler(srv, ss)
+			log(ss.Context(), info.FullMethod, start, err)
+
+			return err
+		},
+	}
+}
+
+// logLevel logs server faults as errors and everything else as info
+func logLevel(code codes.Code) zapcore.Level {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unavailable, codes.Unimplemented:
+		return zapcore.ErrorLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
+
+// Recovery turns a panicking handler into a codes.Internal error instead of crashing the process. It
+// should be the outermost interceptor so panics in the other interceptors are recovered too
+func Recovery(logger *zap.Logger) Interceptor {
+	recovered := func(ctx context.Context, method string, r interface{}) error {
+		logger.Error(
+			"recovered from panic",
+			zap.String("method", method),
+			zap.String("request_id", RequestIDFromContext(ctx)),
+			zap.Any("panic", r),
+			zap.Stack("stack"),
+		)
+
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	return Interceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = recovered(ctx, info.FullMethod, r)
+				}
+			}()
+
+			return handler(ctx, req)
+		},
+		Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = recovered(ss.Context(), info.FullMethod, r)
+				}
+			}()
+
+			return handler(srv, ss)
+		},
+	}
+}
+
+// Metrics counts calls, errors and total latency in milliseconds per method into m
+func Metrics(m *expvar.Map) Interceptor {
+	record := func(method string, start time.Time, err error) {
+		m.Add(method+".calls", 1)
+		m.Add(method+".duration_ms", time.Since(start).Milliseconds())
+		if err != nil {
+			m.Add(method+".errors", 1)
+		}
+	}
+
+	return Interceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			start := time.Now()
+			res, err := handler(ctx, req)
+			record(info.FullMethod, start, err)
+
+			return res, err
+		},
+		Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			err := handler(srv, ss)
+			record(info.FullMethod, start, err)
+
+			return err
+		},
+	}
+}
+
+// Deadline applies a default deadline to calls that arrive without one. Client deadlines shorter than
+// the default are kept. Long lived streams, such as watches, can be exempted by full method name
+func Deadline(timeout time.Duration, exempt ...string) Interceptor {
+	skip := make(map[string]bool, len(exempt))
+	for _, method := range exempt {
+		skip[method] = true
+	}
+
+	withDeadline := func(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+		if _, ok := ctx.Deadline(); ok || skip[method] {
+			return ctx, func() {}
+		}
+
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	return Interceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, cancel := withDeadline(ctx, info.FullMethod)
+			defer cancel()
+
+			return handler(ctx, req)
+		},
+		Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, cancel := withDeadline(ss.Context(), info.FullMethod)
+			defer cancel()
+
+			return handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+		},
+	}
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"expvar"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// funcServer handles GetItem and WatchItems with the given functions
+type funcServer struct {
+	pb.UnimplementedAPIServer
+	getItem    func(ctx context.Context) (*pb.Item, error)
+	watchItems func(ctx context.Context) error
+}
+
+func (s funcServer) GetItem(ctx context.Context, req *pb.GetItemRequest) (*pb.Item, error) {
+	return s.getItem(ctx)
+}
+
+func (s funcServer) WatchItems(req *pb.WatchItemsRequest, stream pb.API_WatchItemsServer) error {
+	return s.watchItems(stream.Context())
+}
+
+func TestInterceptors(t *testing.T) {
+	type testcase struct {
+		name         string
+		interceptors []Interceptor
+		getItem      func(ctx context.Context) (*pb.Item, error)
+		requestID    string
+		check        func(t *testing.T, header metadata.MD, err error)
+	}
+
+	tests := []testcase{
+		{
+			name:         "recovers from panics",
+			interceptors: []Interceptor{Logging(zap.NewNop()), Recovery(zap.NewNop())},
+			getItem: func(ctx context.Context) (*pb.Item, error) {
+				panic("boom")
+			},
+			check: func(t *testing.T, header metadata.MD, err error) {
+				assert.Equal(t, codes.Internal, status.Code(err))
+			},
+		},
+		{
+			name: "recovers from panics in other interceptors",
+			interceptors: []Interceptor{
+				Recovery(zap.NewNop()),
+				{
+					Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+						panic("boom")
+					},
+				},
+			},
+			getItem: func(ctx context.Context) (*pb.Item, error) {
+				return &pb.Item{}, nil
+			},
+			check: func(t *testing.T, header metadata.MD, err error) {
+				assert.Equal(t, codes.Internal, status.Code(err))
+			},
+		},
+		{
+			name:         "propagates the incoming request id",
+			interceptors: []Interceptor{RequestID()},
+			requestID:    "abc123",
+			getItem: func(ctx context.Context) (*pb.Item, error) {
+				if RequestIDFromContext(ctx) != "abc123" {
+					return nil, status.Error(codes.FailedPrecondition, "missing request id")
+				}
+
+				return &pb.Item{}, nil
+			},
+			check: func(t *testing.T, header metadata.MD, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"abc123"}, header.Get(RequestIDKey))
+			},
+		},
+		{
+			name:         "replaces a request id with invalid characters",
+			interceptors: []Interceptor{RequestID()},
+			requestID:    "abc 123\"}",
+			getItem: func(ctx context.Context) (*pb.Item, error) {
+				return &pb.Item{}, nil
+			},
+			check: func(t *testing.T, header metadata.MD, err error) {
+				require.NoError(t, err)
+				require.Len(t, header.Get(RequestIDKey), 1)
+				assert.NotEqual(t, "abc 123\"}", header.Get(RequestIDKey)[0])
+				assert.NotEmpty(t, header.Get(RequestIDKey)[0])
+			},
+		},
+		{
+			name:         "replaces a request id that is too long",
+			interceptors: []Interceptor{RequestID()},
+			requestID:    strings.Repeat("a", maxRequestIDLength+1),
+			getItem: func(ctx context.Context) (*pb.Item, error) {
+				return &pb.Item{}, nil
+			},
+			check: func(t *testing.T, header metadata.MD, err error) {
+				require.NoError(t, err)
+				require.Len(t, header.Get(RequestIDKey), 1)
+				assert.Len(t, header.Get(RequestIDKey)[0], 32)
+			},
+		},
+		{
+			name:         "generates a request id",
+			interceptors: []Interceptor{RequestID()},
+			getItem: func(ctx context.Context) (*pb.Item, error) {
+				return &pb.Item{}, nil
+			},
+			check: func(t *testing.T, header metadata.MD, err error) {
+				require.NoError(t, err)
+				require.Len(t, header.Get(RequestIDKey), 1)
+				assert.NotEmpty(t, header.Get(RequestIDKey)[0])
+			},
+		},
+		{
+			name:         "applies a default deadline",
+			interceptors: []Interceptor{Deadline(time.Minute)},
+			getItem: func(ctx context.Context) (*pb.Item, error) {
+				if _, ok := ctx.Deadline(); !ok {
+					return nil, status.Error(codes.FailedPrecondition, "missing deadline")
+				}
+
+				return &pb.Item{}, nil
+			},
+			check: func(t *testing.T, header metadata.MD, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name:         "exempt methods have no deadline",
+			interceptors: []Interceptor{Deadline(time.Minute, "/api.API/GetItem")},
+			getItem: func(ctx context.Context) (*pb.Item, error) {
+				if _, ok := ctx.Deadline(); ok {
+					return nil, status.Error(codes.FailedPrecondition, "unexpected deadline")
+				}
+
+				return &pb.Item{}, nil
+			},
+			check: func(t *testing.T, header metadata.MD, err error) {
+				assert.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			srv := funcServer{getItem: tc.getItem}
+			conn, _ := serve(ctx, t, NewServer(0, zap.NewNop(), srv, WithInterceptors(tc.interceptors...)))
+
+			callCtx := context.Background()
+			if tc.requestID != "" {
+				callCtx = metadata.AppendToOutgoingContext(callCtx, RequestIDKey, tc.requestID)
+			}
+
+			var header metadata.MD
+			_, err := pb.NewAPIClient(conn).GetItem(callCtx, &pb.GetItemRequest{Id: 1}, grpc.Header(&header))
+
+			tc.check(t, header, err)
+		})
+	}
+}
+
+func TestStreamInterceptors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	metrics := new(expvar.Map).Init()
+	srv := funcServer{
+		watchItems: func(ctx context.Context) error {
+			if RequestIDFromContext(ctx) == "" {
+				return status.Error(codes.FailedPrecondition, "missing request id")
+			}
+
+			panic("boom")
+		},
+	}
+
+	conn, _ := serve(ctx, t, NewServer(0, zap.NewNop(), srv, WithInterceptors(
+		RequestID(),
+		Metrics(metrics),
+		Recovery(zap.NewNop()),
+	)))
+
+	stream, err := pb.NewAPIClient(conn).WatchItems(context.Background(), &pb.WatchItemsRequest{})
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	assert.Equal(t, "1", metrics.Get("/api.API/WatchItems.calls").String())
+	assert.Equal(t, "1", metrics.Get("/api.API/WatchItems.errors").String())
+}
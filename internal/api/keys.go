@@ -0,0 +1,72 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/database"
+)
+
+// defaultNamespace is the cache namespace used unless one is configured. Changing the namespace on
+// deploy makes every previously cached key unreachable so they expire on their own
+const defaultNamespace = "v3"
+
+// keys builds deterministic cache keys within a versioned namespace
+type keys struct {
+	namespace string
+}
+
+// item is the key of a single cached item
+func (k keys) item(id int) string {
+	return fmt.Sprintf("items:%s:id:%d", k.namespace, id)
+}
+
+// list is the key of the ids matching a list query. Equivalent queries share a key
+func (k keys) list(q database.ListQuery) string {
+	key := fmt.Sprintf(
+		"items:%s:list:type=%s:top_level=%t:author=%s:min_score=%d:after=%d:before=%d:sort=%d:limit=%d",
+		k.namespace,
+		q.Type,
+		q.TopLevel,
+		q.Author,
+		q.MinScore,
+		unixOrZero(q.CreatedAfter),
+		unixOrZero(q.CreatedBefore),
+		q.Sort,
+		q.Limit,
+	)
+
+	if q.After != nil {
+		key += fmt.Sprintf(":cursor=%d,%d,%d", q.After.ID, q.After.Score, q.After.CreatedAt.UnixNano())
+	}
+
+	return key
+}
+
+// search is the key of the results of a search query. The text is case and whitespace insensitive
+// to match how postgres parses it, and is hashed to keep keys short
+func (k keys) search(q database.SearchQuery) string {
+	text := strings.Join(strings.Fields(strings.ToLower(q.Text)), " ")
+	sum := sha1.Sum([]byte(text))
+
+	return fmt.Sprintf(
+		"items:%s:search:type=%s:top_level=%t:limit=%d:offset=%d:text=%s",
+		k.namespace, q.Type, q.TopLevel, q.Limit, q.Offset, hex.EncodeToString(sum[:]),
+	)
+}
+
+// queries is the key of the set tracking every cached list and search key
+func (k keys) queries() string {
+	return fmt.Sprintf("items:%s:query-keys", k.namespace)
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
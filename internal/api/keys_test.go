@@ -0,0 +1,122 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListKey(t *testing.T) {
+	k := keys{namespace: "v1"}
+	createdAt := time.Unix(1634567890, 0)
+
+	type testcase struct {
+		name  string
+		a     database.ListQuery
+		b     database.ListQuery
+		equal bool
+	}
+
+	tests := []testcase{
+		{
+			name:  "identical queries",
+			a:     database.ListQuery{Type: "story", Limit: 10},
+			b:     database.ListQuery{Type: "story", Limit: 10},
+			equal: true,
+		},
+		{
+			// authors are trimmed when requests are parsed, queries filtering on different authors can't share a key
+			name: "author whitespace is significant",
+			a:    database.ListQuery{Author: "shark boi", Limit: 10},
+			b:    database.ListQuery{Author: " shark boi ", Limit: 10},
+		},
+		{
+			name:  "same instant in different zones",
+			a:     database.ListQuery{CreatedAfter: createdAt.UTC(), Limit: 10},
+			b:     database.ListQuery{CreatedAfter: createdAt.In(time.FixedZone("BST", 3600)), Limit: 10},
+			equal: true,
+		},
+		{
+			name: "different filters",
+			a:    database.ListQuery{Type: "story", Limit: 10},
+			b:    database.ListQuery{Type: "job", Limit: 10},
+		},
+		{
+			name: "top level and every type",
+			a:    database.ListQuery{Limit: 10, TopLevel: true},
+			b:    database.ListQuery{Limit: 10},
+		},
+		{
+			name: "different cursors",
+			a:    database.ListQuery{Limit: 10, After: &database.Cursor{ID: 1, CreatedAt: createdAt}},
+			b:    database.ListQuery{Limit: 10, After: &database.Cursor{ID: 2, CreatedAt: createdAt}},
+		},
+		{
+			name: "cursor and no cursor",
+			a:    database.ListQuery{Limit: 10},
+			b:    database.ListQuery{Limit: 10, After: &database.Cursor{ID: 1, CreatedAt: createdAt}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.equal {
+				assert.Equal(t, k.list(tc.a), k.list(tc.b))
+			} else {
+				assert.NotEqual(t, k.list(tc.a), k.list(tc.b))
+			}
+		})
+	}
+}
+
+func TestSearchKey(t *testing.T) {
+	k := keys{namespace: "v1"}
+
+	type testcase struct {
+		name  string
+		a     database.SearchQuery
+		b     database.SearchQuery
+		equal bool
+	}
+
+	tests := []testcase{
+		{
+			name:  "case and whitespace are ignored",
+			a:     database.SearchQuery{Text: "Go  Generics", Limit: 20},
+			b:     database.SearchQuery{Text: " go generics", Limit: 20},
+			equal: true,
+		},
+		{
+			name: "different text",
+			a:    database.SearchQuery{Text: "go", Limit: 20},
+			b:    database.SearchQuery{Text: "rust", Limit: 20},
+		},
+		{
+			name: "different page",
+			a:    database.SearchQuery{Text: "go", Limit: 20},
+			b:    database.SearchQuery{Text: "go", Limit: 20, Offset: 20},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.equal {
+				assert.Equal(t, k.search(tc.a), k.search(tc.b))
+			} else {
+				assert.NotEqual(t, k.search(tc.a), k.search(tc.b))
+			}
+		})
+	}
+}
+
+func TestKeysNamespace(t *testing.T) {
+	v1 := keys{namespace: "v1"}
+	v2 := keys{namespace: "v2"}
+
+	assert.NotEqual(t, v1.item(1), v2.item(1))
+	assert.NotEqual(t, v1.list(database.ListQuery{}), v2.list(database.ListQuery{}))
+	assert.NotEqual(t, v1.search(database.SearchQuery{}), v2.search(database.SearchQuery{}))
+	assert.NotEqual(t, v1.queries(), v2.queries())
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+
+	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type Mock struct {
+	mock.Mock
+}
+
+func (m *Mock) List(ctx context.Context, q database.ListQuery) ([]models.Item, error) {
+	args := m.Called(ctx, q)
+
+	itemsArg, ok := args.Get(0).([]models.Item)
+	if !ok {
+		return nil, args.Error(1)
+	}
+
+	return itemsArg, args.Error(1)
+}
+
+func (m *Mock) Get(ctx context.Context, id int) (models.Item, error) {
+	args := m.Called(ctx, id)
+
+	itemArg, ok := args.Get(0).(models.Item)
+	if !ok {
+		return models.Item{}, args.Error(1)
+	}
+
+	return itemArg, args.Error(1)
+}
+
+func (m *Mock) GetMany(ctx context.Context, ids []int) ([]models.Item, error) {
+	args := m.Called(ctx, ids)
+
+	itemsArg, ok := args.Get(0).([]models.Item)
+	if !ok {
+		return nil, args.Error(1)
+	}
+
+	return itemsArg, args.Error(1)
+}
+
+func (m *Mock) Search(ctx context.Context, q database.SearchQuery) ([]models.SearchResult, error) {
+	args := m.Called(ctx, q)
+
+	resultsArg, ok := args.Get(0).([]models.SearchResult)
+	if !ok {
+		return nil, args.Error(1)
+	}
+
+	return resultsArg, args.Error(1)
+}
@@ -7,7 +7,6 @@ import (
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
-	emptypb "google.golang.org/protobuf/types/known/emptypb"
 )
 
 // This is a compile-time assertion to ensure that this generated file
@@ -19,9 +18,23 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type APIClient interface {
-	ListAll(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (API_ListAllClient, error)
-	ListStories(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (API_ListStoriesClient, error)
-	ListJobs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (API_ListJobsClient, error)
+	// List RPCs stream a single page of items. When more items are available the
+	// token for the next page is sent in the "next-page-token" trailer
+	ListAll(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (API_ListAllClient, error)
+	ListStories(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (API_ListStoriesClient, error)
+	ListJobs(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (API_ListJobsClient, error)
+	// GetItem returns a NOT_FOUND status when the item does not exist
+	GetItem(ctx context.Context, in *GetItemRequest, opts ...grpc.CallOption) (*Item, error)
+	// BatchGetItems returns a NOT_FOUND status when any of the items do not exist
+	BatchGetItems(ctx context.Context, in *BatchGetItemsRequest, opts ...grpc.CallOption) (*BatchGetItemsResponse, error)
+	// BatchGetScoreHistory returns the scores recorded for each item, oldest first. Items that do
+	// not exist have an empty history
+	BatchGetScoreHistory(ctx context.Context, in *BatchGetScoreHistoryRequest, opts ...grpc.CallOption) (*BatchGetScoreHistoryResponse, error)
+	// SearchItems performs a full-text search over item titles and content
+	SearchItems(ctx context.Context, in *SearchItemsRequest, opts ...grpc.CallOption) (*SearchItemsResponse, error)
+	// WatchItems streams changes to items as they are stored. Heartbeats are sent while there
+	// are no matching changes so clients can detect dead connections
+	WatchItems(ctx context.Context, in *WatchItemsRequest, opts ...grpc.CallOption) (API_WatchItemsClient, error)
 }
 
 type aPIClient struct {
@@ -32,7 +45,7 @@ func NewAPIClient(cc grpc.ClientConnInterface) APIClient {
 	return &aPIClient{cc}
 }
 
-func (c *aPIClient) ListAll(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (API_ListAllClient, error) {
+func (c *aPIClient) ListAll(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (API_ListAllClient, error) {
 	stream, err := c.cc.NewStream(ctx, &API_ServiceDesc.Streams[0], "/api.API/ListAll", opts...)
 	if err != nil {
 		return nil, err
@@ -64,7 +77,7 @@ func (x *aPIListAllClient) Recv() (*Item, error) {
 	return m, nil
 }
 
-func (c *aPIClient) ListStories(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (API_ListStoriesClient, error) {
+func (c *aPIClient) ListStories(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (API_ListStoriesClient, error) {
 	stream, err := c.cc.NewStream(ctx, &API_ServiceDesc.Streams[1], "/api.API/ListStories", opts...)
 	if err != nil {
 		return nil, err
@@ -96,7 +109,7 @@ func (x *aPIListStoriesClient) Recv() (*Item, error) {
 	return m, nil
 }
 
-func (c *aPIClient) ListJobs(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (API_ListJobsClient, error) {
+func (c *aPIClient) ListJobs(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (API_ListJobsClient, error) {
 	stream, err := c.cc.NewStream(ctx, &API_ServiceDesc.Streams[2], "/api.API/ListJobs", opts...)
 	if err != nil {
 		return nil, err
@@ -128,13 +141,95 @@ func (x *aPIListJobsClient) Recv() (*Item, error) {
 	return m, nil
 }
 
+func (c *aPIClient) GetItem(ctx context.Context, in *GetItemRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, "/api.API/GetItem", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIClient) BatchGetItems(ctx context.Context, in *BatchGetItemsRequest, opts ...grpc.CallOption) (*BatchGetItemsResponse, error) {
+	out := new(BatchGetItemsResponse)
+	err := c.cc.Invoke(ctx, "/api.API/BatchGetItems", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIClient) BatchGetScoreHistory(ctx context.Context, in *BatchGetScoreHistoryRequest, opts ...grpc.CallOption) (*BatchGetScoreHistoryResponse, error) {
+	out := new(BatchGetScoreHistoryResponse)
+	err := c.cc.Invoke(ctx, "/api.API/BatchGetScoreHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIClient) SearchItems(ctx context.Context, in *SearchItemsRequest, opts ...grpc.CallOption) (*SearchItemsResponse, error) {
+	out := new(SearchItemsResponse)
+	err := c.cc.Invoke(ctx, "/api.API/SearchItems", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIClient) WatchItems(ctx context.Context, in *WatchItemsRequest, opts ...grpc.CallOption) (API_WatchItemsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &API_ServiceDesc.Streams[3], "/api.API/WatchItems", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &aPIWatchItemsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type API_WatchItemsClient interface {
+	Recv() (*ItemEvent, error)
+	grpc.ClientStream
+}
+
+type aPIWatchItemsClient struct {
+	grpc.ClientStream
+}
+
+func (x *aPIWatchItemsClient) Recv() (*ItemEvent, error) {
+	m := new(ItemEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // APIServer is the server API for API service.
 // All implementations must embed UnimplementedAPIServer
 // for forward compatibility
 type APIServer interface {
-	ListAll(*emptypb.Empty, API_ListAllServer) error
-	ListStories(*emptypb.Empty, API_ListStoriesServer) error
-	ListJobs(*emptypb.Empty, API_ListJobsServer) error
+	// List RPCs stream a single page of items. When more items are available the
+	// token for the next page is sent in the "next-page-token" trailer
+	ListAll(*ListItemsRequest, API_ListAllServer) error
+	ListStories(*ListItemsRequest, API_ListStoriesServer) error
+	ListJobs(*ListItemsRequest, API_ListJobsServer) error
+	// GetItem returns a NOT_FOUND status when the item does not exist
+	GetItem(context.Context, *GetItemRequest) (*Item, error)
+	// BatchGetItems returns a NOT_FOUND status when any of the items do not exist
+	BatchGetItems(context.Context, *BatchGetItemsRequest) (*BatchGetItemsResponse, error)
+	// BatchGetScoreHistory returns the scores recorded for each item, oldest first. Items that do
+	// not exist have an empty history
+	BatchGetScoreHistory(context.Context, *BatchGetScoreHistoryRequest) (*BatchGetScoreHistoryResponse, error)
+	// SearchItems performs a full-text search over item titles and content
+	SearchItems(context.Context, *SearchItemsRequest) (*SearchItemsResponse, error)
+	// WatchItems streams changes to items as they are stored. Heartbeats are sent while there
+	// are no matching changes so clients can detect dead connections
+	WatchItems(*WatchItemsRequest, API_WatchItemsServer) error
 	mustEmbedUnimplementedAPIServer()
 }
 
@@ -142,15 +237,30 @@ type APIServer interface {
 type UnimplementedAPIServer struct {
 }
 
-func (UnimplementedAPIServer) ListAll(*emptypb.Empty, API_ListAllServer) error {
+func (UnimplementedAPIServer) ListAll(*ListItemsRequest, API_ListAllServer) error {
 	return status.Errorf(codes.Unimplemented, "method ListAll not implemented")
 }
-func (UnimplementedAPIServer) ListStories(*emptypb.Empty, API_ListStoriesServer) error {
+func (UnimplementedAPIServer) ListStories(*ListItemsRequest, API_ListStoriesServer) error {
 	return status.Errorf(codes.Unimplemented, "method ListStories not implemented")
 }
-func (UnimplementedAPIServer) ListJobs(*emptypb.Empty, API_ListJobsServer) error {
+func (UnimplementedAPIServer) ListJobs(*ListItemsRequest, API_ListJobsServer) error {
 	return status.Errorf(codes.Unimplemented, "method ListJobs not implemented")
 }
+func (UnimplementedAPIServer) GetItem(context.Context, *GetItemRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetItem not implemented")
+}
+func (UnimplementedAPIServer) BatchGetItems(context.Context, *BatchGetItemsRequest) (*BatchGetItemsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetItems not implemented")
+}
+func (UnimplementedAPIServer) BatchGetScoreHistory(context.Context, *BatchGetScoreHistoryRequest) (*BatchGetScoreHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetScoreHistory not implemented")
+}
+func (UnimplementedAPIServer) SearchItems(context.Context, *SearchItemsRequest) (*SearchItemsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchItems not implemented")
+}
+func (UnimplementedAPIServer) WatchItems(*WatchItemsRequest, API_WatchItemsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchItems not implemented")
+}
 func (UnimplementedAPIServer) mustEmbedUnimplementedAPIServer() {}
 
 // UnsafeAPIServer may be embedded to opt out of forward compatibility for this service.
@@ -165,7 +275,7 @@ func RegisterAPIServer(s grpc.ServiceRegistrar, srv APIServer) {
 }
 
 func _API_ListAll_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(emptypb.Empty)
+	m := new(ListItemsRequest)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
@@ -186,7 +296,7 @@ func (x *aPIListAllServer) Send(m *Item) error {
 }
 
 func _API_ListStories_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(emptypb.Empty)
+	m := new(ListItemsRequest)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
@@ -207,7 +317,7 @@ func (x *aPIListStoriesServer) Send(m *Item) error {
 }
 
 func _API_ListJobs_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(emptypb.Empty)
+	m := new(ListItemsRequest)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
@@ -227,13 +337,123 @@ func (x *aPIListJobsServer) Send(m *Item) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _API_GetItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIServer).GetItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.API/GetItem",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIServer).GetItem(ctx, req.(*GetItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _API_BatchGetItems_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIServer).BatchGetItems(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.API/BatchGetItems",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIServer).BatchGetItems(ctx, req.(*BatchGetItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _API_BatchGetScoreHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetScoreHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIServer).BatchGetScoreHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.API/BatchGetScoreHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIServer).BatchGetScoreHistory(ctx, req.(*BatchGetScoreHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _API_SearchItems_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIServer).SearchItems(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.API/SearchItems",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIServer).SearchItems(ctx, req.(*SearchItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _API_WatchItems_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchItemsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(APIServer).WatchItems(m, &aPIWatchItemsServer{stream})
+}
+
+type API_WatchItemsServer interface {
+	Send(*ItemEvent) error
+	grpc.ServerStream
+}
+
+type aPIWatchItemsServer struct {
+	grpc.ServerStream
+}
+
+func (x *aPIWatchItemsServer) Send(m *ItemEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // API_ServiceDesc is the grpc.ServiceDesc for API service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var API_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "api.API",
 	HandlerType: (*APIServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetItem",
+			Handler:    _API_GetItem_Handler,
+		},
+		{
+			MethodName: "BatchGetItems",
+			Handler:    _API_BatchGetItems_Handler,
+		},
+		{
+			MethodName: "BatchGetScoreHistory",
+			Handler:    _API_BatchGetScoreHistory_Handler,
+		},
+		{
+			MethodName: "SearchItems",
+			Handler:    _API_SearchItems_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "ListAll",
@@ -250,6 +470,11 @@ var API_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _API_ListJobs_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchItems",
+			Handler:       _API_WatchItems_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "api.proto",
 }
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+)
+
+const (
+	// NextPageTokenKey is the trailer key list RPCs send the next page token under
+	NextPageTokenKey = "next-page-token"
+
+	defaultPageSize = 50
+	maxPageSize     = 10000
+	// maxCachedPageSize is the largest page that is cached, larger pages are streamed from the database
+	maxCachedPageSize = 500
+
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+// pageToken is the decoded form of the opaque token handed to clients
+type pageToken struct {
+	Sort      database.Sort `json:"s"`
+	ID        int           `json:"i"`
+	Score     int           `json:"sc,omitempty"`
+	CreatedAt int64         `json:"c,omitempty"`
+}
+
+func encodePageToken(sort database.Sort, item models.Item) string {
+	b, _ := json.Marshal(pageToken{
+		Sort:      sort,
+		ID:        item.ID,
+		Score:     item.Score,
+		CreatedAt: item.CreatedAt.UnixNano(),
+	})
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePageToken(token string) (*pageToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var t pageToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// parseListRequest validates a list request and converts it into a database query. itemType is
+// the type implied by the RPC, if any
+func parseListRequest(req *pb.ListItemsRequest, itemType string) (database.ListQuery, error) {
+	// the author is trimmed once here so the cache key and the database filter agree
+	q := database.ListQuery{
+		Type:     req.GetType(),
+		Author:   strings.TrimSpace(req.GetAuthor()),
+		MinScore: int(req.GetMinScore()),
+		Limit:    int(req.GetPageSize()),
+	}
+
+	if itemType != "" {
+		if q.Type != "" && q.Type != itemType {
+			return q, invalidArgument("type", fmt.Sprintf("must be empty or %q", itemType))
+		}
+
+		q.Type = itemType
+	}
+
+	// comments and poll options are stored with their threads but only listed when asked for by type
+	q.TopLevel = q.Type == ""
+
+	switch {
+	case q.Limit < 0:
+		return q, invalidArgument("page_size", "must not be negative")
+	case q.Limit == 0:
+		q.Limit = defaultPageSize
+	case q.Limit > maxPageSize:
+		q.Limit = maxPageSize
+	}
+
+	if req.GetCreatedAfter() != 0 {
+		q.CreatedAfter = time.Unix(req.GetCreatedAfter(), 0).UTC()
+	}
+
+	if req.GetCreatedBefore() != 0 {
+		q.CreatedBefore = time.Unix(req.GetCreatedBefore(), 0).UTC()
+	}
+
+	switch req.GetSort() {
+	case pb.SortOrder_SORT_ORDER_UNSPECIFIED, pb.SortOrder_NEWEST:
+		q.Sort = database.SortNewest
+	case pb.SortOrder_OLDEST:
+		q.Sort = database.SortOldest
+	case pb.SortOrder_TOP:
+		q.Sort = database.SortTop
+	default:
+		return q, invalidArgument("sort", fmt.Sprintf("unknown sort order %d", req.GetSort()))
+	}
+
+	if req.GetPageToken() != "" {
+		t, err := decodePageToken(req.GetPageToken())
+		if err != nil {
+			return q, invalidArgument("page_token", "malformed")
+		}
+
+		if t.Sort != q.Sort {
+			return q, invalidArgument("page_token", "was issued for a different sort order")
+		}
+
+		q.After = &database.Cursor{
+			ID:        t.ID,
+			Score:     t.Score,
+			CreatedAt: time.Unix(0, t.CreatedAt).UTC(),
+		}
+	}
+
+	return q, nil
+}
+
+// searchPageToken is the decoded form of the opaque token handed to search clients. Search results are
+// ranked partly by age so they are paged by offset rather than by keyset
+type searchPageToken struct {
+	Offset int `json:"o"`
+}
+
+func encodeSearchPageToken(offset int) string {
+	b, _ := json.Marshal(searchPageToken{Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parseSearchRequest validates a search request and converts it into a database query
+func parseSearchRequest(req *pb.SearchItemsRequest) (database.SearchQuery, error) {
+	q := database.SearchQuery{
+		Text:  strings.TrimSpace(req.GetQuery()),
+		Type:  req.GetType(),
+		Limit: int(req.GetPageSize()),
+	}
+
+	if q.Text == "" {
+		return q, invalidArgument("query", "must not be empty")
+	}
+
+	// as with lists, replies only match when their type is asked for
+	q.TopLevel = q.Type == ""
+
+	switch {
+	case q.Limit < 0:
+		return q, invalidArgument("page_size", "must not be negative")
+	case q.Limit == 0:
+		q.Limit = defaultSearchPageSize
+	case q.Limit > maxSearchPageSize:
+		q.Limit = maxSearchPageSize
+	}
+
+	if req.GetPageToken() != "" {
+		b, err := base64.RawURLEncoding.DecodeString(req.GetPageToken())
+		if err != nil {
+			return q, invalidArgument("page_token", "malformed")
+		}
+
+		var t searchPageToken
+		if err := json.Unmarshal(b, &t); err != nil || t.Offset < 0 {
+			return q, invalidArgument("page_token", "malformed")
+		}
+
+		q.Offset = t.Offset
+	}
+
+	return q, nil
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseListRequest(t *testing.T) {
+	createdAt := time.Unix(1634567890, 0).UTC()
+	topToken := encodePageToken(database.SortTop, models.Item{ID: 7, Score: 42, CreatedAt: createdAt})
+
+	type testcase struct {
+		name          string
+		req           *pb.ListItemsRequest
+		itemType      string
+		expectedQuery database.ListQuery
+		expectedCode  codes.Code
+	}
+
+	tests := []testcase{
+		{
+			name:          "defaults",
+			req:           &pb.ListItemsRequest{},
+			expectedQuery: database.ListQuery{Limit: defaultPageSize, Sort: database.SortNewest, TopLevel: true},
+		},
+		{
+			name:     "filters",
+			req:      &pb.ListItemsRequest{PageSize: 10, Author: "shark boi", MinScore: 5, CreatedAfter: 100, CreatedBefore: 200, Sort: pb.SortOrder_OLDEST},
+			itemType: "story",
+			expectedQuery: database.ListQuery{
+				Type:          "story",
+				Author:        "shark boi",
+				MinScore:      5,
+				CreatedAfter:  time.Unix(100, 0).UTC(),
+				CreatedBefore: time.Unix(200, 0).UTC(),
+				Sort:          database.SortOldest,
+				Limit:         10,
+			},
+		},
+		{
+			name:          "replies are listed by type",
+			req:           &pb.ListItemsRequest{Type: "comment"},
+			expectedQuery: database.ListQuery{Type: "comment", Limit: defaultPageSize, Sort: database.SortNewest},
+		},
+		{
+			name:          "trims the author",
+			req:           &pb.ListItemsRequest{Author: " shark boi "},
+			expectedQuery: database.ListQuery{Author: "shark boi", Limit: defaultPageSize, Sort: database.SortNewest, TopLevel: true},
+		},
+		{
+			name:          "caps page size",
+			req:           &pb.ListItemsRequest{PageSize: 10000},
+			expectedQuery: database.ListQuery{Limit: maxPageSize, TopLevel: true},
+		},
+		{
+			name:          "page token",
+			req:           &pb.ListItemsRequest{PageToken: topToken, Sort: pb.SortOrder_TOP},
+			expectedQuery: database.ListQuery{Limit: defaultPageSize, Sort: database.SortTop, After: &database.Cursor{ID: 7, Score: 42, CreatedAt: createdAt}, TopLevel: true},
+		},
+		{
+			name:         "negative page size",
+			req:          &pb.ListItemsRequest{PageSize: -1},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "conflicting type",
+			req:          &pb.ListItemsRequest{Type: "job"},
+			itemType:     "story",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "malformed page token",
+			req:          &pb.ListItemsRequest{PageToken: "not a token"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "page token for another sort order",
+			req:          &pb.ListItemsRequest{PageToken: topToken},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseListRequest(tt.req, tt.itemType)
+
+			if tt.expectedCode != codes.OK {
+				require.Error(t, err)
+				assert.Equal(t, tt.expectedCode, status.Code(err))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedQuery, q)
+		})
+	}
+}
@@ -1,32 +1,107 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"time"
 
 	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 )
 
+// HealthCheck reports whether a dependency of the server is ready
+type HealthCheck struct {
+	// Name is the health service name the result is reported under
+	Name  string
+	Check func(ctx context.Context) error
+	// Optional checks are reported under their own name but do not take the whole server out of service
+	Optional bool
+}
+
 type server struct {
-	port   int
-	srv    pb.APIServer
-	logger *zap.Logger
+	port            int
+	srv             pb.APIServer
+	reflection      bool
+	creds           credentials.TransportCredentials
+	interceptors    []Interceptor
+	checks          []HealthCheck
+	checkInterval   time.Duration
+	shutdownTimeout time.Duration
+	logger          *zap.Logger
+}
+
+// ServerOption is an interface for a functional option
+type ServerOption func(s *server)
+
+// WithReflection is a functional option to enable the gRPC reflection service
+func WithReflection() ServerOption {
+	return func(s *server) {
+		s.reflection = true
+	}
+}
+
+// WithCredentials is a functional option to serve over TLS instead of plaintext
+func WithCredentials(creds credentials.TransportCredentials) ServerOption {
+	return func(s *server) {
+		s.creds = creds
+	}
+}
+
+// WithInterceptors is a functional option to add middleware to every call. Interceptors run in the order given
+func WithInterceptors(interceptors ...Interceptor) ServerOption {
+	return func(s *server) {
+		s.interceptors = append(s.interceptors, interceptors...)
+	}
+}
+
+// WithHealthChecks is a functional option to configure the dependencies reported by the health service
+func WithHealthChecks(checks ...HealthCheck) ServerOption {
+	return func(s *server) {
+		s.checks = append(s.checks, checks...)
+	}
+}
+
+// WithHealthCheckInterval is a functional option to configure how often dependencies are checked
+func WithHealthCheckInterval(interval time.Duration) ServerOption {
+	return func(s *server) {
+		s.checkInterval = interval
+	}
+}
+
+// WithShutdownTimeout is a functional option to configure how long in-flight calls are given to finish on shutdown
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(s *server) {
+		s.shutdownTimeout = timeout
+	}
 }
 
 // NewServer creates a new server
-func NewServer(port int, logger *zap.Logger, srv pb.APIServer) *server {
-	return &server{
-		port:   port,
-		srv:    srv,
-		logger: logger,
+func NewServer(port int, logger *zap.Logger, srv pb.APIServer, opts ...ServerOption) *server {
+	s := &server{
+		port:            port,
+		srv:             srv,
+		checkInterval:   5 * time.Second,
+		shutdownTimeout: 30 * time.Second,
+		logger:          logger,
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
 }
 
-// Start starts a gRPC server
-func (s *server) Start() error {
+// Start starts a gRPC server and blocks until ctx is cancelled and the server has stopped
+func (s *server) Start(ctx context.Context) error {
 	s.logger.Info(fmt.Sprintf("starting server on port %d", s.port))
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
@@ -34,11 +109,141 @@ func (s *server) Start() error {
 		return errors.Wrap(err, "failed to listen")
 	}
 
-	gs := grpc.NewServer()
+	return s.Serve(ctx, lis)
+}
+
+// Serve serves gRPC requests on lis until ctx is cancelled. In-flight calls are then given the shutdown
+// timeout to finish before being cancelled
+func (s *server) Serve(ctx context.Context, lis net.Listener) error {
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	for _, i := range s.interceptors {
+		if i.Unary != nil {
+			unary = append(unary, i.Unary)
+		}
+		if i.Stream != nil {
+			stream = append(stream, i.Stream)
+		}
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle: 5 * time.Minute,
+			Time:              time.Minute,
+			Timeout:           20 * time.Second,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             15 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+	if s.creds != nil {
+		opts = append(opts, grpc.Creds(s.creds))
+	}
+
+	gs := grpc.NewServer(opts...)
 	pb.RegisterAPIServer(gs, s.srv)
-	if err := gs.Serve(lis); err != nil {
-		return errors.Wrap(err, "failed to serve")
+
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(gs, hs)
+
+	if s.reflection {
+		reflection.Register(gs)
+	}
+
+	checkCtx, stopChecks := context.WithCancel(ctx)
+	defer stopChecks()
+
+	s.checkHealth(checkCtx, hs)
+	go s.watchHealth(checkCtx, hs)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- gs.Serve(lis)
+	}()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			return errors.Wrap(err, "failed to serve")
+		}
+
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("shutting down server", zap.Duration("timeout", s.shutdownTimeout))
+
+	// report not serving first so load balancers stop routing new calls here
+	stopChecks()
+	hs.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		gs.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+	case <-timer.C:
+		s.logger.Warn("shutdown timeout exceeded, cancelling in-flight calls")
+		gs.Stop()
+		<-stopped
+	}
+
+	return <-errs
+}
+
+// watchHealth checks dependencies on an interval until ctx is cancelled
+func (s *server) watchHealth(ctx context.Context, hs *health.Server) {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkHealth(ctx, hs)
+		}
+	}
+}
+
+// checkHealth runs every check and updates the health service. The overall status, reported under
+// the empty name and the API service name, is serving only when every required check passes
+func (s *server) checkHealth(ctx context.Context, hs *health.Server) {
+	overall := healthpb.HealthCheckResponse_SERVING
+
+	for _, check := range s.checks {
+		status := healthpb.HealthCheckResponse_SERVING
+
+		checkCtx, cancel := context.WithTimeout(ctx, s.checkInterval)
+		err := check.Check(checkCtx)
+		cancel()
+
+		if err != nil {
+			s.logger.Warn("health check failed", zap.String("name", check.Name), zap.Error(err))
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+
+			if !check.Optional {
+				overall = healthpb.HealthCheckResponse_NOT_SERVING
+			}
+		}
+
+		// a cancelled context means the server is shutting down and the statuses are about to be replaced
+		if ctx.Err() != nil {
+			return
+		}
+
+		hs.SetServingStatus(check.Name, status)
 	}
 
-	return nil
+	hs.SetServingStatus("", overall)
+	hs.SetServingStatus(pb.API_ServiceDesc.ServiceName, overall)
 }
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// slowServer blocks GetItem calls until release is closed or the call is cancelled
+type slowServer struct {
+	pb.UnimplementedAPIServer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slowServer) GetItem(ctx context.Context, req *pb.GetItemRequest) (*pb.Item, error) {
+	close(s.started)
+
+	select {
+	case <-s.release:
+		return &pb.Item{Id: req.GetId()}, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// serve starts the server on an in-memory listener and returns a connection to it and a channel
+// receiving the result of Serve
+func serve(ctx context.Context, t *testing.T, s *server) (*grpc.ClientConn, <-chan error) {
+	lis := bufconn.Listen(1024 * 1024)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Serve(ctx, lis)
+	}()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, errs
+}
+
+func TestServerHealth(t *testing.T) {
+	failing := func(context.Context) error { return errors.New("connection refused") }
+	passing := func(context.Context) error { return nil }
+
+	type testcase struct {
+		name     string
+		checks   []HealthCheck
+		expected map[string]healthpb.HealthCheckResponse_ServingStatus
+	}
+
+	tests := []testcase{
+		{
+			name:   "all checks pass",
+			checks: []HealthCheck{{Name: "database", Check: passing}, {Name: "redis", Check: passing, Optional: true}},
+			expected: map[string]healthpb.HealthCheckResponse_ServingStatus{
+				"":                             healthpb.HealthCheckResponse_SERVING,
+				pb.API_ServiceDesc.ServiceName: healthpb.HealthCheckResponse_SERVING,
+				"database":                     healthpb.HealthCheckResponse_SERVING,
+				"redis":                        healthpb.HealthCheckResponse_SERVING,
+			},
+		},
+		{
+			name:   "required check fails",
+			checks: []HealthCheck{{Name: "database", Check: failing}, {Name: "redis", Check: passing, Optional: true}},
+			expected: map[string]healthpb.HealthCheckResponse_ServingStatus{
+				"":                             healthpb.HealthCheckResponse_NOT_SERVING,
+				pb.API_ServiceDesc.ServiceName: healthpb.HealthCheckResponse_NOT_SERVING,
+				"database":                     healthpb.HealthCheckResponse_NOT_SERVING,
+				"redis":                        healthpb.HealthCheckResponse_SERVING,
+			},
+		},
+		{
+			name:   "optional check fails",
+			checks: []HealthCheck{{Name: "database", Check: passing}, {Name: "redis", Check: failing, Optional: true}},
+			expected: map[string]healthpb.HealthCheckResponse_ServingStatus{
+				"":                             healthpb.HealthCheckResponse_SERVING,
+				pb.API_ServiceDesc.ServiceName: healthpb.HealthCheckResponse_SERVING,
+				"database":                     healthpb.HealthCheckResponse_SERVING,
+				"redis":                        healthpb.HealthCheckResponse_NOT_SERVING,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := NewServer(0, zap.NewNop(), Handler{}, WithHealthChecks(tc.checks...))
+			conn, _ := serve(ctx, t, s)
+			client := healthpb.NewHealthClient(conn)
+
+			for service, expected := range tc.expected {
+				res, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+				require.NoError(t, err)
+				assert.Equal(t, expected, res.GetStatus(), service)
+			}
+		})
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	t.Run("waits for in-flight calls", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		srv := &slowServer{started: make(chan struct{}), release: make(chan struct{})}
+		conn, errs := serve(ctx, t, NewServer(0, zap.NewNop(), srv, WithShutdownTimeout(time.Minute)))
+
+		calls := make(chan error, 1)
+		go func() {
+			_, err := pb.NewAPIClient(conn).GetItem(context.Background(), &pb.GetItemRequest{Id: 1})
+			calls <- err
+		}()
+
+		<-srv.started
+		cancel()
+
+		// the server must not stop while the call is in flight
+		select {
+		case err := <-errs:
+			t.Fatalf("server stopped before the in-flight call finished: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(srv.release)
+
+		assert.NoError(t, <-calls)
+		assert.NoError(t, <-errs)
+	})
+
+	t.Run("cancels in-flight calls after the timeout", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		srv := &slowServer{started: make(chan struct{}), release: make(chan struct{})}
+		conn, errs := serve(ctx, t, NewServer(0, zap.NewNop(), srv, WithShutdownTimeout(50*time.Millisecond)))
+
+		calls := make(chan error, 1)
+		go func() {
+			_, err := pb.NewAPIClient(conn).GetItem(context.Background(), &pb.GetItemRequest{Id: 1})
+			calls <- err
+		}()
+
+		<-srv.started
+		cancel()
+
+		assert.NoError(t, <-errs)
+		assert.NotEqual(t, codes.OK, status.Code(<-calls))
+	})
+}
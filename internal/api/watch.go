@@ -0,0 +1,196 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultHeartbeatInterval = 15 * time.Second
+
+// WatchItems streams item events to a client, replaying any missed events when resuming
+func (h Handler) WatchItems(req *pb.WatchItemsRequest, s pb.API_WatchItemsServer) error {
+	if h.Events == nil {
+		return status.Error(codes.Unimplemented, "watching items is not enabled")
+	}
+
+	var last models.EventPosition
+	if req.GetResumeToken() != "" {
+		p, ok := parseResumeToken(req.GetResumeToken())
+		if !ok {
+			return invalidArgument("resume_token", "malformed")
+		}
+
+		last = p
+	}
+
+	filter := newEventFilter(req)
+
+	// subscribe before replaying so nothing recorded during the replay is missed
+	events, unsubscribe := h.Events.Subscribe()
+	defer unsubscribe()
+
+	send := func(e models.ItemEvent) error {
+		last = e.Position()
+		if !filter.matches(e) {
+			return nil
+		}
+
+		if err := s.Send(eventToProto(e)); err != nil {
+			return toStatus(err, "streaming event to client")
+		}
+
+		return nil
+	}
+
+	if req.GetResumeToken() != "" {
+		for {
+			replay, err := h.Events.EventsAfter(s.Context(), last, eventPageSize)
+			if err != nil {
+				return toStatus(err, "replaying events")
+			}
+
+			for _, e := range replay {
+				if err := send(e); err != nil {
+					return err
+				}
+			}
+
+			if len(replay) < eventPageSize {
+				break
+			}
+		}
+	}
+
+	interval := h.HeartbeatInterval
+	if interval == 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-s.Context().Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return status.Error(codes.Aborted, "watcher fell behind, resume from the last received event")
+			}
+
+			// events already sent during the replay
+			if !e.Position().After(last) {
+				continue
+			}
+
+			if err := send(e); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if err := s.Send(&pb.ItemEvent{
+				Kind:        pb.ItemEvent_HEARTBEAT,
+				ResumeToken: resumeToken(last),
+				Time:        time.Now().Unix(),
+			}); err != nil {
+				return toStatus(err, "sending heartbeat")
+			}
+		}
+	}
+}
+
+// resumeToken encodes the position of an event as "<transaction>.<id>"
+func resumeToken(p models.EventPosition) string {
+	return strconv.FormatInt(p.TxID, 10) + "." + strconv.FormatInt(p.ID, 10)
+}
+
+func parseResumeToken(token string) (models.EventPosition, bool) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return models.EventPosition{}, false
+	}
+
+	txID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || txID < 0 {
+		return models.EventPosition{}, false
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || id < 0 {
+		return models.EventPosition{}, false
+	}
+
+	return models.EventPosition{TxID: txID, ID: id}, true
+}
+
+// eventFilter decides which events a watcher is interested in
+type eventFilter struct {
+	types    map[string]bool
+	author   string
+	minScore int
+}
+
+func newEventFilter(req *pb.WatchItemsRequest) eventFilter {
+	f := eventFilter{
+		author:   req.GetAuthor(),
+		minScore: int(req.GetMinScore()),
+	}
+
+	if len(req.GetTypes()) > 0 {
+		f.types = map[string]bool{}
+		for _, t := range req.GetTypes() {
+			f.types[t] = true
+		}
+	}
+
+	return f
+}
+
+func (f eventFilter) matches(e models.ItemEvent) bool {
+	if e.Kind == models.ItemDeleted {
+		return true
+	}
+
+	// the item was deleted after this event was recorded, the deleted event will follow
+	if e.Item == nil {
+		return false
+	}
+
+	if f.types != nil && !f.types[e.Item.Type] {
+		return false
+	}
+
+	if f.author != "" && e.Item.CreatedBy != f.author {
+		return false
+	}
+
+	return f.minScore == 0 || e.Item.Score >= f.minScore
+}
+
+func eventToProto(e models.ItemEvent) *pb.ItemEvent {
+	event := &pb.ItemEvent{
+		ItemId:      int32(e.ItemID),
+		ResumeToken: resumeToken(e.Position()),
+		Time:        e.CreatedAt.Unix(),
+	}
+
+	switch e.Kind {
+	case models.ItemCreated:
+		event.Kind = pb.ItemEvent_CREATED
+	case models.ItemUpdated:
+		event.Kind = pb.ItemEvent_UPDATED
+	case models.ItemDeleted:
+		event.Kind = pb.ItemEvent_DELETED
+	}
+
+	if e.Item != nil {
+		event.Item = models.Itop(*e.Item)
+	}
+
+	return event
+}
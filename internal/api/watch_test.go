@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+type stubEventStore struct {
+	events []models.ItemEvent
+}
+
+func (s *stubEventStore) ListenEvents(ctx context.Context, notify func()) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (s *stubEventStore) EventsAfter(ctx context.Context, after models.EventPosition, limit int) ([]models.ItemEvent, error) {
+	var events []models.ItemEvent
+	for _, e := range s.events {
+		if e.Position().After(after) && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+
+	return events, nil
+}
+
+func (s *stubEventStore) LatestEventPosition(ctx context.Context) (models.EventPosition, error) {
+	return s.events[len(s.events)-1].Position(), nil
+}
+
+type stubWatchServer struct {
+	grpc.ServerStream
+	ctx context.Context
+
+	mu   sync.Mutex
+	sent []*pb.ItemEvent
+}
+
+func (s *stubWatchServer) Context() context.Context {
+	return s.ctx
+}
+
+func (s *stubWatchServer) Send(e *pb.ItemEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, e)
+	return nil
+}
+
+func (s *stubWatchServer) received() []*pb.ItemEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*pb.ItemEvent{}, s.sent...)
+}
+
+func TestWatchItems(t *testing.T) {
+	story := &models.Item{ID: 1, Type: "story", Score: 10, CreatedBy: "shark boi"}
+	job := &models.Item{ID: 2, Type: "job", Score: 10, CreatedBy: "lava gurl"}
+
+	// the job's event has a lower id but its transaction committed after the story's
+	store := &stubEventStore{
+		events: []models.ItemEvent{
+			{ID: 2, TxID: 10, Kind: models.ItemCreated, ItemID: 1, Item: story},
+			{ID: 1, TxID: 11, Kind: models.ItemCreated, ItemID: 2, Item: job},
+			{ID: 3, TxID: 12, Kind: models.ItemUpdated, ItemID: 1, Item: story},
+			{ID: 4, TxID: 13, Kind: models.ItemDeleted, ItemID: 2},
+		},
+	}
+
+	type testcase struct {
+		name            string
+		req             *pb.WatchItemsRequest
+		live            []models.ItemEvent
+		expectedTokens  []string
+		expectHeartbeat bool
+	}
+
+	tests := []testcase{
+		{
+			name:           "replays events after the resume token",
+			req:            &pb.WatchItemsRequest{ResumeToken: "10.2"},
+			expectedTokens: []string{"11.1", "12.3", "13.4"},
+		},
+		{
+			name:           "filters replayed events but always sends deletes",
+			req:            &pb.WatchItemsRequest{ResumeToken: "0.0", Types: []string{"story"}},
+			expectedTokens: []string{"10.2", "12.3", "13.4"},
+		},
+		{
+			name: "streams live events",
+			req:  &pb.WatchItemsRequest{Author: "lava gurl"},
+			live: []models.ItemEvent{
+				{ID: 5, TxID: 14, Kind: models.ItemCreated, ItemID: 3, Item: &models.Item{ID: 3, CreatedBy: "lava gurl"}},
+				{ID: 6, TxID: 14, Kind: models.ItemCreated, ItemID: 4, Item: &models.Item{ID: 4, CreatedBy: "shark boi"}},
+			},
+			expectedTokens: []string{"14.5"},
+		},
+		{
+			name: "skips live events already replayed",
+			req:  &pb.WatchItemsRequest{ResumeToken: "12.3"},
+			live: []models.ItemEvent{
+				{ID: 4, TxID: 13, Kind: models.ItemDeleted, ItemID: 2},
+			},
+			expectedTokens: []string{"13.4"},
+		},
+		{
+			name:            "sends heartbeats while idle",
+			req:             &pb.WatchItemsRequest{},
+			expectedTokens:  []string{},
+			expectHeartbeat: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewEventHub(store, zap.NewNop())
+			h := Handler{Events: hub, HeartbeatInterval: 20 * time.Millisecond}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			s := &stubWatchServer{ctx: ctx}
+
+			done := make(chan error)
+			go func() {
+				done <- h.WatchItems(tt.req, s)
+			}()
+
+			// wait for the watcher to subscribe before publishing live events
+			require.Eventually(t, func() bool {
+				hub.mu.Lock()
+				defer hub.mu.Unlock()
+				return len(hub.subscribers) == 1
+			}, time.Second, time.Millisecond)
+
+			for _, e := range tt.live {
+				hub.broadcast(e)
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+			require.NoError(t, <-done)
+
+			tokens := []string{}
+			heartbeat := false
+			for _, e := range s.received() {
+				if e.Kind == pb.ItemEvent_HEARTBEAT {
+					heartbeat = true
+					continue
+				}
+
+				tokens = append(tokens, e.ResumeToken)
+			}
+
+			assert.Equal(t, tt.expectedTokens, tokens)
+			if tt.expectHeartbeat {
+				assert.True(t, heartbeat, "expected a heartbeat")
+			}
+		})
+	}
+}
+
+func TestParseResumeToken(t *testing.T) {
+	type testcase struct {
+		name             string
+		token            string
+		expectedPosition models.EventPosition
+		expectedOK       bool
+	}
+
+	tests := []testcase{
+		{
+			name:             "valid",
+			token:            "12.3",
+			expectedPosition: models.EventPosition{TxID: 12, ID: 3},
+			expectedOK:       true,
+		},
+		{
+			name:       "id only",
+			token:      "3",
+			expectedOK: false,
+		},
+		{
+			name:       "negative id",
+			token:      "12.-3",
+			expectedOK: false,
+		},
+		{
+			name:       "not numbers",
+			token:      "a.b",
+			expectedOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := parseResumeToken(tt.token)
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.Equal(t, tt.expectedPosition, p)
+		})
+	}
+}
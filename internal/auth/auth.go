@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrNoCredentials is returned by an authenticator when the call carries no credentials it understands
+var ErrNoCredentials = errors.New("no credentials")
+
+// Identity is an authenticated caller
+type Identity struct {
+	// Subject names the caller, the certificate subject or token sub claim
+	Subject string
+	// Scopes are the permissions granted to the caller
+	Scopes []string
+	// Method is how the caller authenticated, mtls or jwt
+	Method string
+}
+
+// HasScopes reports whether the identity was granted every scope
+func (i Identity) HasScopes(scopes ...string) bool {
+	granted := make(map[string]bool, len(i.Scopes))
+	for _, s := range i.Scopes {
+		granted[s] = true
+	}
+
+	for _, s := range scopes {
+		if !granted[s] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type identityContextKey struct{}
+
+// IdentityFromContext returns the authenticated caller of the call being handled, if any
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityContextKey{}).(Identity)
+	return id, ok
+}
+
+// Authenticator is a interface to identify the caller of a gRPC call
+type Authenticator interface {
+	// Authenticate returns ErrNoCredentials when the call carries no credentials of its kind
+	Authenticate(ctx context.Context) (Identity, error)
+}
+
+// Guard authenticates every call and checks the caller holds the scopes the policy requires
+type Guard struct {
+	policy         *Policy
+	authenticators []Authenticator
+	logger         *zap.Logger
+}
+
+// NewGuard creates a guard. Authenticators are tried in order until one finds credentials
+func NewGuard(policy *Policy, logger *zap.Logger, authenticators ...Authenticator) *Guard {
+	return &Guard{
+		policy:         policy,
+		authenticators: authenticators,
+		logger:         logger,
+	}
+}
+
+// Unary returns the interceptor guarding unary calls
+func (g *Guard) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := g.check(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns the interceptor guarding streaming calls
+func (g *Guard) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := g.check(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// check authenticates the caller and authorizes them for method, returning a context holding their identity
+func (g *Guard) check(ctx context.Context, method string) (context.Context, error) {
+	if g.policy.IsPublic(method) {
+		return ctx, nil
+	}
+
+	id, err := g.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.policy.Authorize(method, id); err != nil {
+		g.logger.Info("denied call", zap.String("method", method), zap.String("subject", id.Subject), zap.Error(err))
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return context.WithValue(ctx, identityContextKey{}, id), nil
+}
+
+func (g *Guard) authenticate(ctx context.Context) (Identity, error) {
+	for _, a := range g.authenticators {
+		id, err := a.Authenticate(ctx)
+		if errors.Is(err, ErrNoCredentials) {
+			if err != ErrNoCredentials {
+				g.logger.Debug("skipped credentials", zap.Error(err))
+			}
+
+			continue
+		}
+
+		if err != nil {
+			g.logger.Info("rejected credentials", zap.Error(err))
+			return Identity{}, status.Error(codes.Unauthenticated, "invalid credentials")
+		}
+
+		return id, nil
+	}
+
+	return Identity{}, status.Error(codes.Unauthenticated, "missing credentials")
+}
+
+// identityStream overrides the context of a server stream
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var testPolicy = &Policy{
+	Methods: map[string][]string{
+		"/api.API/*":          {"items:read"},
+		"/api.API/WatchItems": {"items:read", "items:watch"},
+	},
+	Public: []string{"/grpc.health.v1.Health/*"},
+	Clients: map[string][]string{
+		"spiffe://gs-onboarding/gateway": {"items:read"},
+	},
+}
+
+// writeJWKS writes the public half of key to a jwks file and returns its path
+func writeJWKS(t *testing.T, kid string, key *rsa.PrivateKey) string {
+	set := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+
+	b, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+
+	return path
+}
+
+func signToken(t *testing.T, kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func withBearer(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func withClientCert(t *testing.T, uri string) context.Context {
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "gateway"}, URIs: []*url.URL{u}}
+
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+	})
+}
+
+func TestGuard(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keys, err := LoadJWKS(writeJWKS(t, "key-1", key))
+	require.NoError(t, err)
+
+	guard := NewGuard(testPolicy, zap.NewNop(),
+		NewMTLSAuthenticator(testPolicy.Clients),
+		NewJWTAuthenticator(keys, "https://auth.gs-onboarding", "api"),
+	)
+
+	valid := jwt.MapClaims{
+		"sub":   "reporting",
+		"iss":   "https://auth.gs-onboarding",
+		"aud":   "api",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "items:read",
+	}
+
+	with := func(overrides jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+
+		return claims
+	}
+
+	type testcase struct {
+		name            string
+		ctx             context.Context
+		method          string
+		expectedCode    codes.Code
+		expectedSubject string
+	}
+
+	tests := []testcase{
+		{
+			name:         "public method without credentials",
+			ctx:          context.Background(),
+			method:       "/grpc.health.v1.Health/Check",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "missing credentials",
+			ctx:          context.Background(),
+			method:       "/api.API/GetItem",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:            "valid token",
+			ctx:             withBearer(signToken(t, "key-1", key, valid)),
+			method:          "/api.API/GetItem",
+			expectedCode:    codes.OK,
+			expectedSubject: "reporting",
+		},
+		{
+			name:         "token missing a scope",
+			ctx:          withBearer(signToken(t, "key-1", key, valid)),
+			method:       "/api.API/WatchItems",
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:            "token with every scope",
+			ctx:             withBearer(signToken(t, "key-1", key, with(jwt.MapClaims{"scope": "items:read items:watch"}))),
+			method:          "/api.API/WatchItems",
+			expectedCode:    codes.OK,
+			expectedSubject: "reporting",
+		},
+		{
+			name:         "method missing from the policy",
+			ctx:          withBearer(signToken(t, "key-1", key, valid)),
+			method:       "/admin.Admin/Drop",
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "expired token",
+			ctx:          withBearer(signToken(t, "key-1", key, with(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}))),
+			method:       "/api.API/GetItem",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "token without expiry",
+			ctx:          withBearer(signToken(t, "key-1", key, with(jwt.MapClaims{"exp": nil}))),
+			method:       "/api.API/GetItem",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "wrong audience",
+			ctx:          withBearer(signToken(t, "key-1", key, with(jwt.MapClaims{"aud": "billing"}))),
+			method:       "/api.API/GetItem",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "signed by an unknown key",
+			ctx:          withBearer(signToken(t, "key-1", otherKey, valid)),
+			method:       "/api.API/GetItem",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:            "known client certificate",
+			ctx:             withClientCert(t, "spiffe://gs-onboarding/gateway"),
+			method:          "/api.API/ListAll",
+			expectedCode:    codes.OK,
+			expectedSubject: "spiffe://gs-onboarding/gateway",
+		},
+		{
+			name:         "unknown client certificate",
+			ctx:          withClientCert(t, "spiffe://gs-onboarding/intruder"),
+			method:       "/api.API/ListAll",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name: "unknown client certificate with a valid token",
+			ctx: metadata.NewIncomingContext(
+				withClientCert(t, "spiffe://gs-onboarding/intruder"),
+				metadata.Pairs("authorization", "Bearer "+signToken(t, "key-1", key, valid)),
+			),
+			method:          "/api.API/ListAll",
+			expectedCode:    codes.OK,
+			expectedSubject: "reporting",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var subject string
+			_, err := guard.Unary()(tc.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				if id, ok := IdentityFromContext(ctx); ok {
+					subject = id.Subject
+				}
+
+				return nil, nil
+			})
+
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+			assert.Equal(t, tc.expectedSubject, subject)
+		})
+	}
+}
+
+func TestTokenFileCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("first\n"), 0o600))
+
+	creds := NewTokenFileCredentials(path, false)
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer first", md["authorization"])
+
+	// rotated tokens are picked up on the next call
+	require.NoError(t, os.WriteFile(path, []byte("second"), 0o600))
+
+	md, err = creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer second", md["authorization"])
+}
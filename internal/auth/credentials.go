@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+)
+
+type tokenFile struct {
+	path       string
+	requireTLS bool
+}
+
+// NewTokenFileCredentials sends the bearer token in the file at path with every call. The file is read
+// on each call so rotated tokens are picked up without a restart
+func NewTokenFileCredentials(path string, requireTLS bool) credentials.PerRPCCredentials {
+	return &tokenFile{path: path, requireTLS: requireTLS}
+}
+
+func (t *tokenFile) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	b, err := os.ReadFile(t.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading token file")
+	}
+
+	return map[string]string{
+		"authorization": "Bearer " + strings.TrimSpace(string(b)),
+	}, nil
+}
+
+func (t *tokenFile) RequireTransportSecurity() bool {
+	return t.requireTLS
+}
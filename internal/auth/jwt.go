@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+// KeySet holds the public keys tokens may be signed with, by key id
+type KeySet struct {
+	keys map[string]interface{}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKS reads RSA and EC public keys from a JSON Web Key Set file
+func LoadJWKS(path string) (*KeySet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading jwks file")
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, errors.Wrap(err, "decoding jwks file")
+	}
+
+	ks := &KeySet{keys: make(map[string]interface{}, len(set.Keys))}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding key %q", k.Kid)
+		}
+
+		ks.keys[k.Kid] = key
+	}
+
+	if len(ks.keys) == 0 {
+		return nil, errors.New("jwks file has no signing keys")
+	}
+
+	return ks, nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding modulus")
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding x")
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding y")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+type jwtAuthenticator struct {
+	keys     *KeySet
+	issuer   string
+	audience string
+	parser   *jwt.Parser
+}
+
+// NewJWTAuthenticator authenticates bearer tokens in the authorization metadata. Tokens must be signed
+// by a key in keys, unexpired, and issued by issuer for audience when they are set. Scopes are read from
+// the space separated scope claim
+func NewJWTAuthenticator(keys *KeySet, issuer, audience string) Authenticator {
+	return &jwtAuthenticator{
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
+		parser: &jwt.Parser{
+			ValidMethods: []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"},
+		},
+	}
+}
+
+func (a *jwtAuthenticator) Authenticate(ctx context.Context) (Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return Identity{}, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(strings.TrimPrefix(values[0], "Bearer "), claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := a.keys.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+
+		return key, nil
+	})
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "parsing token")
+	}
+
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return Identity{}, errors.New("token has no expiry")
+	}
+
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return Identity{}, errors.New("token issuer does not match")
+	}
+
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return Identity{}, errors.New("token audience does not match")
+	}
+
+	sub, _ := claims["sub"].(string)
+	scope, _ := claims["scope"].(string)
+
+	return Identity{
+		Subject: sub,
+		Scopes:  strings.Fields(scope),
+		Method:  "jwt",
+	}, nil
+}
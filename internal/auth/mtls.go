@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+type mtlsAuthenticator struct {
+	clients map[string][]string
+}
+
+// NewMTLSAuthenticator authenticates callers by their verified client certificate. The subject is the
+// first URI SAN, such as a SPIFFE id, or the common name. Only subjects in clients are accepted and are
+// granted the scopes listed for them, others are treated as carrying no credentials
+func NewMTLSAuthenticator(clients map[string][]string) Authenticator {
+	return &mtlsAuthenticator{clients: clients}
+}
+
+func (a *mtlsAuthenticator) Authenticate(ctx context.Context) (Identity, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, ErrNoCredentials
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+
+	subject := certificateSubject(info.State.VerifiedChains[0][0])
+
+	// an unknown certificate doesn't reject the call so it can still authenticate with a bearer token
+	scopes, ok := a.clients[subject]
+	if !ok {
+		return Identity{}, errors.Wrapf(ErrNoCredentials, "unknown client %q", subject)
+	}
+
+	return Identity{
+		Subject: subject,
+		Scopes:  scopes,
+		Method:  "mtls",
+	}, nil
+}
+
+func certificateSubject(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Policy decides which scopes each method requires
+type Policy struct {
+	// Methods maps full method names, such as /api.API/GetItem, to the scopes a caller needs. A
+	// service wide entry, such as /api.API/*, applies to methods that are not listed themselves
+	Methods map[string][]string `json:"methods"`
+	// Public methods are served without credentials, such as health checks
+	Public []string `json:"public"`
+	// Clients maps mTLS certificate subjects to the scopes they are granted
+	Clients map[string][]string `json:"clients"`
+}
+
+// LoadPolicy reads a JSON policy file
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading policy file")
+	}
+
+	var p Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, errors.Wrap(err, "decoding policy file")
+	}
+
+	return &p, nil
+}
+
+// IsPublic reports whether method can be called without credentials
+func (p *Policy) IsPublic(method string) bool {
+	for _, m := range p.Public {
+		if m == method || (strings.HasSuffix(m, "/*") && strings.HasPrefix(method, strings.TrimSuffix(m, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authorize returns an error if id does not hold every scope required by method. Methods missing from
+// the policy are denied
+func (p *Policy) Authorize(method string, id Identity) error {
+	scopes, ok := p.Methods[method]
+	if !ok {
+		scopes, ok = p.Methods[method[:strings.LastIndex(method, "/")+1]+"*"]
+	}
+
+	if !ok {
+		return fmt.Errorf("%s is not allowed by the policy", method)
+	}
+
+	if !id.HasScopes(scopes...) {
+		return fmt.Errorf("%s requires scopes %s", method, strings.Join(scopes, " "))
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package consumer
+
+import (
+	"context"
+
+	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/alexdunne/gs-onboarding/internal/queue"
+	"github.com/alexdunne/gs-onboarding/pkg/hn"
+)
+
+// Handler handles a single fetched item as it moves through the pipeline
+type Handler func(ctx context.Context, item hn.Item) error
+
+// Processor is a pipeline stage. It wraps the next handler and decides whether, and with what, to call it
+type Processor func(next Handler) Handler
+
+// Filter creates a processor that drops any item keep returns false for
+func Filter(keep func(item hn.Item) bool) Processor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, item hn.Item) error {
+			if !keep(item) {
+				return nil
+			}
+
+			return next(ctx, item)
+		}
+	}
+}
+
+// Transform creates a processor that replaces the item with the result of fn. It can be used to enrich or normalise items
+func Transform(fn func(ctx context.Context, item hn.Item) (hn.Item, error)) Processor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, item hn.Item) error {
+			item, err := fn(ctx, item)
+			if err != nil {
+				return err
+			}
+
+			return next(ctx, item)
+		}
+	}
+}
+
+// SkipDeadOrDeleted creates a processor that drops dead or deleted items
+func SkipDeadOrDeleted() Processor {
+	return Filter(func(item hn.Item) bool {
+		return !item.Dead && !item.Deleted
+	})
+}
+
+// EnqueueChildren creates a sink that queues the replies and poll options of each item that haven't been
+// stored yet, so the discussions of seeded stories are stored along with them without crawling every
+// thread again each time its story is re-fetched. Children whose fetch or write failed are queued again
+// the next time their parent is fetched. Dead and deleted items are dropped before sinks run so their
+// replies are never queued
+func EnqueueChildren(q queue.Queue, db database.Database) Handler {
+	return func(ctx context.Context, item hn.Item) error {
+		children := append(append([]int{}, item.Parts...), item.Kids...)
+		if len(children) == 0 {
+			return nil
+		}
+
+		existing, err := db.GetMany(ctx, children)
+		if err != nil {
+			return err
+		}
+
+		stored := map[int]bool{}
+		for _, child := range existing {
+			stored[child.ID] = true
+		}
+
+		for _, id := range children {
+			if stored[id] {
+				continue
+			}
+
+			if err := q.Publish(&queue.Message{ID: id}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// chain builds a handler that runs each processor in order before handing the item to every sink
+func chain(processors []Processor, sinks []Handler) Handler {
+	h := func(ctx context.Context, item hn.Item) error {
+		for _, sink := range sinks {
+			if err := sink(ctx, item); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for i := len(processors) - 1; i >= 0; i-- {
+		h = processors[i](h)
+	}
+
+	return h
+}
+
+func toModel(item hn.Item) models.Item {
+	// poll options belong to their poll the way comments belong to what they reply to
+	parent := item.Parent
+	if item.Poll != 0 {
+		parent = item.Poll
+	}
+
+	return models.Item{
+		ID:          item.ID,
+		Type:        item.Type,
+		Content:     item.Text,
+		URL:         item.URL,
+		Score:       item.Score,
+		Title:       item.Title,
+		CreatedAt:   item.CreatedAt,
+		CreatedBy:   item.CreatedBy,
+		Parent:      parent,
+		Kids:        item.Kids,
+		Parts:       item.Parts,
+		Descendants: item.Descendants,
+	}
+}
@@ -0,0 +1,202 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/alexdunne/gs-onboarding/internal/queue"
+	"github.com/alexdunne/gs-onboarding/pkg/hn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPipeline(t *testing.T) {
+	upperTitle := Transform(func(ctx context.Context, item hn.Item) (hn.Item, error) {
+		item.Title = strings.ToUpper(item.Title)
+		return item, nil
+	})
+
+	failing := Transform(func(ctx context.Context, item hn.Item) (hn.Item, error) {
+		return item, errors.New("boom")
+	})
+
+	type testcase struct {
+		name          string
+		processors    []Processor
+		item          hn.Item
+		expectedItems []hn.Item
+		expectedErr   bool
+	}
+
+	tests := []testcase{
+		{
+			name:          "no processors",
+			item:          hn.Item{ID: 1, Title: "intro"},
+			expectedItems: []hn.Item{{ID: 1, Title: "intro"}},
+		},
+		{
+			name:          "filters dead items",
+			processors:    []Processor{SkipDeadOrDeleted()},
+			item:          hn.Item{ID: 1, Dead: true},
+			expectedItems: nil,
+		},
+		{
+			name:          "filters deleted items",
+			processors:    []Processor{SkipDeadOrDeleted()},
+			item:          hn.Item{ID: 1, Deleted: true},
+			expectedItems: nil,
+		},
+		{
+			name:          "transforms items",
+			processors:    []Processor{SkipDeadOrDeleted(), upperTitle},
+			item:          hn.Item{ID: 1, Title: "intro"},
+			expectedItems: []hn.Item{{ID: 1, Title: "INTRO"}},
+		},
+		{
+			name:          "filters before transforming",
+			processors:    []Processor{SkipDeadOrDeleted(), failing},
+			item:          hn.Item{ID: 1, Dead: true},
+			expectedItems: nil,
+		},
+		{
+			name:          "stops on error",
+			processors:    []Processor{failing, upperTitle},
+			item:          hn.Item{ID: 1, Title: "intro"},
+			expectedItems: nil,
+			expectedErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received []hn.Item
+			sink := func(ctx context.Context, item hn.Item) error {
+				received = append(received, item)
+				return nil
+			}
+
+			err := chain(tt.processors, []Handler{sink})(context.TODO(), tt.item)
+
+			if tt.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedItems, received)
+		})
+	}
+}
+
+// recordingQueue records published message ids, failing once fail messages have been published
+type recordingQueue struct {
+	published []int
+	fail      int
+}
+
+func (q *recordingQueue) Publish(msg *queue.Message) error {
+	if q.fail > 0 && len(q.published) == q.fail {
+		return errors.New("channel closed")
+	}
+
+	q.published = append(q.published, msg.ID)
+	return nil
+}
+
+func (q *recordingQueue) Consume(ctx context.Context) (<-chan *queue.Message, error) {
+	return nil, nil
+}
+
+func TestEnqueueChildren(t *testing.T) {
+	type testcase struct {
+		name              string
+		item              hn.Item
+		stored            []int
+		storedErr         error
+		fail              int
+		expectedPublished []int
+		expectedErr       bool
+	}
+
+	tests := []testcase{
+		{
+			name:              "story with comments",
+			item:              hn.Item{ID: 1, Type: "story", Kids: []int{3, 2}},
+			expectedPublished: []int{3, 2},
+		},
+		{
+			name:   "re-fetched story without new comments",
+			item:   hn.Item{ID: 1, Type: "story", Kids: []int{3, 2}},
+			stored: []int{2, 3},
+		},
+		{
+			name:              "re-fetched story with a new comment",
+			item:              hn.Item{ID: 1, Type: "story", Kids: []int{4, 3, 2}},
+			stored:            []int{2, 3},
+			expectedPublished: []int{4},
+		},
+		{
+			name:              "re-fetched story with a comment that was never stored",
+			item:              hn.Item{ID: 1, Type: "story", Kids: []int{4, 3, 2}},
+			stored:            []int{2, 4},
+			expectedPublished: []int{3},
+		},
+		{
+			name:        "lookup failure",
+			item:        hn.Item{ID: 1, Type: "story", Kids: []int{3, 2}},
+			storedErr:   errors.New("connection reset"),
+			expectedErr: true,
+		},
+		{
+			name:              "poll with options and comments",
+			item:              hn.Item{ID: 1, Type: "poll", Kids: []int{4}, Parts: []int{2, 3}},
+			expectedPublished: []int{2, 3, 4},
+		},
+		{
+			name: "comment without replies",
+			item: hn.Item{ID: 1, Type: "comment", Parent: 5},
+		},
+		{
+			name:              "publish failure",
+			item:              hn.Item{ID: 1, Type: "story", Kids: []int{2, 3}},
+			fail:              1,
+			expectedPublished: []int{2},
+			expectedErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &recordingQueue{fail: tt.fail}
+
+			var stored []models.Item
+			for _, id := range tt.stored {
+				stored = append(stored, models.Item{ID: id, Type: "comment"})
+			}
+
+			db := &database.Mock{}
+			db.On("GetMany", context.TODO(), mock.Anything).Return(stored, tt.storedErr)
+
+			err := EnqueueChildren(q, db)(context.TODO(), tt.item)
+
+			if tt.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedPublished, q.published)
+		})
+	}
+}
+
+func TestToModelParent(t *testing.T) {
+	comment := toModel(hn.Item{ID: 2, Type: "comment", Parent: 1, Kids: []int{3}})
+	assert.Equal(t, 1, comment.Parent)
+	assert.Equal(t, []int{3}, comment.Kids)
+
+	option := toModel(hn.Item{ID: 2, Type: "pollopt", Poll: 1})
+	assert.Equal(t, 1, option.Parent, "poll options belong to their poll")
+}
@@ -4,67 +4,244 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/invalidation"
 	"github.com/alexdunne/gs-onboarding/internal/models"
 	"github.com/alexdunne/gs-onboarding/internal/queue"
 	"github.com/alexdunne/gs-onboarding/pkg/hn"
 	"go.uber.org/zap"
 )
 
-// Worker is responsible for fetching items and inserting the items in the database
+// Worker is responsible for fetching items, passing them through the processing pipeline and
+// inserting the resulting items in the database in batches
 type Worker struct {
-	logger *zap.Logger
-	db     database.Database
-	hn     hn.Client
+	logger        *zap.Logger
+	db            database.Database
+	hn            hn.Client
+	processors    []Processor
+	sinks         []Handler
+	batchSize     int
+	flushInterval time.Duration
+	invalidator   invalidation.Publisher
 }
 
-// NewWorker creates a new worker
-func NewWorker(logger *zap.Logger, db database.Database, hn hn.Client) *Worker {
-	return &Worker{
-		logger: logger,
-		db:     db,
-		hn:     hn,
+// WorkerOption is an interface for a functional option
+type WorkerOption func(w *Worker)
+
+// WithBatchSize is a functional option to configure how many items are written to the database at once
+func WithBatchSize(size int) WorkerOption {
+	return func(w *Worker) {
+		w.batchSize = size
+	}
+}
+
+// WithFlushInterval is a functional option to configure how often a partially filled batch is written to the database
+func WithFlushInterval(interval time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.flushInterval = interval
+	}
+}
+
+// WithInvalidator is a functional option to announce written items so caches can evict them
+func WithInvalidator(p invalidation.Publisher) WorkerOption {
+	return func(w *Worker) {
+		w.invalidator = p
+	}
+}
+
+// NewWorker creates a new worker which skips dead or deleted items and inserts everything else in the database
+func NewWorker(logger *zap.Logger, db database.Database, hn hn.Client, opts ...WorkerOption) *Worker {
+	w := &Worker{
+		logger:        logger,
+		db:            db,
+		hn:            hn,
+		processors:    []Processor{SkipDeadOrDeleted()},
+		batchSize:     100,
+		flushInterval: time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(w)
 	}
+
+	return w
+}
+
+// Use appends processors to the pipeline. Processors run in the order they are registered, before any sink.
+// It must be called before Run
+func (w *Worker) Use(processors ...Processor) {
+	w.processors = append(w.processors, processors...)
+}
+
+// AddSink registers an additional destination for items that make it through the pipeline.
+// Sinks run for each item once the batch holding it has been written to the database, and before its
+// message is acknowledged, so they never see items that weren't stored. It must be called before Run
+func (w *Worker) AddSink(sink Handler) {
+	w.sinks = append(w.sinks, sink)
+}
+
+// pending is an item waiting to be written along with the message it came from
+type pending struct {
+	item models.Item
+	// fetched is the item as it left the processors, which is what sinks are given
+	fetched hn.Item
+	msg     *queue.Message
 }
 
-// Run is responsible for processing messages
+// Run is responsible for processing messages until the message channel is closed, at which point any
+// batched items are written. Cancelling ctx aborts the work in progress and returns it to the queue
 func (w *Worker) Run(ctx context.Context, message <-chan *queue.Message, wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	var (
+		batch    []pending
+		accepted *hn.Item
+	)
+
+	// the final stage records the item so it can be batched with the message it came from
+	pipeline := chain(w.processors, []Handler{func(ctx context.Context, item hn.Item) error {
+		accepted = &item
+		return nil
+	}})
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
+			for _, p := range batch {
+				w.nack(p.msg, true)
+			}
 			return
+		case <-ticker.C:
+			batch = w.flush(ctx, batch)
 		case msg, ok := <-message:
 			if !ok {
+				w.flush(ctx, batch)
 				return
 			}
 
-			w.logger.Info("processing message", zap.Int("id", msg.ID))
-
-			item, err := w.hn.FetchItem(msg.ID)
-			if err != nil {
-				w.logger.Error(fmt.Sprintf("fetching item id %d", msg.ID), zap.Error(err))
+			accepted = nil
+			if !w.process(ctx, pipeline, msg) {
 				continue
 			}
 
-			if item.Dead || item.Deleted {
-				// ignore dead or deleted items
+			if accepted == nil {
+				// the item was filtered out so there is nothing left to write
+				w.ack(msg)
 				continue
 			}
 
-			w.logger.Info("inserting item", zap.Int("id", item.ID))
-			w.db.Write(ctx, models.Item{
-				ID:        item.ID,
-				Type:      string(item.Type),
-				Content:   item.Text,
-				URL:       item.URL,
-				Score:     item.Score,
-				Title:     item.Title,
-				CreatedAt: item.CreatedAt,
-				CreatedBy: item.CreatedBy,
-			})
+			batch = append(batch, pending{item: toModel(*accepted), fetched: *accepted, msg: msg})
+			if len(batch) >= w.batchSize {
+				batch = w.flush(ctx, batch)
+			}
 		}
 	}
 }
+
+// process fetches the item for msg and runs it through the processors. It reports false if the message was rejected
+func (w *Worker) process(ctx context.Context, pipeline Handler, msg *queue.Message) bool {
+	w.logger.Info("processing message", zap.Int("id", msg.ID))
+
+	item, err := w.hn.FetchItem(ctx, msg.ID)
+	if err != nil {
+		requeue := retryable(ctx, err)
+		w.logger.Error(fmt.Sprintf("fetching item id %d", msg.ID), zap.Bool("requeue", requeue), zap.Error(err))
+		w.nack(msg, requeue)
+		return false
+	}
+
+	if err := pipeline(ctx, *item); err != nil {
+		requeue := retryable(ctx, err)
+		w.logger.Error(fmt.Sprintf("processing item id %d", msg.ID), zap.Bool("requeue", requeue), zap.Error(err))
+		w.nack(msg, requeue)
+		return false
+	}
+
+	return true
+}
+
+// flush writes the batch to the database and only then hands each item to the sinks and acknowledges its
+// message. It returns an emptied batch
+func (w *Worker) flush(ctx context.Context, batch []pending) []pending {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	items := make([]models.Item, len(batch))
+	for i, p := range batch {
+		items[i] = p.item
+	}
+
+	w.logger.Info("inserting items", zap.Int("count", len(items)))
+	if err := w.db.WriteBatch(ctx, items); err != nil {
+		// failures such as a lost connection are returned to the queue to be written again, while the
+		// messages of batches that can never be written are dropped rather than redelivered forever
+		requeue := retryable(ctx, err)
+		w.logger.Error(fmt.Sprintf("inserting %d items", len(items)), zap.Bool("requeue", requeue), zap.Error(err))
+		for _, p := range batch {
+			w.nack(p.msg, requeue)
+		}
+
+		return batch[:0]
+	}
+
+	for _, p := range batch {
+		w.deliver(ctx, p)
+	}
+
+	if w.invalidator != nil {
+		ids := make([]int, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+		}
+
+		// caches fall back to their TTL if this fails so the batch is still considered written
+		if err := w.invalidator.Publish(ctx, ids); err != nil {
+			w.logger.Error("publishing cache invalidation", zap.Error(err))
+		}
+	}
+
+	return batch[:0]
+}
+
+// deliver hands a written item to every sink and then acknowledges its message. When a sink fails the
+// message is rejected instead, and returned to the queue if the failure may succeed when retried, so the
+// item is fetched again and every sink runs again
+func (w *Worker) deliver(ctx context.Context, p pending) {
+	for _, sink := range w.sinks {
+		if err := sink(ctx, p.fetched); err != nil {
+			requeue := retryable(ctx, err)
+			w.logger.Error(fmt.Sprintf("delivering item id %d", p.msg.ID), zap.Bool("requeue", requeue), zap.Error(err))
+			w.nack(p.msg, requeue)
+			return
+		}
+	}
+
+	w.ack(p.msg)
+}
+
+// retryable reports whether a failed message should be returned to the queue, either because the worker
+// is stopping or because the failure, such as a lost connection to hacker news, the database or the
+// queue, may succeed when retried
+func retryable(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || database.IsTransient(err) || queue.IsTransient(err)
+}
+
+func (w *Worker) ack(msg *queue.Message) {
+	if err := msg.Ack(); err != nil {
+		w.logger.Error("acknowledging message", zap.Int("id", msg.ID), zap.Error(err))
+	}
+}
+
+// nack rejects a message, returning it to the queue for another attempt when requeue is set. Messages
+// interrupted by a shutdown are requeued so another worker can pick them up
+func (w *Worker) nack(msg *queue.Message, requeue bool) {
+	if err := msg.Nack(requeue); err != nil {
+		w.logger.Error("rejecting message", zap.Int("id", msg.ID), zap.Error(err))
+	}
+}
@@ -2,11 +2,19 @@ package consumer
 
 import (
 	"context"
+	"errors"
+	"net"
+	"net/url"
 	"sync"
 	"testing"
 
 	"github.com/alexdunne/gs-onboarding/internal/database"
+	"github.com/alexdunne/gs-onboarding/internal/invalidation"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/alexdunne/gs-onboarding/internal/queue"
 	"github.com/alexdunne/gs-onboarding/pkg/hn"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
 )
@@ -17,6 +25,7 @@ func TestWorkerRun(t *testing.T) {
 		database    *database.Mock
 		hn          *hn.Mock
 		ids         []int
+		opts        []WorkerOption
 		expectMocks func(t *testing.T, dbMock *database.Mock, hnMock *hn.Mock)
 	}
 
@@ -27,8 +36,8 @@ func TestWorkerRun(t *testing.T) {
 			hn:       &hn.Mock{},
 			ids:      []int{1},
 			expectMocks: func(t *testing.T, dbMock *database.Mock, hnMock *hn.Mock) {
-				hnMock.On("FetchItem", 1).Return(&hn.Item{ID: 1}, nil)
-				dbMock.On("Write", context.TODO(), mock.AnythingOfType("models.Item")).Return(nil)
+				hnMock.On("FetchItem", context.TODO(), 1).Return(&hn.Item{ID: 1}, nil)
+				dbMock.On("WriteBatch", context.TODO(), mock.AnythingOfType("[]models.Item")).Return(nil)
 			},
 		},
 		{
@@ -37,10 +46,30 @@ func TestWorkerRun(t *testing.T) {
 			hn:       &hn.Mock{},
 			ids:      []int{1, 2, 3},
 			expectMocks: func(t *testing.T, dbMock *database.Mock, hnMock *hn.Mock) {
-				hnMock.On("FetchItem", 1).Return(&hn.Item{ID: 1}, nil)
-				hnMock.On("FetchItem", 2).Return(&hn.Item{ID: 2}, nil)
-				hnMock.On("FetchItem", 3).Return(&hn.Item{ID: 3}, nil)
-				dbMock.On("Write", context.TODO(), mock.AnythingOfType("models.Item")).Return(nil).Times(3)
+				hnMock.On("FetchItem", context.TODO(), 1).Return(&hn.Item{ID: 1}, nil)
+				hnMock.On("FetchItem", context.TODO(), 2).Return(&hn.Item{ID: 2}, nil)
+				hnMock.On("FetchItem", context.TODO(), 3).Return(&hn.Item{ID: 3}, nil)
+				dbMock.On("WriteBatch", context.TODO(), mock.MatchedBy(func(items []models.Item) bool {
+					return len(items) == 3
+				})).Return(nil).Once()
+			},
+		},
+		{
+			name:     "three items in batches of two",
+			database: &database.Mock{},
+			hn:       &hn.Mock{},
+			ids:      []int{1, 2, 3},
+			opts:     []WorkerOption{WithBatchSize(2)},
+			expectMocks: func(t *testing.T, dbMock *database.Mock, hnMock *hn.Mock) {
+				hnMock.On("FetchItem", context.TODO(), 1).Return(&hn.Item{ID: 1}, nil)
+				hnMock.On("FetchItem", context.TODO(), 2).Return(&hn.Item{ID: 2}, nil)
+				hnMock.On("FetchItem", context.TODO(), 3).Return(&hn.Item{ID: 3}, nil)
+				dbMock.On("WriteBatch", context.TODO(), mock.MatchedBy(func(items []models.Item) bool {
+					return len(items) == 2
+				})).Return(nil).Once()
+				dbMock.On("WriteBatch", context.TODO(), mock.MatchedBy(func(items []models.Item) bool {
+					return len(items) == 1
+				})).Return(nil).Once()
 			},
 		},
 		{
@@ -49,9 +78,22 @@ func TestWorkerRun(t *testing.T) {
 			hn:       &hn.Mock{},
 			ids:      []int{1, 2, 3},
 			expectMocks: func(t *testing.T, dbMock *database.Mock, hnMock *hn.Mock) {
-				hnMock.On("FetchItem", 1).Return(&hn.Item{ID: 1, Dead: true}, nil)
-				hnMock.On("FetchItem", 2).Return(&hn.Item{ID: 2, Deleted: true}, nil)
-				hnMock.On("FetchItem", 3).Return(&hn.Item{ID: 3, Dead: true, Deleted: true}, nil)
+				hnMock.On("FetchItem", context.TODO(), 1).Return(&hn.Item{ID: 1, Dead: true}, nil)
+				hnMock.On("FetchItem", context.TODO(), 2).Return(&hn.Item{ID: 2, Deleted: true}, nil)
+				hnMock.On("FetchItem", context.TODO(), 3).Return(&hn.Item{ID: 3, Dead: true, Deleted: true}, nil)
+			},
+		},
+		{
+			name:     "skips items that fail to fetch",
+			database: &database.Mock{},
+			hn:       &hn.Mock{},
+			ids:      []int{1, 2},
+			expectMocks: func(t *testing.T, dbMock *database.Mock, hnMock *hn.Mock) {
+				hnMock.On("FetchItem", context.TODO(), 1).Return(&hn.Item{}, errors.New("boom"))
+				hnMock.On("FetchItem", context.TODO(), 2).Return(&hn.Item{ID: 2}, nil)
+				dbMock.On("WriteBatch", context.TODO(), mock.MatchedBy(func(items []models.Item) bool {
+					return len(items) == 1 && items[0].ID == 2
+				})).Return(nil).Once()
 			},
 		},
 	}
@@ -67,21 +109,19 @@ func TestWorkerRun(t *testing.T) {
 				panic(err)
 			}
 
-			idStream := make(chan int)
-			if len(tt.ids) > 0 {
-				go func() {
-					for _, id := range tt.ids {
-						idStream <- id
-					}
-					close(idStream)
-				}()
-			}
+			messages := make(chan *queue.Message)
+			go func() {
+				for _, id := range tt.ids {
+					messages <- &queue.Message{ID: id}
+				}
+				close(messages)
+			}()
 
-			worker := NewWorker(logger, tt.database, tt.hn)
+			worker := NewWorker(logger, tt.database, tt.hn, tt.opts...)
 			wg := &sync.WaitGroup{}
 			wg.Add(1)
 
-			go worker.run(context.TODO(), idStream, wg)
+			go worker.Run(context.TODO(), messages, wg)
 			wg.Wait()
 
 			if tt.expectMocks != nil {
@@ -91,3 +131,156 @@ func TestWorkerRun(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkerInvalidatesWrittenItems(t *testing.T) {
+	type testcase struct {
+		name        string
+		writeErr    error
+		expectMocks func(t *testing.T, invalidator *invalidation.Mock)
+	}
+
+	tests := []testcase{
+		{
+			name: "publishes written ids",
+			expectMocks: func(t *testing.T, invalidator *invalidation.Mock) {
+				invalidator.On("Publish", context.TODO(), []int{1, 2}).Return(nil).Once()
+			},
+		},
+		{
+			name:     "skips failed writes",
+			writeErr: errors.New("boom"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbMock := &database.Mock{}
+			hnMock := &hn.Mock{}
+			invalidator := &invalidation.Mock{}
+
+			hnMock.On("FetchItem", context.TODO(), 1).Return(&hn.Item{ID: 1}, nil)
+			hnMock.On("FetchItem", context.TODO(), 2).Return(&hn.Item{ID: 2}, nil)
+			dbMock.On("WriteBatch", context.TODO(), mock.AnythingOfType("[]models.Item")).Return(tt.writeErr)
+			if tt.expectMocks != nil {
+				tt.expectMocks(t, invalidator)
+			}
+
+			messages := make(chan *queue.Message)
+			go func() {
+				messages <- &queue.Message{ID: 1}
+				messages <- &queue.Message{ID: 2}
+				close(messages)
+			}()
+
+			worker := NewWorker(zap.NewNop(), dbMock, hnMock, WithInvalidator(invalidator))
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			go worker.Run(context.TODO(), messages, wg)
+			wg.Wait()
+
+			invalidator.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWorkerRunsSinksAfterWrite(t *testing.T) {
+	type testcase struct {
+		name             string
+		writeErr         error
+		expectedReceived []int
+	}
+
+	tests := []testcase{
+		{
+			name:             "written items",
+			expectedReceived: []int{1, 2},
+		},
+		{
+			name:     "failed writes",
+			writeErr: errors.New("boom"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbMock := &database.Mock{}
+			hnMock := &hn.Mock{}
+
+			written := false
+			hnMock.On("FetchItem", context.TODO(), 1).Return(&hn.Item{ID: 1}, nil)
+			hnMock.On("FetchItem", context.TODO(), 2).Return(&hn.Item{ID: 2}, nil)
+			dbMock.On("WriteBatch", context.TODO(), mock.AnythingOfType("[]models.Item")).Return(tt.writeErr).Run(func(args mock.Arguments) {
+				written = tt.writeErr == nil
+			})
+
+			var received []int
+			worker := NewWorker(zap.NewNop(), dbMock, hnMock)
+			worker.AddSink(func(ctx context.Context, item hn.Item) error {
+				assert.True(t, written, "sinks run once the batch is written")
+				received = append(received, item.ID)
+				return nil
+			})
+
+			messages := make(chan *queue.Message)
+			go func() {
+				messages <- &queue.Message{ID: 1}
+				messages <- &queue.Message{ID: 2}
+				close(messages)
+			}()
+
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+
+			go worker.Run(context.TODO(), messages, wg)
+			wg.Wait()
+
+			assert.Equal(t, tt.expectedReceived, received)
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	type testcase struct {
+		name     string
+		ctx      context.Context
+		err      error
+		expected bool
+	}
+
+	tests := []testcase{
+		{
+			name:     "lost connection to hacker news",
+			ctx:      context.TODO(),
+			err:      &url.Error{Op: "Get", URL: "https://hacker-news.firebaseio.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}},
+			expected: true,
+		},
+		{
+			name:     "closed queue channel",
+			ctx:      context.TODO(),
+			err:      amqp.ErrClosed,
+			expected: true,
+		},
+		{
+			name:     "malformed item",
+			ctx:      context.TODO(),
+			err:      errors.New("invalid character '<' looking for beginning of value"),
+			expected: false,
+		},
+		{
+			name:     "stopping worker",
+			ctx:      cancelled,
+			err:      errors.New("invalid character '<' looking for beginning of value"),
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, retryable(tt.ctx, tt.err))
+		})
+	}
+}
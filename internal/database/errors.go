@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+)
+
+// transientClasses are the SQLSTATE classes of failures that may succeed when retried: connection
+// exceptions, rolled back transactions such as deadlocks, insufficient resources and operator
+// intervention such as a server restart
+var transientClasses = []string{"08", "40", "53", "57"}
+
+// IsTransient reports whether err is a failure that may succeed when retried, such as a lost
+// connection or a timeout, rather than a problem with the query or the data
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		for _, class := range transientClasses {
+			if strings.HasPrefix(pgErr.Code, class) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
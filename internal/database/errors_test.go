@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	type testcase struct {
+		name     string
+		err      error
+		expected bool
+	}
+
+	tests := []testcase{
+		{name: "no error", err: nil, expected: false},
+		{name: "timeout", err: errors.Wrap(context.DeadlineExceeded, "writing batch"), expected: true},
+		{name: "connection lost", err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, expected: true},
+		{name: "deadlock", err: errors.Wrap(&pgconn.PgError{Code: "40P01"}, "writing batch"), expected: true},
+		{name: "server shutting down", err: &pgconn.PgError{Code: "57P01"}, expected: true},
+		{name: "constraint violation", err: &pgconn.PgError{Code: "23505"}, expected: false},
+		{name: "cancelled", err: context.Canceled, expected: false},
+		{name: "other", err: errors.New("boom"), expected: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsTransient(tc.err))
+		})
+	}
+}
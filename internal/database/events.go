@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/pkg/errors"
+)
+
+const eventsChannel = "item_events"
+
+// ListenEvents blocks until ctx is cancelled or the connection fails, calling notify whenever an
+// item event is recorded. Notifications may be coalesced so listeners should read every event
+// after the last one they saw rather than relying on one call per event
+func (c *Client) ListenEvents(ctx context.Context, notify func()) error {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, "acquiring listen connection")
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+eventsChannel); err != nil {
+		return errors.Wrap(err, "listening for item events")
+	}
+
+	// the connection goes back to the pool so it must stop listening, even if ctx has been cancelled
+	defer func() {
+		unlistenCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		conn.Exec(unlistenCtx, "UNLISTEN "+eventsChannel)
+	}()
+
+	for {
+		if _, err := conn.Conn().WaitForNotification(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return errors.Wrap(err, "waiting for item events")
+		}
+
+		notify()
+	}
+}
+
+// EventsAfter fetches up to limit events after position, in the order their transactions committed.
+// Events of transactions that are still in progress, or that started after one still in progress, are
+// held back until it finishes so nothing can later appear before the last event returned. Created and
+// updated events include the current state of the item
+func (c *Client) EventsAfter(ctx context.Context, after models.EventPosition, limit int) ([]models.ItemEvent, error) {
+	sql := `
+	SELECT
+		e.id, e.tx_id, e.kind, e.item_id, e.created_at,
+		i.id AS stored_id, i.type, i.content, i.url, i.score, i.title,
+		i.created_at AS stored_created_at, i.created_by, i.version, i.updated_at,
+		i.parent, i.kids, i.parts, i.descendants
+	FROM item_events e
+	LEFT JOIN items i ON i.id = e.item_id AND e.kind <> 'deleted'
+	WHERE (e.tx_id, e.id) > ($1, $2) AND e.tx_id < txid_snapshot_xmin(txid_current_snapshot())
+	ORDER BY e.tx_id, e.id
+	LIMIT $3
+	`
+
+	var rows []struct {
+		ID              int64      `db:"id"`
+		TxID            int64      `db:"tx_id"`
+		Kind            string     `db:"kind"`
+		ItemID          int        `db:"item_id"`
+		CreatedAt       time.Time  `db:"created_at"`
+		StoredID        *int       `db:"stored_id"`
+		Type            *string    `db:"type"`
+		Content         *string    `db:"content"`
+		URL             *string    `db:"url"`
+		Score           *int       `db:"score"`
+		Title           *string    `db:"title"`
+		StoredCreatedAt *time.Time `db:"stored_created_at"`
+		CreatedBy       *string    `db:"created_by"`
+		Version         *int       `db:"version"`
+		UpdatedAt       *time.Time `db:"updated_at"`
+		Parent          *int       `db:"parent"`
+		Kids            []int      `db:"kids"`
+		Parts           []int      `db:"parts"`
+		Descendants     *int       `db:"descendants"`
+	}
+	if err := pgxscan.Select(ctx, c.pool, &rows, sql, after.TxID, after.ID, limit); err != nil {
+		return nil, errors.Wrap(err, "fetching item events")
+	}
+
+	events := make([]models.ItemEvent, len(rows))
+	for i, row := range rows {
+		events[i] = models.ItemEvent{
+			ID:        row.ID,
+			TxID:      row.TxID,
+			Kind:      row.Kind,
+			ItemID:    row.ItemID,
+			CreatedAt: row.CreatedAt,
+		}
+
+		// the item may have been deleted since the event was recorded
+		if row.StoredID != nil {
+			events[i].Item = &models.Item{
+				ID:          *row.StoredID,
+				Type:        *row.Type,
+				Content:     *row.Content,
+				URL:         *row.URL,
+				Score:       *row.Score,
+				Title:       *row.Title,
+				CreatedAt:   *row.StoredCreatedAt,
+				CreatedBy:   *row.CreatedBy,
+				Version:     *row.Version,
+				UpdatedAt:   *row.UpdatedAt,
+				Parent:      *row.Parent,
+				Kids:        row.Kids,
+				Parts:       row.Parts,
+				Descendants: *row.Descendants,
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// LatestEventPosition returns a position after every event that can be read now and before any that
+// may be read later
+func (c *Client) LatestEventPosition(ctx context.Context) (models.EventPosition, error) {
+	var txID int64
+	if err := c.pool.QueryRow(ctx, `SELECT txid_snapshot_xmin(txid_current_snapshot())`).Scan(&txID); err != nil {
+		return models.EventPosition{}, errors.Wrap(err, "fetching latest event position")
+	}
+
+	// event ids start at one so this is before every event of the oldest transaction in progress
+	return models.EventPosition{TxID: txID}, nil
+}
+
+// PruneEvents deletes events older than the retention period. Watchers can't resume from pruned events
+func (c *Client) PruneEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	// compared against the database clock, which the events were recorded with
+	tag, err := c.pool.Exec(
+		ctx,
+		`DELETE FROM item_events WHERE created_at < now() - $1 * interval '1 millisecond'`,
+		retention.Milliseconds(),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "pruning item events")
+	}
+
+	return tag.RowsAffected(), nil
+}
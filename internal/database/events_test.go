@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsAfter(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	err := testDB.reset()
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+	item := models.Item{
+		ID:        1,
+		Type:      "story",
+		Content:   "Hello, world",
+		URL:       "gymshark.com",
+		Score:     10,
+		Title:     "Intro",
+		CreatedAt: time.Now(),
+		CreatedBy: "shark boi",
+	}
+
+	require.NoError(t, client.WriteBatch(ctx, []models.Item{item}))
+
+	// writing the same item again shouldn't record an update
+	require.NoError(t, client.WriteBatch(ctx, []models.Item{item}))
+
+	item.Score = 20
+	require.NoError(t, client.WriteBatch(ctx, []models.Item{item}))
+
+	_, err = client.pool.Exec(ctx, `DELETE FROM items WHERE id = 1`)
+	require.NoError(t, err)
+
+	events, err := client.EventsAfter(ctx, models.EventPosition{}, 10)
+	require.NoError(t, err)
+
+	kinds := []string{}
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+		assert.Equal(t, 1, e.ItemID)
+		// the item no longer exists so none of the events can include it
+		assert.Nil(t, e.Item)
+	}
+	assert.Equal(t, []string{models.ItemCreated, models.ItemUpdated, models.ItemDeleted}, kinds)
+
+	latest, err := client.LatestEventPosition(ctx)
+	require.NoError(t, err)
+	assert.True(t, latest.After(events[len(events)-1].Position()))
+
+	events, err = client.EventsAfter(ctx, latest, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestEventsAfterCommitOrder(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	err := testDB.reset()
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+	// the first item's event gets the lower id but its transaction commits last
+	tx, err := client.pool.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `INSERT INTO items (id, type, content, url, title, created_at, created_by) VALUES (1, 'story', '', '', 'Intro', now(), 'shark boi')`)
+	require.NoError(t, err)
+
+	require.NoError(t, client.WriteBatch(ctx, []models.Item{{ID: 2, Type: "story", Title: "Intro", CreatedAt: time.Now(), CreatedBy: "shark boi"}}))
+
+	// the second item's event waits for the open transaction so it can't be read ahead of the first
+	events, err := client.EventsAfter(ctx, models.EventPosition{}, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	require.NoError(t, tx.Commit(ctx))
+
+	events, err = client.EventsAfter(ctx, models.EventPosition{}, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	ids := []int{}
+	for _, e := range events {
+		ids = append(ids, e.ItemID)
+	}
+	assert.Equal(t, []int{1, 2}, ids)
+
+	// nothing is read twice after the last event
+	events, err = client.EventsAfter(ctx, events[len(events)-1].Position(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -2,18 +2,26 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/alexdunne/gs-onboarding/internal/models"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 )
 
+// ErrNotFound is returned when a requested item does not exist
+var ErrNotFound = errors.New("item not found")
+
 // Database is a interface to expose methods to fetch and store items
 type Database interface {
-	GetAll(ctx context.Context) ([]models.Item, error)
-	GetStories(ctx context.Context) ([]models.Item, error)
-	GetJobs(ctx context.Context) ([]models.Item, error)
+	List(ctx context.Context, q ListQuery) ([]models.Item, error)
+	Iterate(ctx context.Context, q ListQuery) (ItemIterator, error)
+	Get(ctx context.Context, id int) (models.Item, error)
+	GetMany(ctx context.Context, ids []int) ([]models.Item, error)
+	ScoreHistories(ctx context.Context, ids []int, since time.Time, limit int) (map[int][]models.ScoreSample, error)
+	Search(ctx context.Context, q SearchQuery) ([]models.SearchResult, error)
 	Write(ctx context.Context, item models.Item) error
+	WriteBatch(ctx context.Context, items []models.Item) error
 }
 
 // Client for database
@@ -31,6 +39,11 @@ func New(ctx context.Context, connStr string) (*Client, error) {
 	return &Client{pool: pool}, nil
 }
 
+// Ping checks a connection to the database can be made
+func (c *Client) Ping(ctx context.Context) error {
+	return c.pool.Ping(ctx)
+}
+
 // Close closes db connection
 func (c *Client) Close() {
 	c.pool.Close()
@@ -6,47 +6,43 @@ import (
 
 	"github.com/alexdunne/gs-onboarding/internal/models"
 	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
 	"github.com/pkg/errors"
 )
 
-// GetAll fetches all items from the database
-func (c *Client) GetAll(ctx context.Context) ([]models.Item, error) {
-	var items []models.Item
-	err := pgxscan.Select(ctx, c.pool, &items, `SELECT id, type, content, url, score, title, created_at, created_by FROM items`)
-	if err != nil {
-		return nil, err
-	}
-
-	return items, nil
-}
-
-// GetStories fetches all story items from the database
-func (c *Client) GetStories(ctx context.Context) ([]models.Item, error) {
-	var items []models.Item
-	err := pgxscan.Select(
+// Get fetches a single item from the database, returning ErrNotFound if it does not exist
+func (c *Client) Get(ctx context.Context, id int) (models.Item, error) {
+	var item models.Item
+	err := pgxscan.Get(
 		ctx,
 		c.pool,
-		&items,
-		`SELECT id, type, content, url, score, title, created_at, created_by FROM items WHERE type = 'story'`,
+		&item,
+		`SELECT id, type, content, url, score, title, created_at, created_by, version, updated_at, parent, kids, parts, descendants FROM items WHERE id = $1`,
+		id,
 	)
 	if err != nil {
-		return nil, err
+		if pgxscan.NotFound(err) {
+			return models.Item{}, ErrNotFound
+		}
+
+		return models.Item{}, errors.Wrap(err, fmt.Sprintf("fetching item (id: %d)", id))
 	}
 
-	return items, nil
+	return item, nil
 }
 
-// GetJobs fetches all job items from the database
-func (c *Client) GetJobs(ctx context.Context) ([]models.Item, error) {
+// GetMany fetches the items with the given ids from the database. Ids that do not exist are skipped
+func (c *Client) GetMany(ctx context.Context, ids []int) ([]models.Item, error) {
 	var items []models.Item
 	err := pgxscan.Select(
 		ctx,
 		c.pool,
 		&items,
-		`SELECT id, type, content, url, score, title, created_at, created_by FROM items WHERE type = 'job'`,
+		`SELECT id, type, content, url, score, title, created_at, created_by, version, updated_at, parent, kids, parts, descendants FROM items WHERE id = ANY($1)`,
+		ids,
 	)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, fmt.Sprintf("fetching %d items", len(ids)))
 	}
 
 	return items, nil
@@ -55,17 +51,82 @@ func (c *Client) GetJobs(ctx context.Context) ([]models.Item, error) {
 // Write inserts an item into the database
 func (c *Client) Write(ctx context.Context, item models.Item) error {
 	sql := `
-	INSERT INTO items (id, type, content, url, score, title, created_by, created_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	INSERT INTO items (id, type, content, url, score, title, created_by, created_at, parent, kids, parts, descendants)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	ON CONFLICT (id) DO NOTHING
 	`
 
 	if _, err := c.pool.Exec(
 		ctx, sql, item.ID, item.Type, item.Content, item.URL,
 		item.Score, item.Title, item.CreatedBy, item.CreatedAt,
+		item.Parent, item.Kids, item.Parts, item.Descendants,
 	); err != nil {
 		return errors.Wrap(err, fmt.Sprintf("inserting item (id: %d)", item.ID))
 	}
 
 	return nil
 }
+
+// WriteBatch inserts or updates a collection of items in the database in a single transaction.
+// Items are copied into a staging table and then merged, updating any that have changed so re-fetched
+// items, such as re-scored stories, are kept current and watchers are sent their updates
+func (c *Client) WriteBatch(ctx context.Context, items []models.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "starting batch transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	// seq numbers the staged rows in the order they were copied
+	if _, err := tx.Exec(ctx, `CREATE TEMP TABLE items_staging (LIKE items INCLUDING DEFAULTS, seq serial) ON COMMIT DROP`); err != nil {
+		return errors.Wrap(err, "creating staging table")
+	}
+
+	columns := []string{"id", "type", "content", "url", "score", "title", "created_by", "created_at", "parent", "kids", "parts", "descendants"}
+	rows := pgx.CopyFromSlice(len(items), func(i int) ([]interface{}, error) {
+		item := items[i]
+		return []interface{}{
+			item.ID, item.Type, item.Content, item.URL,
+			item.Score, item.Title, item.CreatedBy, item.CreatedAt,
+			item.Parent, item.Kids, item.Parts, item.Descendants,
+		}, nil
+	})
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"items_staging"}, columns, rows); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("copying %d items", len(items)))
+	}
+
+	// a row can only be updated once per statement so duplicate ids are collapsed first, keeping the last
+	// fetched version. Only rows that actually changed are updated so re-fetching an item doesn't record a
+	// spurious update event
+	sql := `
+	INSERT INTO items (id, type, content, url, score, title, created_by, created_at, parent, kids, parts, descendants)
+	SELECT DISTINCT ON (id) id, type, content, url, score, title, created_by, created_at, parent, kids, parts, descendants
+	FROM items_staging
+	ORDER BY id, seq DESC
+	ON CONFLICT (id) DO UPDATE SET
+		content = EXCLUDED.content,
+		url = EXCLUDED.url,
+		score = EXCLUDED.score,
+		title = EXCLUDED.title,
+		kids = EXCLUDED.kids,
+		parts = EXCLUDED.parts,
+		descendants = EXCLUDED.descendants
+	WHERE (items.content, items.url, items.score, items.title, items.kids, items.parts, items.descendants)
+		IS DISTINCT FROM (EXCLUDED.content, EXCLUDED.url, EXCLUDED.score, EXCLUDED.title, EXCLUDED.kids, EXCLUDED.parts, EXCLUDED.descendants)
+	`
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return errors.Wrap(err, "merging staged items")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "committing batch transaction")
+	}
+
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/alexdunne/gs-onboarding/internal/models"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var testDB *TestDatabase
@@ -30,7 +31,7 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
-func TestGetAll(t *testing.T) {
+func TestWriteBatch(t *testing.T) {
 	client := &Client{
 		pool: testDB.pool,
 	}
@@ -38,7 +39,10 @@ func TestGetAll(t *testing.T) {
 	type testcase struct {
 		name              string
 		seed              func(ctx context.Context)
+		items             []models.Item
 		expectedItemCount int
+		// expectedItems are checked by id against the stored items
+		expectedItems []models.Item
 	}
 
 	tests := []testcase{
@@ -47,28 +51,16 @@ func TestGetAll(t *testing.T) {
 			seed: func(ctx context.Context) {
 				// no-op
 			},
+			items:             []models.Item{},
 			expectedItemCount: 0,
 		},
-		{
-			name: "one story",
-			seed: func(ctx context.Context) {
-				client.Write(ctx, models.Item{
-					ID:        1,
-					Type:      "story",
-					Content:   "Hello, world",
-					URL:       "gymshark.com",
-					Score:     10,
-					Title:     "Intro",
-					CreatedAt: time.Now(),
-					CreatedBy: "shark boi",
-				})
-			},
-			expectedItemCount: 1,
-		},
 		{
 			name: "one story and one job",
 			seed: func(ctx context.Context) {
-				client.Write(ctx, models.Item{
+				// no-op
+			},
+			items: []models.Item{
+				{
 					ID:        1,
 					Type:      "story",
 					Content:   "Hello, world",
@@ -77,9 +69,8 @@ func TestGetAll(t *testing.T) {
 					Title:     "Intro",
 					CreatedAt: time.Now(),
 					CreatedBy: "shark boi",
-				})
-
-				client.Write(ctx, models.Item{
+				},
+				{
 					ID:        2,
 					Type:      "job",
 					Content:   "Work for us",
@@ -88,50 +79,12 @@ func TestGetAll(t *testing.T) {
 					Title:     "Senior Software Engineer",
 					CreatedAt: time.Now(),
 					CreatedBy: "lava gurl",
-				})
+				},
 			},
 			expectedItemCount: 2,
 		},
-	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			err := testDB.reset()
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			ctx := context.TODO()
-			tc.seed(ctx)
-			items, err := client.GetAll(ctx)
-
-			assert.Equal(t, tc.expectedItemCount, len(items))
-			assert.NoError(t, err)
-		})
-	}
-}
-
-func TestGetStories(t *testing.T) {
-	client := &Client{
-		pool: testDB.pool,
-	}
-
-	type testcase struct {
-		name              string
-		seed              func(ctx context.Context)
-		expectedItemCount int
-	}
-
-	tests := []testcase{
-		{
-			name: "no items",
-			seed: func(ctx context.Context) {
-				// no-op
-			},
-			expectedItemCount: 0,
-		},
 		{
-			name: "one story",
+			name: "updates changed items",
 			seed: func(ctx context.Context) {
 				client.Write(ctx, models.Item{
 					ID:        1,
@@ -144,39 +97,28 @@ func TestGetStories(t *testing.T) {
 					CreatedBy: "shark boi",
 				})
 			},
-			expectedItemCount: 1,
-		},
-		{
-			name: "one job",
-			seed: func(ctx context.Context) {
-				client.Write(ctx, models.Item{
-					ID:        2,
-					Type:      "job",
-					Content:   "Work for us",
-					URL:       "gymshark.com/careers",
-					Score:     10,
-					Title:     "Senior Software Engineer",
+			items: []models.Item{
+				{
+					ID:        1,
+					Type:      "story",
+					Content:   "Hello, world",
+					URL:       "gymshark.com",
+					Score:     42,
+					Title:     "Intro, revised",
 					CreatedAt: time.Now(),
-					CreatedBy: "lava gurl",
-				})
-			},
-			expectedItemCount: 0,
-		},
-		{
-			name: "one story and one job",
-			seed: func(ctx context.Context) {
-				client.Write(ctx, models.Item{
+					CreatedBy: "shark boi",
+				},
+				{
 					ID:        1,
 					Type:      "story",
 					Content:   "Hello, world",
 					URL:       "gymshark.com",
-					Score:     10,
-					Title:     "Intro",
+					Score:     42,
+					Title:     "Intro, revised",
 					CreatedAt: time.Now(),
 					CreatedBy: "shark boi",
-				})
-
-				client.Write(ctx, models.Item{
+				},
+				{
 					ID:        2,
 					Type:      "job",
 					Content:   "Work for us",
@@ -185,84 +127,52 @@ func TestGetStories(t *testing.T) {
 					Title:     "Senior Software Engineer",
 					CreatedAt: time.Now(),
 					CreatedBy: "lava gurl",
-				})
+				},
+			},
+			expectedItemCount: 2,
+			expectedItems: []models.Item{
+				{ID: 1, Score: 42, Title: "Intro, revised", Version: 2},
+				{ID: 2, Score: 10, Title: "Senior Software Engineer", Version: 1},
 			},
-			expectedItemCount: 1,
 		},
-	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			err := testDB.reset()
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			ctx := context.TODO()
-			tc.seed(ctx)
-
-			items, err := client.GetStories(ctx)
-
-			assert.Equal(t, tc.expectedItemCount, len(items))
-			assert.NoError(t, err)
-		})
-	}
-}
-
-func TestGetJobs(t *testing.T) {
-	client := &Client{
-		pool: testDB.pool,
-	}
-
-	type testcase struct {
-		name              string
-		seed              func(ctx context.Context)
-		expectedItemCount int
-	}
-
-	tests := []testcase{
 		{
-			name: "no items",
+			name: "keeps the last version of an item fetched twice",
 			seed: func(ctx context.Context) {
 				// no-op
 			},
-			expectedItemCount: 0,
-		},
-		{
-			name: "one story",
-			seed: func(ctx context.Context) {
-				client.Write(ctx, models.Item{
+			items: []models.Item{
+				{
 					ID:        1,
 					Type:      "story",
-					Content:   "Hello, world",
-					URL:       "gymshark.com",
 					Score:     10,
 					Title:     "Intro",
 					CreatedAt: time.Now(),
 					CreatedBy: "shark boi",
-				})
-			},
-			expectedItemCount: 0,
-		},
-		{
-			name: "one job",
-			seed: func(ctx context.Context) {
-
-				client.Write(ctx, models.Item{
-					ID:        2,
-					Type:      "job",
-					Content:   "Work for us",
-					URL:       "gymshark.com/careers",
-					Score:     10,
-					Title:     "Senior Software Engineer",
+				},
+				{
+					ID:        1,
+					Type:      "story",
+					Score:     42,
+					Title:     "Intro, revised",
 					CreatedAt: time.Now(),
-					CreatedBy: "lava gurl",
-				})
+					CreatedBy: "shark boi",
+				},
+				{
+					ID:        1,
+					Type:      "story",
+					Score:     50,
+					Title:     "Intro, revised again",
+					CreatedAt: time.Now(),
+					CreatedBy: "shark boi",
+				},
 			},
 			expectedItemCount: 1,
+			expectedItems: []models.Item{
+				{ID: 1, Score: 50, Title: "Intro, revised again", Version: 1},
+			},
 		},
 		{
-			name: "one story and one job",
+			name: "leaves unchanged items alone",
 			seed: func(ctx context.Context) {
 				client.Write(ctx, models.Item{
 					ID:        1,
@@ -274,19 +184,23 @@ func TestGetJobs(t *testing.T) {
 					CreatedAt: time.Now(),
 					CreatedBy: "shark boi",
 				})
-
-				client.Write(ctx, models.Item{
-					ID:        2,
-					Type:      "job",
-					Content:   "Work for us",
-					URL:       "gymshark.com/careers",
+			},
+			items: []models.Item{
+				{
+					ID:        1,
+					Type:      "story",
+					Content:   "Hello, world",
+					URL:       "gymshark.com",
 					Score:     10,
-					Title:     "Senior Software Engineer",
+					Title:     "Intro",
 					CreatedAt: time.Now(),
-					CreatedBy: "lava gurl",
-				})
+					CreatedBy: "shark boi",
+				},
 			},
 			expectedItemCount: 1,
+			expectedItems: []models.Item{
+				{ID: 1, Score: 10, Title: "Intro", Version: 1},
+			},
 		},
 	}
 
@@ -300,10 +214,160 @@ func TestGetJobs(t *testing.T) {
 			ctx := context.TODO()
 			tc.seed(ctx)
 
-			items, err := client.GetJobs(ctx)
+			err = client.WriteBatch(ctx, tc.items)
+			assert.NoError(t, err)
 
-			assert.Equal(t, tc.expectedItemCount, len(items))
+			items, err := client.List(ctx, ListQuery{})
 			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedItemCount, len(items))
+
+			for _, expected := range tc.expectedItems {
+				item, err := client.Get(ctx, expected.ID)
+				require.NoError(t, err)
+				assert.Equal(t, expected.Score, item.Score)
+				assert.Equal(t, expected.Title, item.Title)
+				assert.Equal(t, expected.Version, item.Version)
+			}
 		})
 	}
 }
+
+func TestGet(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	err := testDB.reset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.TODO()
+	client.Write(ctx, models.Item{
+		ID:        1,
+		Type:      "story",
+		Content:   "Hello, world",
+		URL:       "gymshark.com",
+		Score:     10,
+		Title:     "Intro",
+		CreatedAt: time.Now(),
+		CreatedBy: "shark boi",
+	})
+
+	item, err := client.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Intro", item.Title)
+
+	_, err = client.Get(ctx, 2)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	items, err := client.GetMany(ctx, []int{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(items))
+}
+
+func TestItemVersions(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	err := testDB.reset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.TODO()
+	item := models.Item{
+		ID:        1,
+		Type:      "story",
+		Content:   "Hello, world",
+		URL:       "gymshark.com",
+		Score:     10,
+		Title:     "Intro",
+		CreatedAt: time.Now(),
+		CreatedBy: "shark boi",
+	}
+	assert.NoError(t, client.Write(ctx, item))
+
+	stored, err := client.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stored.Version)
+	assert.False(t, stored.UpdatedAt.IsZero())
+
+	// unchanged items aren't updated so keep their version
+	assert.NoError(t, client.WriteBatch(ctx, []models.Item{item}))
+
+	unchanged, err := client.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, unchanged.Version)
+	assert.Equal(t, stored.UpdatedAt, unchanged.UpdatedAt)
+
+	item.Score = 20
+	assert.NoError(t, client.WriteBatch(ctx, []models.Item{item}))
+
+	updated, err := client.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	assert.False(t, updated.UpdatedAt.Before(stored.UpdatedAt))
+}
+
+func TestItemThreads(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	err := testDB.reset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.TODO()
+	poll := models.Item{
+		ID:          126809,
+		Type:        "poll",
+		Title:       "Poll: What would happen if News.YC had explicit support for polls?",
+		Score:       46,
+		CreatedAt:   time.Unix(1204403652, 0).UTC(),
+		CreatedBy:   "pg",
+		Kids:        []int{126822, 126823},
+		Parts:       []int{126810, 126811},
+		Descendants: 54,
+	}
+	option := models.Item{
+		ID:        126810,
+		Type:      "pollopt",
+		Content:   "Yes, ban them; I'm tired of seeing Valleywag stories on News.YC.",
+		Score:     335,
+		CreatedAt: time.Unix(1204403652, 0).UTC(),
+		CreatedBy: "pg",
+		Parent:    126809,
+	}
+	assert.NoError(t, client.WriteBatch(ctx, []models.Item{poll, option}))
+
+	items, err := client.GetMany(ctx, []int{126809, 126810})
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+
+	for _, stored := range items {
+		switch stored.ID {
+		case poll.ID:
+			assert.Equal(t, poll.Kids, stored.Kids)
+			assert.Equal(t, poll.Parts, stored.Parts)
+			assert.Equal(t, 54, stored.Descendants)
+		case option.ID:
+			assert.Equal(t, 126809, stored.Parent)
+			assert.Nil(t, stored.Kids, "items without replies have no kids")
+		}
+	}
+
+	// a new reply changes the item
+	poll.Kids = append(poll.Kids, 126824)
+	poll.Descendants++
+	assert.NoError(t, client.WriteBatch(ctx, []models.Item{poll}))
+
+	updated, err := client.Get(ctx, poll.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, poll.Kids, updated.Kids)
+	assert.Equal(t, 55, updated.Descendants)
+	assert.Equal(t, 2, updated.Version)
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// ItemIterator iterates over items as they are read from the database. Rows are only read from the
+// connection as Next is called, so a slow consumer slows down the query rather than buffering results.
+// The iterator holds a database connection until it is closed
+type ItemIterator interface {
+	Next() bool
+	Item() models.Item
+	Err() error
+	Close()
+}
+
+type rowIterator struct {
+	rows    pgx.Rows
+	scanner *pgxscan.RowScanner
+	item    models.Item
+	err     error
+}
+
+// Iterate runs the query and returns an iterator over the matching items
+func (c *Client) Iterate(ctx context.Context, q ListQuery) (ItemIterator, error) {
+	sql, args := q.build()
+
+	rows, err := c.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing items")
+	}
+
+	return &rowIterator{
+		rows:    rows,
+		scanner: pgxscan.NewRowScanner(rows),
+	}, nil
+}
+
+// Next advances to the next item, returning false when there are no more items or an error occurred
+func (it *rowIterator) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+
+	it.item = models.Item{}
+	if err := it.scanner.Scan(&it.item); err != nil {
+		it.err = errors.Wrap(err, "scanning item")
+		return false
+	}
+
+	return true
+}
+
+// Item returns the current item
+func (it *rowIterator) Item() models.Item {
+	return it.item
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *rowIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+
+	return it.rows.Err()
+}
+
+// Close releases the connection held by the iterator
+func (it *rowIterator) Close() {
+	it.rows.Close()
+}
+
+// sliceIterator iterates over items that are already in memory
+type sliceIterator struct {
+	items []models.Item
+	pos   int
+}
+
+// NewSliceIterator creates an iterator over a slice of items
+func NewSliceIterator(items []models.Item) ItemIterator {
+	return &sliceIterator{items: items, pos: -1}
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.pos+1 >= len(it.items) {
+		return false
+	}
+
+	it.pos++
+	return true
+}
+
+func (it *sliceIterator) Item() models.Item {
+	return it.items[it.pos]
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() {}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// AcquireLease takes or renews the named lease for holder. It reports false when another holder owns an unexpired lease
+func (c *Client) AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	// the database clock is used for expiry so instances with skewed clocks agree on who holds the lease
+	sql := `
+	INSERT INTO leases (name, holder, expires_at)
+	VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+	ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+	WHERE leases.holder = EXCLUDED.holder OR leases.expires_at < now()
+	RETURNING holder
+	`
+
+	var current string
+	err := c.pool.QueryRow(ctx, sql, name, holder, ttl.Milliseconds()).Scan(&current)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, errors.Wrap(err, fmt.Sprintf("acquiring lease %s", name))
+	}
+
+	return current == holder, nil
+}
+
+// ReleaseLease gives up the named lease if it is still owned by holder
+func (c *Client) ReleaseLease(ctx context.Context, name string, holder string) error {
+	if _, err := c.pool.Exec(ctx, `DELETE FROM leases WHERE name = $1 AND holder = $2`, name, holder); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("releasing lease %s", name))
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLease(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	type testcase struct {
+		name             string
+		seed             func(ctx context.Context)
+		holder           string
+		expectedAcquired bool
+	}
+
+	tests := []testcase{
+		{
+			name: "no existing lease",
+			seed: func(ctx context.Context) {
+				// no-op
+			},
+			holder:           "consumer-1",
+			expectedAcquired: true,
+		},
+		{
+			name: "renews own lease",
+			seed: func(ctx context.Context) {
+				client.AcquireLease(ctx, "seeder", "consumer-1", time.Minute)
+			},
+			holder:           "consumer-1",
+			expectedAcquired: true,
+		},
+		{
+			name: "lease held by another instance",
+			seed: func(ctx context.Context) {
+				client.AcquireLease(ctx, "seeder", "consumer-2", time.Minute)
+			},
+			holder:           "consumer-1",
+			expectedAcquired: false,
+		},
+		{
+			name: "expired lease held by another instance",
+			seed: func(ctx context.Context) {
+				client.AcquireLease(ctx, "seeder", "consumer-2", time.Millisecond)
+				time.Sleep(10 * time.Millisecond)
+			},
+			holder:           "consumer-1",
+			expectedAcquired: true,
+		},
+		{
+			name: "released lease",
+			seed: func(ctx context.Context) {
+				client.AcquireLease(ctx, "seeder", "consumer-2", time.Minute)
+				client.ReleaseLease(ctx, "seeder", "consumer-2")
+			},
+			holder:           "consumer-1",
+			expectedAcquired: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := testDB.reset()
+			require.NoError(t, err)
+
+			ctx := context.TODO()
+			tc.seed(ctx)
+
+			acquired, err := client.AcquireLease(ctx, "seeder", tc.holder, time.Minute)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedAcquired, acquired)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/pkg/errors"
+)
+
+// Sort is the order items are listed in
+type Sort int
+
+const (
+	// SortNewest lists the most recently created items first
+	SortNewest Sort = iota
+	// SortOldest lists the least recently created items first
+	SortOldest
+	// SortTop lists the highest scoring items first
+	SortTop
+)
+
+// Cursor is the position of the last item of a page. The next page starts immediately after it
+type Cursor struct {
+	ID        int
+	Score     int
+	CreatedAt time.Time
+}
+
+// CursorFor creates the cursor positioned at item
+func CursorFor(item models.Item) *Cursor {
+	return &Cursor{
+		ID:        item.ID,
+		Score:     item.Score,
+		CreatedAt: item.CreatedAt,
+	}
+}
+
+// ListQuery filters, orders and pages a list of items. Zero values are ignored
+type ListQuery struct {
+	Type          string
+	Author        string
+	MinScore      int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Sort          Sort
+	Limit         int
+	After         *Cursor
+	// TopLevel only matches items that don't reply to another, such as stories and jobs, leaving out
+	// comments and poll options
+	TopLevel bool
+}
+
+// List fetches a page of items matching the query. Pages are keyset paginated on the sort column and id
+func (c *Client) List(ctx context.Context, q ListQuery) ([]models.Item, error) {
+	sql, args := q.build()
+
+	var items []models.Item
+	if err := pgxscan.Select(ctx, c.pool, &items, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "listing items")
+	}
+
+	return items, nil
+}
+
+// build creates the SQL statement and arguments for the query
+func (q ListQuery) build() (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.Type != "" {
+		conditions = append(conditions, "type = "+arg(q.Type))
+	}
+
+	if q.TopLevel {
+		conditions = append(conditions, "parent = 0")
+	}
+
+	if q.Author != "" {
+		conditions = append(conditions, "created_by = "+arg(q.Author))
+	}
+
+	if q.MinScore != 0 {
+		conditions = append(conditions, "score >= "+arg(q.MinScore))
+	}
+
+	if !q.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(q.CreatedAfter))
+	}
+
+	if !q.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(q.CreatedBefore))
+	}
+
+	column, direction, comparison := "created_at", "DESC", "<"
+	switch q.Sort {
+	case SortOldest:
+		direction, comparison = "ASC", ">"
+	case SortTop:
+		column = "score"
+	}
+
+	if q.After != nil {
+		var value interface{} = q.After.CreatedAt
+		if q.Sort == SortTop {
+			value = q.After.Score
+		}
+
+		// row comparison keeps pages stable when several items share the same sort value
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", column, comparison, arg(value), arg(q.After.ID)))
+	}
+
+	sql := `SELECT id, type, content, url, score, title, created_at, created_by, version, updated_at, parent, kids, parts, descendants FROM items`
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	sql += fmt.Sprintf(" ORDER BY %s %s, id %s", column, direction, direction)
+
+	if q.Limit > 0 {
+		sql += " LIMIT " + arg(q.Limit)
+	}
+
+	return sql, args
+}
@@ -0,0 +1,416 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestList(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	seed := func(ctx context.Context) {
+		client.Write(ctx, models.Item{ID: 1, Type: "story", Title: "Intro", Score: 10, CreatedAt: now.Add(-3 * time.Hour), CreatedBy: "shark boi"})
+		client.Write(ctx, models.Item{ID: 2, Type: "job", Title: "Senior Software Engineer", Score: 30, CreatedAt: now.Add(-2 * time.Hour), CreatedBy: "lava gurl"})
+		client.Write(ctx, models.Item{ID: 3, Type: "story", Title: "Outro", Score: 20, CreatedAt: now.Add(-1 * time.Hour), CreatedBy: "shark boi"})
+		client.Write(ctx, models.Item{ID: 4, Type: "story", Title: "Encore", Score: 20, CreatedAt: now, CreatedBy: "lava gurl"})
+		client.Write(ctx, models.Item{ID: 5, Type: "comment", Content: "Welcome", CreatedAt: now.Add(-4 * time.Hour), CreatedBy: "pg", Parent: 1})
+	}
+
+	type testcase struct {
+		name        string
+		query       ListQuery
+		expectedIDs []int
+	}
+
+	tests := []testcase{
+		{
+			name:        "newest first by default",
+			query:       ListQuery{},
+			expectedIDs: []int{4, 3, 2, 1, 5},
+		},
+		{
+			name:        "oldest first",
+			query:       ListQuery{Sort: SortOldest},
+			expectedIDs: []int{5, 1, 2, 3, 4},
+		},
+		{
+			name:        "top first with ties broken by id",
+			query:       ListQuery{Sort: SortTop},
+			expectedIDs: []int{2, 4, 3, 1, 5},
+		},
+		{
+			name:        "filter by type",
+			query:       ListQuery{Type: "story"},
+			expectedIDs: []int{4, 3, 1},
+		},
+		{
+			name:        "top level leaves out replies",
+			query:       ListQuery{TopLevel: true},
+			expectedIDs: []int{4, 3, 2, 1},
+		},
+		{
+			name:        "filter by author",
+			query:       ListQuery{Author: "lava gurl"},
+			expectedIDs: []int{4, 2},
+		},
+		{
+			name:        "filter by minimum score",
+			query:       ListQuery{MinScore: 20},
+			expectedIDs: []int{4, 3, 2},
+		},
+		{
+			name:        "filter by created at range",
+			query:       ListQuery{CreatedAfter: now.Add(-2 * time.Hour), CreatedBefore: now},
+			expectedIDs: []int{3, 2},
+		},
+		{
+			name:        "limit",
+			query:       ListQuery{Limit: 2},
+			expectedIDs: []int{4, 3},
+		},
+		{
+			name:        "after cursor",
+			query:       ListQuery{Limit: 2, After: &Cursor{ID: 3, CreatedAt: now.Add(-1 * time.Hour)}},
+			expectedIDs: []int{2, 1, 5},
+		},
+		{
+			name:        "after cursor with tied scores",
+			query:       ListQuery{Sort: SortTop, After: &Cursor{ID: 4, Score: 20}},
+			expectedIDs: []int{3, 1, 5},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := testDB.reset()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.TODO()
+			seed(ctx)
+
+			items, err := client.List(ctx, tc.query)
+			assert.NoError(t, err)
+
+			ids := []int{}
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestListAll(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	type testcase struct {
+		name              string
+		seed              func(ctx context.Context)
+		expectedItemCount int
+	}
+
+	tests := []testcase{
+		{
+			name: "no items",
+			seed: func(ctx context.Context) {
+				// no-op
+			},
+			expectedItemCount: 0,
+		},
+		{
+			name: "one story",
+			seed: func(ctx context.Context) {
+				client.Write(ctx, models.Item{
+					ID:        1,
+					Type:      "story",
+					Content:   "Hello, world",
+					URL:       "gymshark.com",
+					Score:     10,
+					Title:     "Intro",
+					CreatedAt: time.Now(),
+					CreatedBy: "shark boi",
+				})
+			},
+			expectedItemCount: 1,
+		},
+		{
+			name: "one story and one job",
+			seed: func(ctx context.Context) {
+				client.Write(ctx, models.Item{
+					ID:        1,
+					Type:      "story",
+					Content:   "Hello, world",
+					URL:       "gymshark.com",
+					Score:     10,
+					Title:     "Intro",
+					CreatedAt: time.Now(),
+					CreatedBy: "shark boi",
+				})
+
+				client.Write(ctx, models.Item{
+					ID:        2,
+					Type:      "job",
+					Content:   "Work for us",
+					URL:       "gymshark.com/careers",
+					Score:     10,
+					Title:     "Senior Software Engineer",
+					CreatedAt: time.Now(),
+					CreatedBy: "lava gurl",
+				})
+			},
+			expectedItemCount: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := testDB.reset()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.TODO()
+			tc.seed(ctx)
+			items, err := client.List(ctx, ListQuery{})
+
+			assert.Equal(t, tc.expectedItemCount, len(items))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestListStories(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	type testcase struct {
+		name              string
+		seed              func(ctx context.Context)
+		expectedItemCount int
+	}
+
+	tests := []testcase{
+		{
+			name: "no items",
+			seed: func(ctx context.Context) {
+				// no-op
+			},
+			expectedItemCount: 0,
+		},
+		{
+			name: "one story",
+			seed: func(ctx context.Context) {
+				client.Write(ctx, models.Item{
+					ID:        1,
+					Type:      "story",
+					Content:   "Hello, world",
+					URL:       "gymshark.com",
+					Score:     10,
+					Title:     "Intro",
+					CreatedAt: time.Now(),
+					CreatedBy: "shark boi",
+				})
+			},
+			expectedItemCount: 1,
+		},
+		{
+			name: "one job",
+			seed: func(ctx context.Context) {
+				client.Write(ctx, models.Item{
+					ID:        2,
+					Type:      "job",
+					Content:   "Work for us",
+					URL:       "gymshark.com/careers",
+					Score:     10,
+					Title:     "Senior Software Engineer",
+					CreatedAt: time.Now(),
+					CreatedBy: "lava gurl",
+				})
+			},
+			expectedItemCount: 0,
+		},
+		{
+			name: "one story and one job",
+			seed: func(ctx context.Context) {
+				client.Write(ctx, models.Item{
+					ID:        1,
+					Type:      "story",
+					Content:   "Hello, world",
+					URL:       "gymshark.com",
+					Score:     10,
+					Title:     "Intro",
+					CreatedAt: time.Now(),
+					CreatedBy: "shark boi",
+				})
+
+				client.Write(ctx, models.Item{
+					ID:        2,
+					Type:      "job",
+					Content:   "Work for us",
+					URL:       "gymshark.com/careers",
+					Score:     10,
+					Title:     "Senior Software Engineer",
+					CreatedAt: time.Now(),
+					CreatedBy: "lava gurl",
+				})
+			},
+			expectedItemCount: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := testDB.reset()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.TODO()
+			tc.seed(ctx)
+
+			items, err := client.List(ctx, ListQuery{Type: "story"})
+
+			assert.Equal(t, tc.expectedItemCount, len(items))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestListJobs(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	type testcase struct {
+		name              string
+		seed              func(ctx context.Context)
+		expectedItemCount int
+	}
+
+	tests := []testcase{
+		{
+			name: "no items",
+			seed: func(ctx context.Context) {
+				// no-op
+			},
+			expectedItemCount: 0,
+		},
+		{
+			name: "one story",
+			seed: func(ctx context.Context) {
+				client.Write(ctx, models.Item{
+					ID:        1,
+					Type:      "story",
+					Content:   "Hello, world",
+					URL:       "gymshark.com",
+					Score:     10,
+					Title:     "Intro",
+					CreatedAt: time.Now(),
+					CreatedBy: "shark boi",
+				})
+			},
+			expectedItemCount: 0,
+		},
+		{
+			name: "one job",
+			seed: func(ctx context.Context) {
+
+				client.Write(ctx, models.Item{
+					ID:        2,
+					Type:      "job",
+					Content:   "Work for us",
+					URL:       "gymshark.com/careers",
+					Score:     10,
+					Title:     "Senior Software Engineer",
+					CreatedAt: time.Now(),
+					CreatedBy: "lava gurl",
+				})
+			},
+			expectedItemCount: 1,
+		},
+		{
+			name: "one story and one job",
+			seed: func(ctx context.Context) {
+				client.Write(ctx, models.Item{
+					ID:        1,
+					Type:      "story",
+					Content:   "Hello, world",
+					URL:       "gymshark.com",
+					Score:     10,
+					Title:     "Intro",
+					CreatedAt: time.Now(),
+					CreatedBy: "shark boi",
+				})
+
+				client.Write(ctx, models.Item{
+					ID:        2,
+					Type:      "job",
+					Content:   "Work for us",
+					URL:       "gymshark.com/careers",
+					Score:     10,
+					Title:     "Senior Software Engineer",
+					CreatedAt: time.Now(),
+					CreatedBy: "lava gurl",
+				})
+			},
+			expectedItemCount: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := testDB.reset()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.TODO()
+			tc.seed(ctx)
+
+			items, err := client.List(ctx, ListQuery{Type: "job"})
+
+			assert.Equal(t, tc.expectedItemCount, len(items))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestIterate(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	err := testDB.reset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.TODO()
+	for id := 1; id <= 3; id++ {
+		client.Write(ctx, models.Item{ID: id, Type: "story", Title: "Intro", CreatedAt: time.Now(), CreatedBy: "shark boi"})
+	}
+
+	it, err := client.Iterate(ctx, ListQuery{Sort: SortOldest})
+	assert.NoError(t, err)
+	defer it.Close()
+
+	ids := []int{}
+	for it.Next() {
+		ids = append(ids, it.Item().ID)
+	}
+
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []int{1, 2, 3}, ids)
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/alexdunne/gs-onboarding/internal/models"
 	"github.com/stretchr/testify/mock"
@@ -11,8 +12,8 @@ type Mock struct {
 	mock.Mock
 }
 
-func (m *Mock) GetAll(ctx context.Context) ([]models.Item, error) {
-	args := m.Called(ctx)
+func (m *Mock) List(ctx context.Context, q ListQuery) ([]models.Item, error) {
+	args := m.Called(ctx, q)
 
 	itemsArg, ok := args.Get(0).([]models.Item)
 	if !ok {
@@ -22,30 +23,68 @@ func (m *Mock) GetAll(ctx context.Context) ([]models.Item, error) {
 	return itemsArg, args.Error(1)
 }
 
-func (m *Mock) GetStories(ctx context.Context) ([]models.Item, error) {
-	args := m.Called(ctx)
+func (m *Mock) Iterate(ctx context.Context, q ListQuery) (ItemIterator, error) {
+	args := m.Called(ctx, q)
 
 	itemsArg, ok := args.Get(0).([]models.Item)
 	if !ok {
-		return nil, nil
+		return nil, args.Error(1)
 	}
 
-	return itemsArg, args.Error(1)
+	return NewSliceIterator(itemsArg), args.Error(1)
+}
+
+func (m *Mock) Get(ctx context.Context, id int) (models.Item, error) {
+	args := m.Called(ctx, id)
+
+	itemArg, ok := args.Get(0).(models.Item)
+	if !ok {
+		return models.Item{}, args.Error(1)
+	}
+
+	return itemArg, args.Error(1)
 }
 
-func (m *Mock) GetJobs(ctx context.Context) ([]models.Item, error) {
-	args := m.Called(ctx)
+func (m *Mock) GetMany(ctx context.Context, ids []int) ([]models.Item, error) {
+	args := m.Called(ctx, ids)
 
 	itemsArg, ok := args.Get(0).([]models.Item)
 	if !ok {
-		return nil, nil
+		return nil, args.Error(1)
 	}
 
 	return itemsArg, args.Error(1)
 }
 
+func (m *Mock) ScoreHistories(ctx context.Context, ids []int, since time.Time, limit int) (map[int][]models.ScoreSample, error) {
+	args := m.Called(ctx, ids, since, limit)
+
+	historiesArg, ok := args.Get(0).(map[int][]models.ScoreSample)
+	if !ok {
+		return nil, args.Error(1)
+	}
+
+	return historiesArg, args.Error(1)
+}
+
+func (m *Mock) Search(ctx context.Context, q SearchQuery) ([]models.SearchResult, error) {
+	args := m.Called(ctx, q)
+
+	resultsArg, ok := args.Get(0).([]models.SearchResult)
+	if !ok {
+		return nil, args.Error(1)
+	}
+
+	return resultsArg, args.Error(1)
+}
+
 func (m *Mock) Write(ctx context.Context, item models.Item) error {
 	args := m.Called(ctx, item)
 	return args.Error(0)
 
 }
+
+func (m *Mock) WriteBatch(ctx context.Context, items []models.Item) error {
+	args := m.Called(ctx, items)
+	return args.Error(0)
+}
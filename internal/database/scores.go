@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/pkg/errors"
+)
+
+// ScoreHistories fetches up to limit scores recorded for each item at or after since, oldest first.
+// Items without any matching scores, including those that don't exist, are left out of the result
+func (c *Client) ScoreHistories(ctx context.Context, ids []int, since time.Time, limit int) (map[int][]models.ScoreSample, error) {
+	sql := `
+	SELECT item_id, score, recorded_at FROM (
+		SELECT id, item_id, score, recorded_at, row_number() OVER (PARTITION BY item_id ORDER BY recorded_at, id) AS n
+		FROM item_scores
+		WHERE item_id = ANY($1) AND recorded_at >= $2
+	) s
+	WHERE n <= $3
+	ORDER BY item_id, recorded_at, id
+	`
+
+	var rows []struct {
+		ItemID int `db:"item_id"`
+		models.ScoreSample
+	}
+
+	// recorded_at has no time zone and holds UTC
+	if err := pgxscan.Select(ctx, c.pool, &rows, sql, ids, since.UTC(), limit); err != nil {
+		return nil, errors.Wrap(err, "fetching score histories")
+	}
+
+	histories := make(map[int][]models.ScoreSample)
+	for _, row := range rows {
+		histories[row.ItemID] = append(histories[row.ItemID], row.ScoreSample)
+	}
+
+	return histories, nil
+}
+
+// PruneScores deletes scores recorded before the retention period. The last score of each item from
+// before the period is kept, so histories still start with the score items had when the period began
+func (c *Client) PruneScores(ctx context.Context, retention time.Duration) (int64, error) {
+	sql := `
+	DELETE FROM item_scores s
+	WHERE s.recorded_at < now() - $1 * interval '1 millisecond'
+	AND EXISTS (
+		SELECT 1 FROM item_scores n
+		WHERE n.item_id = s.item_id
+		AND n.recorded_at < now() - $1 * interval '1 millisecond'
+		AND (n.recorded_at, n.id) > (s.recorded_at, s.id)
+	)
+	`
+
+	// compared against the database clock, which the scores were recorded with
+	tag, err := c.pool.Exec(ctx, sql, retention.Milliseconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "pruning item scores")
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreHistories(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	err := testDB.reset()
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+	item := models.Item{
+		ID:        1,
+		Type:      "story",
+		Content:   "Hello, world",
+		URL:       "gymshark.com",
+		Score:     10,
+		Title:     "Intro",
+		CreatedAt: time.Now(),
+		CreatedBy: "shark boi",
+	}
+	other := item
+	other.ID = 2
+
+	require.NoError(t, client.WriteBatch(ctx, []models.Item{item, other}))
+
+	// only changes to the score are recorded
+	item.Title = "Intro, edited"
+	require.NoError(t, client.WriteBatch(ctx, []models.Item{item}))
+
+	item.Score = 20
+	require.NoError(t, client.WriteBatch(ctx, []models.Item{item}))
+
+	histories, err := client.ScoreHistories(ctx, []int{1, 2, 3}, time.Time{}, 10)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{10, 20}, scores(histories[1]))
+	assert.Equal(t, []int{10}, scores(histories[2]))
+	assert.False(t, histories[1][1].RecordedAt.Before(histories[1][0].RecordedAt))
+	assert.NotContains(t, histories, 3, "items that don't exist have no history")
+
+	// the history goes with the item
+	_, err = client.pool.Exec(ctx, `DELETE FROM items WHERE id = 1`)
+	require.NoError(t, err)
+
+	histories, err = client.ScoreHistories(ctx, []int{1}, time.Time{}, 10)
+	require.NoError(t, err)
+	assert.Empty(t, histories)
+}
+
+func TestScoreHistoriesBounds(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	err := testDB.reset()
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+	require.NoError(t, client.WriteBatch(ctx, []models.Item{{ID: 1, Type: "story", Title: "Intro", CreatedAt: time.Now(), CreatedBy: "shark boi"}}))
+
+	// replace the score recorded when the item was written with known samples
+	_, err = client.pool.Exec(ctx, `DELETE FROM item_scores`)
+	require.NoError(t, err)
+
+	start := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 4; i++ {
+		_, err = client.pool.Exec(ctx, `INSERT INTO item_scores (item_id, score, recorded_at) VALUES (1, $1, $2)`, i*10, start.Add(time.Duration(i)*time.Hour))
+		require.NoError(t, err)
+	}
+
+	type testcase struct {
+		name           string
+		since          time.Time
+		limit          int
+		expectedScores []int
+	}
+
+	tests := []testcase{
+		{
+			name:           "limits the oldest scores",
+			since:          start,
+			limit:          2,
+			expectedScores: []int{10, 20},
+		},
+		{
+			name:           "starts at the since time",
+			since:          start.Add(2 * time.Hour),
+			limit:          10,
+			expectedScores: []int{20, 30, 40},
+		},
+		{
+			name:           "since is compared in UTC",
+			since:          start.Add(3 * time.Hour).In(time.FixedZone("BST", 3600)),
+			limit:          10,
+			expectedScores: []int{30, 40},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			histories, err := client.ScoreHistories(ctx, []int{1}, tt.since, tt.limit)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedScores, scores(histories[1]))
+		})
+	}
+}
+
+func TestPruneScores(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	err := testDB.reset()
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+	require.NoError(t, client.WriteBatch(ctx, []models.Item{
+		{ID: 1, Type: "story", Title: "Intro", Score: 50, CreatedAt: time.Now(), CreatedBy: "shark boi"},
+		{ID: 2, Type: "story", Title: "Other", Score: 5, CreatedAt: time.Now(), CreatedBy: "shark boi"},
+	}))
+
+	// the first two scores of item 1 and the first score of item 2 are from before the retention period
+	_, err = client.pool.Exec(ctx, `UPDATE item_scores SET recorded_at = now() - interval '3 days'`)
+	require.NoError(t, err)
+	_, err = client.pool.Exec(ctx, `INSERT INTO item_scores (item_id, score, recorded_at) VALUES (1, 10, now() - interval '4 days')`)
+	require.NoError(t, err)
+
+	require.NoError(t, client.WriteBatch(ctx, []models.Item{{ID: 1, Type: "story", Title: "Intro", Score: 60, CreatedAt: time.Now(), CreatedBy: "shark boi"}}))
+
+	pruned, err := client.PruneScores(ctx, 48*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pruned)
+
+	histories, err := client.ScoreHistories(ctx, []int{1, 2}, time.Time{}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{50, 60}, scores(histories[1]), "the last score from before the period is kept")
+	assert.Equal(t, []int{5}, scores(histories[2]))
+}
+
+func scores(samples []models.ScoreSample) []int {
+	res := []int{}
+	for _, s := range samples {
+		res = append(res, s.Score)
+	}
+	return res
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"html"
+	"strings"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/pkg/errors"
+)
+
+// SearchQuery is a full-text search over item titles and content
+type SearchQuery struct {
+	// Text supports web search syntax e.g. quoted phrases, "or" and "-" to exclude words
+	Text   string
+	Type   string
+	Limit  int
+	Offset int
+	// TopLevel only matches items that don't reply to another, as ListQuery's does
+	TopLevel bool
+}
+
+// snippetStart and snippetStop delimit matches in ts_headline's output. They're stripped from the text
+// beforehand so the snippet can be escaped before the matches are wrapped in <mark> tags
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// Search fetches a page of items matching the query. Results are ordered by how well they match,
+// boosted by score and decayed by age, and include a snippet of the text, HTML escaped, with the
+// matching words wrapped in <mark> tags
+func (c *Client) Search(ctx context.Context, q SearchQuery) ([]models.SearchResult, error) {
+	sql := `
+	SELECT
+		id, type, content, url, score, title, created_at, created_by, version, updated_at,
+		parent, kids, parts, descendants,
+		ts_headline(
+			'english', regexp_replace(title || ' ' || content, E'<[^>]*>|[\x02\x03]', ' ', 'g'), query,
+			E'StartSel=\x02, StopSel=\x03, MaxFragments=2, MaxWords=30, MinWords=10'
+		) AS snippet,
+		ts_rank_cd(search, query)
+			* ln(10 + greatest(score, 0))
+			/ sqrt(1 + extract(epoch FROM now() - created_at) / 86400) AS rank
+	FROM items, websearch_to_tsquery('english', $1) query
+	WHERE search @@ query AND ($2 = '' OR type = $2) AND (NOT $5 OR parent = 0)
+	ORDER BY rank DESC, id DESC
+	LIMIT $3 OFFSET $4
+	`
+
+	var rows []struct {
+		models.Item
+		Snippet string
+		Rank    float64
+	}
+	if err := pgxscan.Select(ctx, c.pool, &rows, sql, q.Text, q.Type, q.Limit, q.Offset, q.TopLevel); err != nil {
+		return nil, errors.Wrap(err, "searching items")
+	}
+
+	results := make([]models.SearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = models.SearchResult{
+			Item:    row.Item,
+			Snippet: highlight(row.Snippet),
+			Rank:    row.Rank,
+		}
+	}
+
+	return results, nil
+}
+
+// highlight escapes the text of a snippet, which may contain entities from the item's HTML, and wraps
+// the delimited matches in <mark> tags
+func highlight(snippet string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexAny(snippet, snippetStart+snippetStop)
+		if i < 0 {
+			b.WriteString(html.EscapeString(html.UnescapeString(snippet)))
+			return b.String()
+		}
+
+		b.WriteString(html.EscapeString(html.UnescapeString(snippet[:i])))
+		if snippet[i:i+1] == snippetStart {
+			b.WriteString("<mark>")
+		} else {
+			b.WriteString("</mark>")
+		}
+		snippet = snippet[i+1:]
+	}
+}
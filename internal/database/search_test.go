@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	client := &Client{
+		pool: testDB.pool,
+	}
+
+	seed := func(ctx context.Context) {
+		client.Write(ctx, models.Item{ID: 1, Type: "story", Title: "Rust compiler internals", Content: "", Score: 10, CreatedAt: time.Now(), CreatedBy: "shark boi"})
+		client.Write(ctx, models.Item{ID: 2, Type: "story", Title: "Go generics", Content: "A deep dive into the compiler", Score: 10, CreatedAt: time.Now(), CreatedBy: "shark boi"})
+		client.Write(ctx, models.Item{ID: 3, Type: "job", Title: "Compiler engineer", Content: "Work for us", Score: 10, CreatedAt: time.Now(), CreatedBy: "lava gurl"})
+		client.Write(ctx, models.Item{ID: 4, Type: "story", Title: "Gardening tips", Content: "Tomatoes", Score: 500, CreatedAt: time.Now(), CreatedBy: "lava gurl"})
+		client.Write(ctx, models.Item{ID: 5, Type: "comment", Content: "<p>Parsers &amp; <script>alert(1)</script></p>", Score: 1, CreatedAt: time.Now(), CreatedBy: "lava gurl", Parent: 4})
+	}
+
+	type testcase struct {
+		name        string
+		query       SearchQuery
+		expectedIDs []int
+	}
+
+	tests := []testcase{
+		{
+			name:        "no matches",
+			query:       SearchQuery{Text: "kubernetes", Limit: 10},
+			expectedIDs: []int{},
+		},
+		{
+			name:        "title matches rank above content matches",
+			query:       SearchQuery{Text: "compiler", Type: "story", Limit: 10},
+			expectedIDs: []int{1, 2},
+		},
+		{
+			name:        "filter by type",
+			query:       SearchQuery{Text: "compiler", Type: "job", Limit: 10},
+			expectedIDs: []int{3},
+		},
+		{
+			name:        "excluded words",
+			query:       SearchQuery{Text: "compiler -rust", Type: "story", Limit: 10},
+			expectedIDs: []int{2},
+		},
+		{
+			name:        "offset",
+			query:       SearchQuery{Text: "compiler", Type: "story", Limit: 10, Offset: 1},
+			expectedIDs: []int{2},
+		},
+		{
+			name:        "snippets are escaped",
+			query:       SearchQuery{Text: "parsers", Limit: 10},
+			expectedIDs: []int{5},
+		},
+		{
+			name:        "top level leaves out replies",
+			query:       SearchQuery{Text: "parsers", Limit: 10, TopLevel: true},
+			expectedIDs: []int{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := testDB.reset()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.TODO()
+			seed(ctx)
+
+			results, err := client.Search(ctx, tc.query)
+			assert.NoError(t, err)
+
+			ids := []int{}
+			for _, result := range results {
+				ids = append(ids, result.Item.ID)
+				assert.Contains(t, result.Snippet, "<mark>")
+				assert.NotContains(t, result.Snippet, "<script>")
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	type testcase struct {
+		name     string
+		snippet  string
+		expected string
+	}
+
+	tests := []testcase{
+		{
+			name:     "matches are marked",
+			snippet:  "a \x02deep\x03 dive",
+			expected: "a <mark>deep</mark> dive",
+		},
+		{
+			name:     "html is escaped",
+			snippet:  "\x02alert\x03(<b>1</b>)",
+			expected: "<mark>alert</mark>(&lt;b&gt;1&lt;/b&gt;)",
+		},
+		{
+			name:     "entities are escaped once",
+			snippet:  "rock &amp; \x02roll\x03 &lt;script&gt;",
+			expected: "rock &amp; <mark>roll</mark> &lt;script&gt;",
+		},
+		{
+			name:     "entities can't add matches",
+			snippet:  "&#2;\x02a\x03",
+			expected: "\x02<mark>a</mark>",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, highlight(tc.snippet))
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultCacheControl is sent with successful responses unless the handler is configured otherwise.
+// Shared caches, such as a CDN, may serve a response for 30 seconds and must revalidate it after
+const DefaultCacheControl = "public, max-age=30"
+
+// validators identify the version of a response for conditional requests
+type validators struct {
+	etag         string
+	lastModified time.Time
+}
+
+// itemValidators derives a strong ETag from the id and version of each item, and any extra values the
+// response depends on, and the last modified time from the most recently updated item. Items are
+// hashed in order as the order is part of the response
+func itemValidators(items []models.Item, extra ...interface{}) validators {
+	h := sha256.New()
+
+	var v validators
+	for _, item := range items {
+		fmt.Fprintf(h, "%d:%d\n", item.ID, item.Version)
+
+		if item.UpdatedAt.After(v.lastModified) {
+			v.lastModified = item.UpdatedAt
+		}
+	}
+
+	for _, e := range extra {
+		fmt.Fprintf(h, "%v\n", e)
+	}
+
+	v.etag = fmt.Sprintf("%q", hex.EncodeToString(h.Sum(nil)[:16]))
+
+	return v
+}
+
+// pageValidators derives the ETag as itemValidators does but without a last modified time. The order
+// and membership of a page change without any of its items being updated, as ranks decay or items are
+// deleted, so an If-Modified-Since date can't tell whether a page is current
+func pageValidators(items []models.Item, extra ...interface{}) validators {
+	return validators{etag: itemValidators(items, extra...).etag}
+}
+
+// respond answers 304 Not Modified when the client's copy is current, otherwise it writes body
+func (h *Handler) respond(c echo.Context, v validators, body interface{}) error {
+	if h.checkNotModified(c, v) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.JSON(http.StatusOK, body)
+}
+
+// checkNotModified sets the caching headers of a successful response and reports whether the client's
+// copy is current
+func (h *Handler) checkNotModified(c echo.Context, v validators) bool {
+	header := c.Response().Header()
+
+	cacheControl := h.CacheControl
+	if cacheControl == "" {
+		cacheControl = DefaultCacheControl
+	}
+	header.Set("Cache-Control", cacheControl)
+	header.Set("ETag", v.etag)
+	if !v.lastModified.IsZero() {
+		header.Set("Last-Modified", v.lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	return notModified(c.Request(), v)
+}
+
+// notModified evaluates the conditional headers of r as RFC 7232 describes. If-Modified-Since is
+// ignored when If-None-Match is present as ETags are the more precise validator
+func notModified(r *http.Request, v validators) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, v.etag)
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || v.lastModified.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+
+	// HTTP dates have a resolution of one second
+	return !v.lastModified.Truncate(time.Second).After(since)
+}
+
+// etagMatches reports whether the If-None-Match list matches etag. The comparison is weak, so a weak
+// validator for the same version matches
+func etagMatches(list, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,163 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	updatedAt := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	item := models.Item{ID: 1, Type: "story", Title: "Intro", Version: 3, UpdatedAt: updatedAt}
+	etag := itemValidators([]models.Item{item}).etag
+
+	type testcase struct {
+		name               string
+		headers            map[string]string
+		cacheControl       string
+		expectedStatusCode int
+		expectedCache      string
+	}
+
+	tests := []testcase{
+		{
+			name:               "unconditional",
+			expectedStatusCode: http.StatusOK,
+			expectedCache:      DefaultCacheControl,
+		},
+		{
+			name:               "configured cache control",
+			cacheControl:       "public, s-maxage=300",
+			expectedStatusCode: http.StatusOK,
+			expectedCache:      "public, s-maxage=300",
+		},
+		{
+			name:               "matching etag",
+			headers:            map[string]string{"If-None-Match": etag},
+			expectedStatusCode: http.StatusNotModified,
+			expectedCache:      DefaultCacheControl,
+		},
+		{
+			name:               "matching weak etag in a list",
+			headers:            map[string]string{"If-None-Match": `"stale", W/` + etag},
+			expectedStatusCode: http.StatusNotModified,
+			expectedCache:      DefaultCacheControl,
+		},
+		{
+			name:               "any etag",
+			headers:            map[string]string{"If-None-Match": "*"},
+			expectedStatusCode: http.StatusNotModified,
+			expectedCache:      DefaultCacheControl,
+		},
+		{
+			name:               "stale etag",
+			headers:            map[string]string{"If-None-Match": `"stale"`},
+			expectedStatusCode: http.StatusOK,
+			expectedCache:      DefaultCacheControl,
+		},
+		{
+			name:               "not modified since",
+			headers:            map[string]string{"If-Modified-Since": updatedAt.Format(http.TimeFormat)},
+			expectedStatusCode: http.StatusNotModified,
+			expectedCache:      DefaultCacheControl,
+		},
+		{
+			name:               "modified since",
+			headers:            map[string]string{"If-Modified-Since": updatedAt.Add(-time.Second).Format(http.TimeFormat)},
+			expectedStatusCode: http.StatusOK,
+			expectedCache:      DefaultCacheControl,
+		},
+		{
+			name: "stale etag takes precedence over modified since",
+			headers: map[string]string{
+				"If-None-Match":     `"stale"`,
+				"If-Modified-Since": updatedAt.Format(http.TimeFormat),
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedCache:      DefaultCacheControl,
+		},
+		{
+			name:               "malformed modified since",
+			headers:            map[string]string{"If-Modified-Since": "yesterday"},
+			expectedStatusCode: http.StatusOK,
+			expectedCache:      DefaultCacheControl,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hn := &hackernews.Mock{}
+			hn.On("FetchItem", mock.Anything, 1).Return(item, nil)
+
+			c, res := setUpRequest(http.MethodGet, "/items/1")
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+			for k, v := range tc.headers {
+				c.Request().Header.Set(k, v)
+			}
+
+			h := Handler{HNClient: hn, CacheControl: tc.cacheControl}
+			require.NoError(t, h.GetItem(c))
+
+			assert.Equal(t, tc.expectedStatusCode, res.Code)
+			assert.Equal(t, etag, res.Header().Get("ETag"))
+			assert.Equal(t, "Fri, 01 Oct 2021 12:00:00 GMT", res.Header().Get("Last-Modified"))
+			assert.Equal(t, tc.expectedCache, res.Header().Get("Cache-Control"))
+
+			if tc.expectedStatusCode == http.StatusNotModified {
+				assert.Empty(t, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestItemValidators(t *testing.T) {
+	first := models.Item{ID: 1, Version: 1, UpdatedAt: time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)}
+	second := models.Item{ID: 2, Version: 4, UpdatedAt: time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)}
+
+	v := itemValidators([]models.Item{first, second}, "abc")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, v.etag)
+	assert.Equal(t, second.UpdatedAt, v.lastModified)
+
+	assert.Equal(t, v, itemValidators([]models.Item{first, second}, "abc"), "validators must be deterministic")
+
+	updated := second
+	updated.Version++
+	assert.NotEqual(t, v.etag, itemValidators([]models.Item{first, updated}, "abc").etag, "a new version must change the etag")
+	assert.NotEqual(t, v.etag, itemValidators([]models.Item{second, first}, "abc").etag, "the order must change the etag")
+	assert.NotEqual(t, v.etag, itemValidators([]models.Item{first, second}, "def").etag, "extra values must change the etag")
+	assert.NotEqual(t, v.etag, itemValidators([]models.Item{first}, "abc").etag, "a removed item must change the etag")
+
+	assert.True(t, itemValidators(nil).lastModified.IsZero())
+
+	page := pageValidators([]models.Item{first, second}, "abc")
+	assert.Equal(t, v.etag, page.etag)
+	assert.True(t, page.lastModified.IsZero(), "pages have no last modified time")
+}
+
+func TestListHasNoLastModified(t *testing.T) {
+	hn := &hackernews.Mock{}
+	hn.On("FetchStories", mock.Anything, mock.Anything).Return([]models.Item{{ID: 1, Version: 1, UpdatedAt: time.Now()}}, "", nil)
+
+	c, res := setUpRequest(http.MethodGet, "/stories")
+
+	h := Handler{HNClient: hn}
+	require.NoError(t, h.GetStories(c))
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.NotEmpty(t, res.Header().Get("ETag"))
+	assert.Empty(t, res.Header().Get("Last-Modified"))
+
+	// the page may have lost an item since the date, which only the ETag reflects
+	c, res = setUpRequest(http.MethodGet, "/stories")
+	c.Request().Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+
+	require.NoError(t, h.GetStories(c))
+	assert.Equal(t, http.StatusOK, res.Code)
+}
@@ -0,0 +1,239 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MIMEApplicationProblemJSON is the content type of error responses
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// statusClientClosedRequest is the non-standard status used when the client went away before a response
+const statusClientClosedRequest = 499
+
+// Problem is an RFC 7807 problem details body, returned for every error response
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+
+	// retryAfter is sent in the Retry-After header when set
+	retryAfter int
+}
+
+// InvalidParam describes why a request parameter was rejected
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// invalidParams is returned by handlers when query parameters fail validation
+type invalidParams []InvalidParam
+
+func (e invalidParams) Error() string {
+	names := make([]string, len(e))
+	for i, p := range e {
+		names[i] = p.Name
+	}
+
+	return "invalid parameters: " + strings.Join(names, ", ")
+}
+
+// httpStatusFromCode maps gRPC codes to the closest HTTP status
+var httpStatusFromCode = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           statusClientClosedRequest,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// paramNames maps API request fields to the query parameters they are set from
+var paramNames = map[string]string{
+	"page_size":      "limit",
+	"page_token":     "cursor",
+	"query":          "q",
+	"created_after":  "since",
+	"created_before": "until",
+}
+
+// ErrorHandler writes every error as a problem details body. gRPC statuses from the API are mapped to
+// the matching HTTP status, and server side failures are logged rather than exposed to the client
+func ErrorHandler(logger *zap.Logger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		// the client can't be told about failures once the response has started, as with a stream that
+		// fails part way through
+		if c.Response().Committed {
+			logger.Error("request failed after the response was sent", zap.String("path", c.Request().URL.Path), zap.Error(err))
+			return
+		}
+
+		writeProblem(c.Response(), c.Request(), problemFor(err), err, logger)
+	}
+}
+
+// Recover converts panics into errors as echo's Recover middleware does, except http.ErrAbortHandler
+// which is raised again so net/http aborts the response rather than completing it
+func Recover() echo.MiddlewareFunc {
+	recoverPanics := middleware.Recover()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			aborted := false
+			err := recoverPanics(func(c echo.Context) error {
+				defer func() {
+					if r := recover(); r != nil {
+						if r != http.ErrAbortHandler {
+							panic(r)
+						}
+
+						aborted = true
+					}
+				}()
+
+				return next(c)
+			})(c)
+
+			if aborted {
+				panic(http.ErrAbortHandler)
+			}
+
+			return err
+		}
+	}
+}
+
+// writeProblem responds to r with p, logging the error behind server side failures
+func writeProblem(w http.ResponseWriter, r *http.Request, p Problem, err error, logger *zap.Logger) {
+	p.Instance = r.URL.Path
+
+	if p.Status >= http.StatusInternalServerError {
+		logger.Error("handling request", zap.String("path", p.Instance), zap.Int("status", p.Status), zap.Error(err))
+	}
+
+	if p.retryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(p.retryAfter))
+	}
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(p.Status)
+		return
+	}
+
+	w.Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+	w.WriteHeader(p.Status)
+
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		logger.Error("writing error response", zap.Error(err))
+	}
+}
+
+// problemFor converts an error into a problem, hiding the detail of unexpected failures
+func problemFor(err error) Problem {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return newProblem(he.Code, fmt.Sprint(he.Message))
+	}
+
+	var ip invalidParams
+	if errors.As(err, &ip) {
+		p := newProblem(http.StatusBadRequest, "one or more query parameters are invalid")
+		p.InvalidParams = ip
+		return p
+	}
+
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) {
+		return problemForStatus(se.GRPCStatus(), paramNames)
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return newProblem(statusClientClosedRequest, "the request was cancelled")
+	case errors.Is(err, context.DeadlineExceeded):
+		return newProblem(http.StatusGatewayTimeout, "the request timed out")
+	default:
+		return newProblem(http.StatusInternalServerError, "")
+	}
+}
+
+// problemForStatus converts a gRPC status into a problem. Field violations are reported under the
+// name params maps the field to, or the field name when it isn't mapped
+func problemForStatus(st *status.Status, params map[string]string) Problem {
+	code, ok := httpStatusFromCode[st.Code()]
+	if !ok {
+		code = http.StatusInternalServerError
+	}
+
+	// messages of server side failures can include internal details
+	detail := st.Message()
+	switch code {
+	case http.StatusInternalServerError, http.StatusNotImplemented:
+		detail = ""
+	case http.StatusServiceUnavailable:
+		detail = "the service is temporarily unavailable"
+	case http.StatusGatewayTimeout:
+		detail = "the request timed out"
+	}
+
+	p := newProblem(code, detail)
+
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				name := v.GetField()
+				if param, ok := params[name]; ok {
+					name = param
+				}
+
+				p.InvalidParams = append(p.InvalidParams, InvalidParam{Name: name, Reason: v.GetDescription()})
+			}
+		case *errdetails.RetryInfo:
+			p.retryAfter = int(math.Ceil(d.GetRetryDelay().AsDuration().Seconds()))
+		}
+	}
+
+	return p
+}
+
+func newProblem(code int, detail string) Problem {
+	title := http.StatusText(code)
+	if code == statusClientClosedRequest {
+		title = "Client Closed Request"
+	}
+
+	return Problem{
+		Type:   "about:blank",
+		Title:  title,
+		Status: code,
+		Detail: detail,
+	}
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestErrorHandler(t *testing.T) {
+	unavailable, err := status.New(codes.Unavailable, "dial tcp 10.0.0.1:8001: connection refused").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)})
+	require.NoError(t, err)
+
+	invalid, err := status.New(codes.InvalidArgument, "page_token: malformed").
+		WithDetails(&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "page_token", Description: "malformed"}},
+		})
+	require.NoError(t, err)
+
+	type testcase struct {
+		name               string
+		err                error
+		expectedStatusCode int
+		expectedProblem    Problem
+		expectedRetryAfter string
+	}
+
+	tests := []testcase{
+		{
+			name:               "echo error",
+			err:                echo.NewHTTPError(http.StatusBadRequest, "q is required"),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedProblem:    Problem{Type: "about:blank", Title: "Bad Request", Status: 400, Detail: "q is required", Instance: "/search"},
+		},
+		{
+			name:               "invalid query parameters",
+			err:                invalidParams{{Name: "limit", Reason: "must be an integer between 1 and 1000"}},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedProblem: Problem{
+				Type:          "about:blank",
+				Title:         "Bad Request",
+				Status:        400,
+				Detail:        "one or more query parameters are invalid",
+				Instance:      "/search",
+				InvalidParams: []InvalidParam{{Name: "limit", Reason: "must be an integer between 1 and 1000"}},
+			},
+		},
+		{
+			name:               "invalid argument with field violations",
+			err:                errors.Wrap(invalid.Err(), "searching"),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedProblem: Problem{
+				Type:          "about:blank",
+				Title:         "Bad Request",
+				Status:        400,
+				Detail:        "page_token: malformed",
+				Instance:      "/search",
+				InvalidParams: []InvalidParam{{Name: "cursor", Reason: "malformed"}},
+			},
+		},
+		{
+			name:               "unavailable hides the cause and sets retry after",
+			err:                errors.Wrap(unavailable.Err(), "searching"),
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedProblem:    Problem{Type: "about:blank", Title: "Service Unavailable", Status: 503, Detail: "the service is temporarily unavailable", Instance: "/search"},
+			expectedRetryAfter: "2",
+		},
+		{
+			name:               "internal hides the cause",
+			err:                status.Error(codes.Internal, "searching items: relation \"items\" does not exist"),
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedProblem:    Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Instance: "/search"},
+		},
+		{
+			name:               "deadline exceeded",
+			err:                status.Error(codes.DeadlineExceeded, "context deadline exceeded"),
+			expectedStatusCode: http.StatusGatewayTimeout,
+			expectedProblem:    Problem{Type: "about:blank", Title: "Gateway Timeout", Status: 504, Detail: "the request timed out", Instance: "/search"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, res := setUpRequest(http.MethodGet, "/search")
+
+			ErrorHandler(zap.NewNop())(tc.err, c)
+
+			assert.Equal(t, tc.expectedStatusCode, res.Code)
+			assert.Equal(t, MIMEApplicationProblemJSON, res.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, tc.expectedRetryAfter, res.Header().Get("Retry-After"))
+
+			var p Problem
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&p))
+			assert.Equal(t, tc.expectedProblem, p)
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package gateway
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	// MIMEApplicationNDJSON is the media type of newline delimited JSON exports
+	MIMEApplicationNDJSON = "application/x-ndjson"
+	// MIMETextCSV is the media type of CSV exports
+	MIMETextCSV = "text/csv"
+	// MIMEApplicationParquet is the media type of Parquet exports
+	MIMEApplicationParquet = "application/vnd.apache.parquet"
+)
+
+const (
+	// exportFlushRows is how many rows are written between flushes, so clients receive rows as they
+	// are fetched rather than when the response buffer fills
+	exportFlushRows = 500
+	// parquetRowGroupSize bounds the memory used by Parquet exports, which buffer a row group before
+	// writing it
+	parquetRowGroupSize = 8 * 1024 * 1024
+)
+
+// exportFormat is a format items can be exported in
+type exportFormat struct {
+	name      string
+	mediaType string
+	newWriter func(w io.Writer) (exportWriter, error)
+}
+
+// exportFormats are the supported formats in order of preference when the client has none
+var exportFormats = []exportFormat{
+	{name: "ndjson", mediaType: MIMEApplicationNDJSON, newWriter: newNDJSONWriter},
+	{name: "csv", mediaType: MIMETextCSV, newWriter: newCSVWriter},
+	{name: "parquet", mediaType: MIMEApplicationParquet, newWriter: newParquetWriter},
+}
+
+// exportTypes maps the exportable lists to the type of item they contain
+var exportTypes = map[string]string{
+	"all":     "",
+	"stories": "story",
+	"jobs":    "job",
+}
+
+// exportWriter encodes items in an export format
+type exportWriter interface {
+	Write(item models.Item) error
+	Flush() error
+	// Close writes anything the format requires after the last item
+	Close() error
+}
+
+// Export handles requests to GET /export/:list, where list is all, stories or jobs. Every item matching
+// the list filters is streamed in the format given by ?format= or negotiated from the Accept header.
+// limit caps the number of items rather than setting a page size
+func (h *Handler) Export(c echo.Context) error {
+	list := c.Param("list")
+	itemType, ok := exportTypes[list]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("list %s not found", list))
+	}
+
+	params := c.QueryParams()
+	opts, invalid := parseFilterParams(params)
+	opts.Type = itemType
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			invalid = append(invalid, InvalidParam{Name: "limit", Reason: "must be a positive integer"})
+		}
+
+		opts.Limit = limit
+	}
+
+	format, ok := exportFormats[0], true
+	if v := params.Get("format"); v != "" {
+		format, ok = exportFormatNamed(v)
+		if !ok {
+			invalid = append(invalid, InvalidParam{Name: "format", Reason: "must be one of ndjson, csv or parquet"})
+		}
+	} else {
+		format, ok = negotiateExportFormat(c.Request().Header.Get(echo.HeaderAccept))
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotAcceptable, "exports are available as "+strings.Join(exportMediaTypes(), ", "))
+		}
+	}
+
+	if len(invalid) > 0 {
+		return invalid
+	}
+
+	res := c.Response()
+
+	// the response is only started with the first item so failures before then are still problems
+	var (
+		out  exportWriter
+		rows int
+	)
+	start := func() error {
+		res.Header().Set(echo.HeaderContentType, format.mediaType)
+		res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", list+"."+format.name))
+		res.Header().Set("Cache-Control", "no-store")
+		res.WriteHeader(http.StatusOK)
+
+		var err error
+		out, err = format.newWriter(res)
+		return err
+	}
+
+	err := h.HNClient.Export(c.Request().Context(), opts, func(item models.Item) error {
+		if out == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		if err := out.Write(item); err != nil {
+			return err
+		}
+
+		if rows++; rows%exportFlushRows == 0 {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			res.Flush()
+		}
+
+		return nil
+	})
+	if err == nil && out == nil {
+		// an empty export is still a valid file
+		err = start()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+
+	if err != nil {
+		if !res.Committed {
+			return err
+		}
+
+		// a chunked response can't report a failure once started, so the rows written so far are sent and
+		// the connection closed before the final chunk for the client to see the export is incomplete
+		if out != nil {
+			out.Flush()
+		}
+		res.Flush()
+		abortResponse(res)
+		return errors.Wrap(err, fmt.Sprintf("exporting %s after %d rows", list, rows))
+	}
+
+	return nil
+}
+
+// abortResponse closes the connection without completing the response. Writers that can't be hijacked,
+// such as HTTP/2 streams, are aborted by panicking with http.ErrAbortHandler, which resets the stream
+func abortResponse(res *echo.Response) {
+	if hj, ok := res.Writer.(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+	}
+
+	panic(http.ErrAbortHandler)
+}
+
+func exportFormatNamed(name string) (exportFormat, bool) {
+	for _, f := range exportFormats {
+		if f.name == name {
+			return f, true
+		}
+	}
+
+	return exportFormat{}, false
+}
+
+func exportMediaTypes() []string {
+	types := make([]string, len(exportFormats))
+	for i, f := range exportFormats {
+		types[i] = f.mediaType
+	}
+
+	return types
+}
+
+// negotiateExportFormat picks the format the Accept header gives the highest quality. Each format is
+// given the quality of the most specific media range matching it, and ties go to the preferred format
+func negotiateExportFormat(accept string) (exportFormat, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return exportFormats[0], true
+	}
+
+	var (
+		best        exportFormat
+		bestQuality float64
+	)
+	for _, f := range exportFormats {
+		quality, specificity := 0.0, -1
+		for _, r := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+			if err != nil {
+				continue
+			}
+
+			s := mediaRangeSpecificity(mediaType, f.mediaType)
+			if s <= specificity {
+				continue
+			}
+
+			q := 1.0
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					continue
+				}
+			}
+
+			quality, specificity = q, s
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = f, quality
+		}
+	}
+
+	return best, bestQuality > 0
+}
+
+// mediaRangeSpecificity reports how specifically mediaRange matches mediaType, -1 when it doesn't
+func mediaRangeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	case mediaRange == "*/*":
+		return 0
+	default:
+		return -1
+	}
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+// newNDJSONWriter writes each item as a JSON object on its own line, with the same fields as the
+// list routes
+func newNDJSONWriter(w io.Writer) (exportWriter, error) {
+	return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+}
+
+func (w *ndjsonWriter) Write(item models.Item) error {
+	return errors.Wrap(w.enc.Encode(item), "encoding item")
+}
+
+func (w *ndjsonWriter) Flush() error { return nil }
+
+func (w *ndjsonWriter) Close() error { return nil }
+
+// csvColumns are the columns of CSV exports. Columns may be added to the end but never reordered
+var csvColumns = []string{"id", "type", "title", "url", "content", "score", "created_by", "created_at", "updated_at", "version"}
+
+type csvWriter struct {
+	w   *csv.Writer
+	row []string
+}
+
+// newCSVWriter writes a header row followed by a row per item. Times are RFC 3339 in UTC
+func newCSVWriter(w io.Writer) (exportWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), row: make([]string, len(csvColumns))}
+	if err := cw.w.Write(csvColumns); err != nil {
+		return nil, errors.Wrap(err, "writing csv header")
+	}
+
+	return cw, nil
+}
+
+func (w *csvWriter) Write(item models.Item) error {
+	w.row[0] = strconv.Itoa(item.ID)
+	w.row[1] = item.Type
+	w.row[2] = item.Title
+	w.row[3] = item.URL
+	w.row[4] = item.Content
+	w.row[5] = strconv.Itoa(item.Score)
+	w.row[6] = item.CreatedBy
+	w.row[7] = item.CreatedAt.UTC().Format(time.RFC3339)
+	w.row[8] = item.UpdatedAt.UTC().Format(time.RFC3339)
+	w.row[9] = strconv.Itoa(item.Version)
+
+	return errors.Wrap(w.w.Write(w.row), "writing csv row")
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return errors.Wrap(w.w.Error(), "flushing csv rows")
+}
+
+func (w *csvWriter) Close() error {
+	return w.Flush()
+}
+
+// parquetItem is the Parquet schema of exported items, with the same columns as CSV exports
+type parquetItem struct {
+	ID        int32  `parquet:"name=id, type=INT32"`
+	Type      string `parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Title     string `parquet:"name=title, type=BYTE_ARRAY, convertedtype=UTF8"`
+	URL       string `parquet:"name=url, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Content   string `parquet:"name=content, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Score     int32  `parquet:"name=score, type=INT32"`
+	CreatedBy string `parquet:"name=created_by, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	CreatedAt int64  `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	UpdatedAt int64  `parquet:"name=updated_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Version   int32  `parquet:"name=version, type=INT32"`
+}
+
+type parquetWriter struct {
+	pw *writer.ParquetWriter
+}
+
+// newParquetWriter writes items in row groups of at most parquetRowGroupSize, followed by the footer
+// when closed
+func newParquetWriter(w io.Writer) (exportWriter, error) {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetItem), 1)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating parquet writer")
+	}
+	pw.RowGroupSize = parquetRowGroupSize
+
+	return &parquetWriter{pw: pw}, nil
+}
+
+func (w *parquetWriter) Write(item models.Item) error {
+	row := parquetItem{
+		ID:        int32(item.ID),
+		Type:      item.Type,
+		Title:     item.Title,
+		URL:       item.URL,
+		Content:   item.Content,
+		Score:     int32(item.Score),
+		CreatedBy: item.CreatedBy,
+		CreatedAt: item.CreatedAt.UnixMilli(),
+		UpdatedAt: item.UpdatedAt.UnixMilli(),
+		Version:   int32(item.Version),
+	}
+
+	return errors.Wrap(w.pw.Write(row), "writing parquet row")
+}
+
+// Flush is a no-op as row groups are written once full, flushing early would write small row groups
+func (w *parquetWriter) Flush() error { return nil }
+
+func (w *parquetWriter) Close() error {
+	return errors.Wrap(w.pw.WriteStop(), "writing parquet footer")
+}
@@ -0,0 +1,346 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	"go.uber.org/zap"
+)
+
+var exportItems = []models.Item{
+	{
+		ID:        8863,
+		Type:      "story",
+		Title:     `My YC app: "Dropbox", throw away your USB drive`,
+		URL:       "http://www.getdropbox.com/u/2/screencast.html",
+		Score:     104,
+		CreatedAt: time.Date(2007, 4, 4, 19, 16, 40, 0, time.UTC),
+		CreatedBy: "dhouston",
+		Version:   3,
+		UpdatedAt: time.Date(2021, 10, 1, 9, 0, 0, 0, time.UTC),
+	},
+	{
+		ID:        121003,
+		Type:      "job",
+		Title:     "Hiring, remote",
+		Content:   "line one\nline two, with a comma",
+		Score:     1,
+		CreatedAt: time.Date(2008, 2, 22, 0, 0, 0, 0, time.UTC),
+		CreatedBy: "pg",
+		Version:   1,
+		UpdatedAt: time.Date(2008, 2, 22, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+// serveExport requests target, with the Accept header when given, from a handler whose export returns
+// items followed by exportErr
+func serveExport(t *testing.T, target, accept string, items []models.Item, exportErr error) (*hackernews.Mock, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	hn := &hackernews.Mock{}
+	hn.On("Export", mock.Anything, mock.Anything).Return(items, exportErr)
+
+	c, res := setUpRequest(http.MethodGet, target)
+	c.SetParamNames("list")
+	c.SetParamValues(strings.SplitN(c.Request().URL.Path[len("/v1/export/"):], "?", 2)[0])
+	if accept != "" {
+		c.Request().Header.Set(echo.HeaderAccept, accept)
+	}
+
+	h := Handler{HNClient: hn}
+	if err := h.Export(c); err != nil {
+		ErrorHandler(zap.NewNop())(err, c)
+	}
+
+	return hn, res
+}
+
+func TestExportNegotiation(t *testing.T) {
+	type testcase struct {
+		name                string
+		target              string
+		accept              string
+		expectedStatusCode  int
+		expectedContentType string
+	}
+
+	tests := []testcase{
+		{
+			name:                "defaults to ndjson",
+			target:              "/v1/export/all",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: MIMEApplicationNDJSON,
+		},
+		{
+			name:                "any type",
+			target:              "/v1/export/all",
+			accept:              "*/*",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: MIMEApplicationNDJSON,
+		},
+		{
+			name:                "accept csv",
+			target:              "/v1/export/all",
+			accept:              "text/csv",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: MIMETextCSV,
+		},
+		{
+			name:                "accept prefers the highest quality",
+			target:              "/v1/export/all",
+			accept:              "application/x-ndjson;q=0.5, application/vnd.apache.parquet;q=0.9, text/*;q=0.1",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: MIMEApplicationParquet,
+		},
+		{
+			name:                "specific ranges override wildcards",
+			target:              "/v1/export/all",
+			accept:              "*/*, application/x-ndjson;q=0",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: MIMETextCSV,
+		},
+		{
+			name:                "format overrides accept",
+			target:              "/v1/export/all?format=parquet",
+			accept:              "text/csv",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: MIMEApplicationParquet,
+		},
+		{
+			name:                "nothing acceptable",
+			target:              "/v1/export/all",
+			accept:              "application/json",
+			expectedStatusCode:  http.StatusNotAcceptable,
+			expectedContentType: MIMEApplicationProblemJSON,
+		},
+		{
+			name:                "unknown format",
+			target:              "/v1/export/all?format=xlsx",
+			expectedStatusCode:  http.StatusBadRequest,
+			expectedContentType: MIMEApplicationProblemJSON,
+		},
+		{
+			name:                "unknown list",
+			target:              "/v1/export/comments",
+			expectedStatusCode:  http.StatusNotFound,
+			expectedContentType: MIMEApplicationProblemJSON,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, res := serveExport(t, tc.target, tc.accept, exportItems, nil)
+
+			assert.Equal(t, tc.expectedStatusCode, res.Code)
+			assert.Equal(t, tc.expectedContentType, res.Header().Get(echo.HeaderContentType))
+		})
+	}
+}
+
+func TestExportFilters(t *testing.T) {
+	type testcase struct {
+		name               string
+		target             string
+		expectedStatusCode int
+		expectedOpts       hackernews.ListOptions
+	}
+
+	tests := []testcase{
+		{
+			name:               "stories",
+			target:             "/v1/export/stories?author=pg&min_score=10&sort=top",
+			expectedStatusCode: http.StatusOK,
+			expectedOpts:       hackernews.ListOptions{Type: "story", Author: "pg", MinScore: 10, Sort: hackernews.SortTop},
+		},
+		{
+			name:               "limit is not bounded by the page size",
+			target:             "/v1/export/jobs?limit=50000&since=2021-01-01T00:00:00Z",
+			expectedStatusCode: http.StatusOK,
+			expectedOpts:       hackernews.ListOptions{Type: "job", Limit: 50000, Since: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:               "invalid limit",
+			target:             "/v1/export/all?limit=0",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "invalid filter",
+			target:             "/v1/export/all?min_score=high",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hn, res := serveExport(t, tc.target, "", nil, nil)
+
+			assert.Equal(t, tc.expectedStatusCode, res.Code)
+			if tc.expectedStatusCode == http.StatusOK {
+				hn.AssertCalled(t, "Export", mock.Anything, tc.expectedOpts)
+			} else {
+				hn.AssertNotCalled(t, "Export", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	_, res := serveExport(t, "/v1/export/all", "", exportItems, nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `attachment; filename="all.ndjson"`, res.Header().Get(echo.HeaderContentDisposition))
+
+	var items []models.Item
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		var item models.Item
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &item))
+		items = append(items, item)
+	}
+
+	assert.Equal(t, exportItems, items)
+}
+
+func TestExportCSV(t *testing.T) {
+	_, res := serveExport(t, "/v1/export/stories?format=csv", "", exportItems, nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `attachment; filename="stories.csv"`, res.Header().Get(echo.HeaderContentDisposition))
+
+	rows, err := csv.NewReader(res.Body).ReadAll()
+	require.NoError(t, err)
+
+	expected := [][]string{
+		{"id", "type", "title", "url", "content", "score", "created_by", "created_at", "updated_at", "version"},
+		{"8863", "story", exportItems[0].Title, exportItems[0].URL, "", "104", "dhouston", "2007-04-04T19:16:40Z", "2021-10-01T09:00:00Z", "3"},
+		{"121003", "job", "Hiring, remote", "", "line one\nline two, with a comma", "1", "pg", "2008-02-22T00:00:00Z", "2008-02-22T00:00:00Z", "1"},
+	}
+	assert.Equal(t, expected, rows)
+}
+
+func TestExportParquet(t *testing.T) {
+	_, res := serveExport(t, "/v1/export/all?format=parquet", "", exportItems, nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+
+	file, err := buffer.NewBufferFile(res.Body.Bytes())
+	require.NoError(t, err)
+
+	pr, err := reader.NewParquetReader(file, new(parquetItem), 1)
+	require.NoError(t, err)
+	defer pr.ReadStop()
+
+	require.EqualValues(t, len(exportItems), pr.GetNumRows())
+
+	rows := make([]parquetItem, len(exportItems))
+	require.NoError(t, pr.Read(&rows))
+
+	assert.Equal(t, parquetItem{
+		ID:        8863,
+		Type:      "story",
+		Title:     exportItems[0].Title,
+		URL:       exportItems[0].URL,
+		Score:     104,
+		CreatedBy: "dhouston",
+		CreatedAt: exportItems[0].CreatedAt.UnixMilli(),
+		UpdatedAt: exportItems[0].UpdatedAt.UnixMilli(),
+		Version:   3,
+	}, rows[0])
+	assert.Equal(t, int32(121003), rows[1].ID)
+	assert.Equal(t, exportItems[1].Content, rows[1].Content)
+}
+
+func TestExportEmpty(t *testing.T) {
+	for _, format := range exportFormats {
+		t.Run(format.name, func(t *testing.T) {
+			_, res := serveExport(t, "/v1/export/jobs?format="+format.name, "", nil, nil)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, format.mediaType, res.Header().Get(echo.HeaderContentType))
+		})
+	}
+
+	// empty exports are still valid files
+	_, res := serveExport(t, "/v1/export/jobs?format=csv", "", nil, nil)
+	assert.Equal(t, strings.Join(csvColumns, ",")+"\n", res.Body.String())
+
+	_, res = serveExport(t, "/v1/export/jobs?format=parquet", "", nil, nil)
+	file, err := buffer.NewBufferFile(res.Body.Bytes())
+	require.NoError(t, err)
+	pr, err := reader.NewParquetReader(file, new(parquetItem), 1)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, pr.GetNumRows())
+	pr.ReadStop()
+}
+
+func TestExportErrorBeforeFirstItem(t *testing.T) {
+	_, res := serveExport(t, "/v1/export/all", "", nil, errors.New("api unavailable"))
+
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Equal(t, MIMEApplicationProblemJSON, res.Header().Get(echo.HeaderContentType))
+}
+
+func TestExportErrorAfterFirstItem(t *testing.T) {
+	hn := &hackernews.Mock{}
+	hn.On("Export", mock.Anything, mock.Anything).Return(exportItems, errors.New("api unavailable"))
+
+	router := echo.New()
+	router.HTTPErrorHandler = ErrorHandler(zap.NewNop())
+	router.GET("/v1/export/:list", (&Handler{HNClient: hn}).Export)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/v1/export/all?format=csv")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	// the status was sent with the first row, so the failure is signalled by the body ending early
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	body, err := io.ReadAll(res.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.True(t, strings.HasPrefix(string(body), strings.Join(csvColumns, ",")), "rows written before the failure are received")
+}
+
+func TestExportErrorAfterFirstItemOverHTTP2(t *testing.T) {
+	hn := &hackernews.Mock{}
+	hn.On("Export", mock.Anything, mock.Anything).Return(exportItems, errors.New("api unavailable"))
+
+	router := echo.New()
+	router.HTTPErrorHandler = ErrorHandler(zap.NewNop())
+	router.Use(Recover())
+	router.GET("/v1/export/:list", (&Handler{HNClient: hn}).Export)
+
+	// HTTP/2 connections can't be hijacked so the stream is reset instead
+	server := httptest.NewUnstartedServer(router)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	res, err := server.Client().Get(server.URL + "/v1/export/all?format=csv")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, 2, res.ProtoMajor)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	_, err = io.ReadAll(res.Body)
+	assert.Error(t, err, "the body must not end cleanly")
+}
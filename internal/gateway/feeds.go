@@ -0,0 +1,264 @@
+package gateway
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MIMEApplicationRSS is the media type of RSS 2.0 feeds
+	MIMEApplicationRSS = "application/rss+xml"
+	// MIMEApplicationAtom is the media type of Atom 1.0 feeds
+	MIMEApplicationAtom = "application/atom+xml"
+)
+
+// hnItemURL is the Hacker News discussion page of an item. It is the permanent, unique identifier of
+// the item in feeds as the item's own URL may be empty or shared by several items
+const hnItemURL = "https://news.ycombinator.com/item?id=%d"
+
+// feedTitles are the titles of the available feeds
+var feedTitles = map[string]string{
+	"all":     "Hacker News items",
+	"stories": "Hacker News stories",
+	"jobs":    "Hacker News jobs",
+}
+
+// GetFeed handles requests to GET /feeds/:feed, where feed is all, stories or jobs with an .rss or
+// .atom extension. Feeds accept the same filters as the list routes
+func (h *Handler) GetFeed(c echo.Context) error {
+	feed := c.Param("feed")
+	ext := path.Ext(feed)
+	name := strings.TrimSuffix(feed, ext)
+
+	fetch := map[string]fetchPage{
+		"all":     h.HNClient.FetchAll,
+		"stories": h.HNClient.FetchStories,
+		"jobs":    h.HNClient.FetchJobs,
+	}[name]
+	if fetch == nil || (ext != ".rss" && ext != ".atom") {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("feed %s not found", feed))
+	}
+
+	opts, err := parseListParams(c)
+	if err != nil {
+		return err
+	}
+
+	items, _, err := fetch(c.Request().Context(), opts)
+	if err != nil {
+		return err
+	}
+
+	self := c.Scheme() + "://" + c.Request().Host + c.Request().URL.RequestURI()
+
+	// the feed links to itself so the host is part of its version
+	if h.checkNotModified(c, pageValidators(items, self)) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	var (
+		doc         interface{}
+		contentType string
+	)
+	switch ext {
+	case ".rss":
+		doc, contentType = newRSS(feedTitles[name], self, items), MIMEApplicationRSS
+	case ".atom":
+		doc, contentType = newAtom(feedTitles[name], self, items), MIMEApplicationAtom
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding feed")
+	}
+
+	return c.Blob(http.StatusOK, contentType+"; charset=UTF-8", append([]byte(xml.Header), body...))
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description,omitempty"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	Comments    string  `xml:"comments"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// newRSS renders items as an RSS 2.0 channel. Authors are Hacker News usernames rather than the email
+// addresses RSS expects, so they are given as Dublin Core creators
+func newRSS(title, self string, items []models.Item) rss {
+	feed := rss{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        "https://news.ycombinator.com/",
+			Description: title + " stored by gs-onboarding",
+			Self:        atomLink{Href: self, Rel: "self", Type: MIMEApplicationRSS},
+			Items:       make([]rssItem, len(items)),
+		},
+	}
+
+	if updated := lastUpdated(items); !updated.IsZero() {
+		feed.Channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+
+	for i, item := range items {
+		discussion := fmt.Sprintf(hnItemURL, item.ID)
+
+		feed.Channel.Items[i] = rssItem{
+			Title:       item.Title,
+			Link:        itemLink(item),
+			Description: item.Content,
+			Creator:     item.CreatedBy,
+			Comments:    discussion,
+			GUID:        rssGUID{IsPermaLink: true, Value: discussion},
+			PubDate:     item.CreatedAt.UTC().Format(time.RFC1123Z),
+		}
+	}
+
+	return feed
+}
+
+type atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Links     []atomLink   `xml:"link"`
+	Author    atomAuthor   `xml:"author"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Content   *atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// newAtom renders items as an Atom 1.0 feed. The feed's id is its own URL, so each filtered variant
+// is a separate feed
+func newAtom(title, self string, items []models.Item) atom {
+	updated := lastUpdated(items)
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	feed := atom{
+		ID:      self,
+		Title:   title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: MIMEApplicationAtom},
+			{Href: "https://news.ycombinator.com/", Rel: "alternate", Type: "text/html"},
+		},
+		Entries: make([]atomEntry, len(items)),
+	}
+
+	for i, item := range items {
+		discussion := fmt.Sprintf(hnItemURL, item.ID)
+
+		entry := atomEntry{
+			ID:    discussion,
+			Title: item.Title,
+			Links: []atomLink{
+				{Href: itemLink(item), Rel: "alternate"},
+				{Href: discussion, Rel: "replies", Type: "text/html"},
+			},
+			Author:    atomAuthor{Name: item.CreatedBy, URI: "https://news.ycombinator.com/user?id=" + url.QueryEscape(item.CreatedBy)},
+			Published: item.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   itemUpdated(item).UTC().Format(time.RFC3339),
+		}
+
+		// Hacker News text is HTML, which Atom carries escaped
+		if item.Content != "" {
+			entry.Content = &atomContent{Type: "html", Value: item.Content}
+		}
+
+		feed.Entries[i] = entry
+	}
+
+	return feed
+}
+
+// itemLink is where an item's title links to, its own URL when it has one and otherwise its
+// discussion, as for Ask HN posts
+func itemLink(item models.Item) string {
+	if item.URL != "" {
+		return item.URL
+	}
+
+	return fmt.Sprintf(hnItemURL, item.ID)
+}
+
+// itemUpdated is when the item last changed, falling back to when it was created when that isn't known
+func itemUpdated(item models.Item) time.Time {
+	if item.UpdatedAt.Before(item.CreatedAt) {
+		return item.CreatedAt
+	}
+
+	return item.UpdatedAt
+}
+
+func lastUpdated(items []models.Item) time.Time {
+	var last time.Time
+	for _, item := range items {
+		if updated := itemUpdated(item); updated.After(last) {
+			last = updated
+		}
+	}
+
+	return last
+}
@@ -0,0 +1,244 @@
+package gateway
+
+import (
+	"encoding/xml"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var feedItems = []models.Item{
+	{
+		ID:        8863,
+		Type:      "story",
+		Content:   `<p>Tom & Jerry's "cartoon" <script>alert(1)</script></p>`,
+		Score:     104,
+		Title:     "Ask HN: <b>bold</b> & brash?",
+		CreatedAt: time.Date(2021, 9, 30, 18, 4, 5, 0, time.UTC),
+		CreatedBy: "dhouston",
+		Version:   2,
+		UpdatedAt: time.Date(2021, 10, 1, 9, 0, 0, 0, time.UTC),
+	},
+	{
+		ID:        121003,
+		Type:      "story",
+		URL:       "https://example.com/a?b=1&c=2",
+		Score:     12,
+		Title:     "Show HN: an example",
+		CreatedAt: time.Date(2021, 9, 29, 7, 0, 0, 0, time.UTC),
+		CreatedBy: "pg",
+	},
+}
+
+// rssDocument is the subset of RSS 2.0 the feed must provide, decoded independently of the types the
+// handler encodes with
+type rssDocument struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel struct {
+		Title       string `xml:"title"`
+		Description string `xml:"description"`
+		// the channel's link and its atom:link, which the decoder can't tell apart by name alone
+		Links []struct {
+			XMLName xml.Name
+			Href    string `xml:"href,attr"`
+			Rel     string `xml:"rel,attr"`
+			Value   string `xml:",chardata"`
+		} `xml:"link"`
+		LastBuildDate string `xml:"lastBuildDate"`
+		Items         []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			Description string `xml:"description"`
+			Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+			GUID        struct {
+				IsPermaLink string `xml:"isPermaLink,attr"`
+				Value       string `xml:",chardata"`
+			} `xml:"guid"`
+			PubDate string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// atomDocument is the subset of Atom 1.0 the feed must provide
+type atomDocument struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Links   []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Entries []struct {
+		ID    string `xml:"id"`
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Author struct {
+			Name string `xml:"name"`
+		} `xml:"author"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Content   struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"content"`
+	} `xml:"entry"`
+}
+
+// serveFeed requests target from a handler whose lists return items
+func serveFeed(t *testing.T, target string, items []models.Item) (*hackernews.Mock, int, http.Header, []byte) {
+	t.Helper()
+
+	hn := &hackernews.Mock{}
+	hn.On("FetchAll", mock.Anything, mock.Anything).Return(items, "", nil)
+	hn.On("FetchStories", mock.Anything, mock.Anything).Return(items, "", nil)
+	hn.On("FetchJobs", mock.Anything, mock.Anything).Return(items, "", nil)
+
+	c, res := setUpRequest(http.MethodGet, target)
+	c.SetParamNames("feed")
+	c.SetParamValues(c.Request().URL.Path[len("/v1/feeds/"):])
+
+	h := Handler{HNClient: hn}
+	if err := h.GetFeed(c); err != nil {
+		ErrorHandler(zap.NewNop())(err, c)
+	}
+
+	return hn, res.Code, res.Header(), res.Body.Bytes()
+}
+
+func TestRSSFeed(t *testing.T) {
+	hn, code, header, body := serveFeed(t, "/v1/feeds/stories.rss?author=dhouston&min_score=100", feedItems)
+
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "application/rss+xml; charset=UTF-8", header.Get(echo.HeaderContentType))
+	assert.NotEmpty(t, header.Get("ETag"))
+	hn.AssertCalled(t, "FetchStories", mock.Anything, hackernews.ListOptions{Author: "dhouston", MinScore: 100})
+
+	var doc rssDocument
+	require.NoError(t, xml.Unmarshal(body, &doc))
+
+	assert.Equal(t, "2.0", doc.Version)
+	assert.Equal(t, "Hacker News stories", doc.Channel.Title)
+	assert.NotEmpty(t, doc.Channel.Description)
+
+	require.Len(t, doc.Channel.Links, 2)
+	for _, link := range doc.Channel.Links {
+		switch link.XMLName.Space {
+		case "":
+			assert.Equal(t, "https://news.ycombinator.com/", link.Value)
+		case "http://www.w3.org/2005/Atom":
+			assert.Equal(t, "self", link.Rel)
+			assert.Equal(t, "http://example.com/v1/feeds/stories.rss?author=dhouston&min_score=100", link.Href)
+		default:
+			t.Errorf("unexpected link in namespace %s", link.XMLName.Space)
+		}
+	}
+	assert.Equal(t, "Fri, 01 Oct 2021 09:00:00 +0000", doc.Channel.LastBuildDate)
+
+	require.Len(t, doc.Channel.Items, 2)
+
+	first := doc.Channel.Items[0]
+	assert.Equal(t, "Ask HN: <b>bold</b> & brash?", first.Title)
+	assert.Equal(t, "https://news.ycombinator.com/item?id=8863", first.Link, "items without a url link to their discussion")
+	assert.Equal(t, feedItems[0].Content, first.Description)
+	assert.Equal(t, "dhouston", first.Creator)
+	assert.Equal(t, "true", first.GUID.IsPermaLink)
+	assert.Equal(t, "https://news.ycombinator.com/item?id=8863", first.GUID.Value)
+
+	pubDate, err := time.Parse(time.RFC1123Z, first.PubDate)
+	require.NoError(t, err)
+	assert.True(t, feedItems[0].CreatedAt.Equal(pubDate))
+
+	second := doc.Channel.Items[1]
+	assert.Equal(t, "https://example.com/a?b=1&c=2", second.Link)
+	assert.Equal(t, "https://news.ycombinator.com/item?id=121003", second.GUID.Value)
+
+	// markup in items must be escaped rather than interpreted
+	assert.NotContains(t, string(body), "<script>")
+	assert.NotContains(t, string(body), "<b>")
+}
+
+func TestAtomFeed(t *testing.T) {
+	_, code, header, body := serveFeed(t, "/v1/feeds/all.atom", feedItems)
+
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "application/atom+xml; charset=UTF-8", header.Get(echo.HeaderContentType))
+
+	var doc atomDocument
+	require.NoError(t, xml.Unmarshal(body, &doc))
+
+	assert.Equal(t, "http://example.com/v1/feeds/all.atom", doc.ID)
+	assert.Equal(t, "Hacker News items", doc.Title)
+	assert.Equal(t, "2021-10-01T09:00:00Z", doc.Updated)
+	assert.Contains(t, doc.Links, struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	}{Href: "http://example.com/v1/feeds/all.atom", Rel: "self"})
+
+	require.Len(t, doc.Entries, 2)
+
+	first := doc.Entries[0]
+	assert.Equal(t, "https://news.ycombinator.com/item?id=8863", first.ID)
+	assert.Equal(t, "Ask HN: <b>bold</b> & brash?", first.Title)
+	assert.Equal(t, "dhouston", first.Author.Name)
+	assert.Equal(t, "2021-09-30T18:04:05Z", first.Published)
+	assert.Equal(t, "2021-10-01T09:00:00Z", first.Updated)
+	assert.Equal(t, "html", first.Content.Type)
+	assert.Equal(t, feedItems[0].Content, first.Content.Value)
+
+	// entries require an updated time, items without one use when they were created
+	second := doc.Entries[1]
+	assert.Equal(t, "2021-09-29T07:00:00Z", second.Updated)
+	assert.Equal(t, "", second.Content.Type, "items without text have no content")
+	assert.Equal(t, "https://example.com/a?b=1&c=2", second.Links[0].Href)
+	assert.Equal(t, "alternate", second.Links[0].Rel)
+
+	assert.NotContains(t, string(body), "<script>")
+}
+
+func TestFeedErrors(t *testing.T) {
+	type testcase struct {
+		name               string
+		target             string
+		expectedStatusCode int
+	}
+
+	tests := []testcase{
+		{
+			name:               "unknown format",
+			target:             "/v1/feeds/stories.json",
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "unknown feed",
+			target:             "/v1/feeds/comments.rss",
+			expectedStatusCode: http.StatusNotFound,
+		},
+		{
+			name:               "invalid filter",
+			target:             "/v1/feeds/jobs.atom?min_score=high",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, code, header, _ := serveFeed(t, tc.target, nil)
+
+			assert.Equal(t, tc.expectedStatusCode, code)
+			assert.Equal(t, MIMEApplicationProblemJSON, header.Get(echo.HeaderContentType))
+		})
+	}
+}
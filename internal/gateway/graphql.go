@@ -0,0 +1,233 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultGraphQLMaxDepth      = 10
+	defaultGraphQLMaxComplexity = 10000
+
+	// maxGraphQLRequestSize bounds the body of POST requests
+	maxGraphQLRequestSize = 1 << 20
+)
+
+// graphQLRequest is a GraphQL request, sent as the body of a POST or the query parameters of a GET
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQLOption is an interface for a functional option
+type GraphQLOption func(o *graphQLOptions)
+
+type graphQLOptions struct {
+	maxDepth      int
+	maxComplexity int
+}
+
+// WithMaxDepth is a functional option to reject queries nesting fields deeper than depth
+func WithMaxDepth(depth int) GraphQLOption {
+	return func(o *graphQLOptions) {
+		o.maxDepth = depth
+	}
+}
+
+// WithMaxComplexity is a functional option to reject queries estimated to resolve more than complexity
+// values
+func WithMaxComplexity(complexity int) GraphQLOption {
+	return func(o *graphQLOptions) {
+		o.maxComplexity = complexity
+	}
+}
+
+type graphQLHandler struct {
+	schema  graphql.Schema
+	client  hackernews.Client
+	logger  *zap.Logger
+	options *graphQLOptions
+}
+
+// NewGraphQL returns a handler serving GraphQL queries over items, comments and polls with GET
+// or POST. Items are fetched from the API in batches shared by the fields of each level of a query, and
+// queries over the depth or complexity limits are rejected before anything is fetched
+func NewGraphQL(client hackernews.Client, logger *zap.Logger, opts ...GraphQLOption) (http.Handler, error) {
+	o := &graphQLOptions{
+		maxDepth:      defaultGraphQLMaxDepth,
+		maxComplexity: defaultGraphQLMaxComplexity,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	schema, err := newGraphQLSchema(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &graphQLHandler{
+		schema:  schema,
+		client:  client,
+		logger:  logger,
+		options: o,
+	}, nil
+}
+
+func (h *graphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := readGraphQLRequest(w, r)
+	if err != nil {
+		if errors.Is(err, errMethodNotAllowed) {
+			w.Header().Set(echo.HeaderAllow, "GET, POST")
+			h.write(w, http.StatusMethodNotAllowed, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+
+		h.write(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	// requests that can't be executed are rejected with a 400, while execution errors are reported next
+	// to the data that could be resolved
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		h.write(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	if v := graphql.ValidateDocument(&h.schema, doc, nil); !v.IsValid {
+		h.write(w, http.StatusBadRequest, &graphql.Result{Errors: v.Errors})
+		return
+	}
+
+	if err := checkQueryLimits(&h.schema, doc, req.OperationName, req.Variables, h.options.maxDepth, h.options.maxComplexity); err != nil {
+		h.write(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	ctx := withLoaders(r.Context(), newLoaders(h.client))
+	res := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+
+	for i, e := range res.Errors {
+		res.Errors[i] = h.formatError(r, e)
+	}
+
+	h.write(w, http.StatusOK, res)
+}
+
+var errMethodNotAllowed = errors.New("GraphQL requests must be sent with GET or POST")
+
+// readGraphQLRequest reads a request from the query parameters of a GET, where variables is JSON, or the
+// JSON body of a POST
+func readGraphQLRequest(w http.ResponseWriter, r *http.Request) (graphQLRequest, error) {
+	var req graphQLRequest
+
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		req.Query = params.Get("query")
+		req.OperationName = params.Get("operationName")
+		if v := params.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return req, errors.New("variables must be a JSON object")
+			}
+		}
+	case http.MethodPost:
+		mediaType := strings.TrimSpace(strings.Split(r.Header.Get(echo.HeaderContentType), ";")[0])
+		if mediaType != echo.MIMEApplicationJSON {
+			return req, errors.New("the body must be application/json")
+		}
+
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLRequestSize)).Decode(&req); err != nil {
+			return req, errors.New("the body must be a JSON object with a query")
+		}
+	default:
+		return req, errMethodNotAllowed
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		return req, errors.New("a query is required")
+	}
+
+	return req, nil
+}
+
+// apiError marks errors from calls to the API, which are reported with the status and detail of the
+// problem they would be on the REST routes
+type apiError struct {
+	err error
+}
+
+func (e apiError) Error() string {
+	return e.err.Error()
+}
+
+func (e apiError) Unwrap() error {
+	return e.err
+}
+
+// formatError replaces the messages of errors from the API with the detail of their problem, hiding
+// server side failures, and adds the problem's status as an extension
+func (h *graphQLHandler) formatError(r *http.Request, e gqlerrors.FormattedError) gqlerrors.FormattedError {
+	err, ok := apiErrorFrom(e)
+	if !ok {
+		return e
+	}
+
+	p := problemFor(err)
+	if p.Status >= http.StatusInternalServerError {
+		h.logger.Error("resolving graphql field", zap.String("path", r.URL.Path), zap.Any("field", e.Path), zap.Int("status", p.Status), zap.Error(err))
+	}
+
+	e.Message = p.Detail
+	if e.Message == "" {
+		e.Message = p.Title
+	}
+	e.Extensions = map[string]interface{}{"status": p.Status}
+
+	return e
+}
+
+// apiErrorFrom finds the error a resolver returned behind the executor's wrapping, which is wrapped
+// again for errors from thunks
+func apiErrorFrom(err error) (apiError, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case apiError:
+			return e, true
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			return apiError{}, false
+		}
+	}
+
+	return apiError{}, false
+}
+
+func (h *graphQLHandler) write(w http.ResponseWriter, code int, res *graphql.Result) {
+	w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		h.logger.Error("writing graphql response", zap.Error(err))
+	}
+}
@@ -0,0 +1,229 @@
+package gateway
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/pkg/errors"
+)
+
+// queryCost measures how deep an operation nests fields and its complexity, an estimate of how many
+// values resolving it produces. Each field costs one for every object it's selected on, and each list
+// multiplies the cost of the fields beneath it by its size: the first or ids argument of the list or
+// of the field returning the page holding it, or defaultGraphQLFirst when neither bounds it.
+// Introspection fields are free
+type queryCost struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	// maxComplexity stops the multipliers of deeply nested lists growing without bound
+	maxComplexity int
+
+	depth      int
+	complexity int
+}
+
+// checkQueryLimits returns an error when the operation executed for operationName nests fields deeper
+// than maxDepth or is more complex than maxComplexity. The document must have been validated
+func checkQueryLimits(schema *graphql.Schema, doc *ast.Document, operationName string, variables map[string]interface{}, maxDepth, maxComplexity int) error {
+	var (
+		op         *ast.OperationDefinition
+		operations int
+		fragments  = map[string]*ast.FragmentDefinition{}
+	)
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.OperationDefinition:
+			operations++
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				op = def
+			}
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		}
+	}
+
+	// the executor reports a missing or ambiguous operation
+	if op == nil || (operationName == "" && operations > 1) || op.Operation != ast.OperationTypeQuery {
+		return nil
+	}
+
+	c := &queryCost{
+		schema:        schema,
+		fragments:     fragments,
+		variables:     map[string]interface{}{},
+		maxComplexity: maxComplexity,
+	}
+
+	for _, def := range op.VariableDefinitions {
+		name := def.Variable.Name.Value
+		if v, ok := variables[name]; ok {
+			c.variables[name] = v
+		} else if def.DefaultValue != nil {
+			c.variables[name] = c.value(def.DefaultValue)
+		}
+	}
+
+	c.selectionSet(schema.QueryType(), op.SelectionSet, 0, 1, 0, map[string]bool{})
+
+	if c.depth > maxDepth {
+		return errors.Errorf("the query is %d fields deep, more than the limit of %d", c.depth, maxDepth)
+	}
+
+	if c.complexity > maxComplexity {
+		return errors.Errorf("the query has a complexity of at least %d, more than the limit of %d", c.complexity, maxComplexity)
+	}
+
+	return nil
+}
+
+// selectionSet adds the cost of set, selected on multiplier objects of type parent at depth. pageSize
+// is the size of the lists in set when the field returning parent gave it
+func (c *queryCost) selectionSet(parent graphql.Type, set *ast.SelectionSet, depth, multiplier, pageSize int, fragments map[string]bool) {
+	if set == nil || c.complexity > c.maxComplexity {
+		return
+	}
+
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name.Value, "__") {
+				continue
+			}
+
+			def := fieldDefinition(parent, sel.Name.Value)
+			if def == nil {
+				continue
+			}
+
+			if depth+1 > c.depth {
+				c.depth = depth + 1
+			}
+			c.complexity += multiplier
+
+			m, page := multiplier, 0
+			isList := returnsList(def.Type)
+			size, ok := c.size(def, sel)
+			switch {
+			case ok && isList:
+				m *= size
+			case ok:
+				page = size
+			case isList && pageSize > 0:
+				m *= pageSize
+			case isList:
+				m *= defaultGraphQLFirst
+			}
+
+			if m > c.maxComplexity {
+				m = c.maxComplexity + 1
+			}
+
+			c.selectionSet(def.Type, sel.SelectionSet, depth+1, m, page, fragments)
+		case *ast.InlineFragment:
+			t := parent
+			if sel.TypeCondition != nil {
+				t = c.schema.Type(sel.TypeCondition.Name.Value)
+			}
+
+			c.selectionSet(t, sel.SelectionSet, depth, multiplier, pageSize, fragments)
+		case *ast.FragmentSpread:
+			name := sel.Name.Value
+			frag, ok := c.fragments[name]
+			if !ok || fragments[name] {
+				continue
+			}
+
+			fragments[name] = true
+			c.selectionSet(c.schema.Type(frag.TypeCondition.Name.Value), frag.SelectionSet, depth, multiplier, pageSize, fragments)
+			delete(fragments, name)
+		}
+	}
+}
+
+// size returns the size of the list a field returns, or the lists of the page it returns, when its
+// arguments give it
+func (c *queryCost) size(def *graphql.FieldDefinition, field *ast.Field) (int, bool) {
+	for _, arg := range def.Args {
+		switch arg.PrivateName {
+		case "first":
+			first, ok := toInt(c.argument(field, arg.PrivateName))
+			if !ok {
+				first, _ = toInt(arg.DefaultValue)
+			}
+
+			// larger values are rejected when the field is resolved
+			if first < 0 || first > maxGraphQLFirst {
+				first = maxGraphQLFirst
+			}
+			return first, true
+		case "ids":
+			ids, _ := c.argument(field, arg.PrivateName).([]interface{})
+			return len(ids), true
+		}
+	}
+
+	return 0, false
+}
+
+func (c *queryCost) argument(field *ast.Field, name string) interface{} {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value == name {
+			return c.value(arg.Value)
+		}
+	}
+
+	return nil
+}
+
+func (c *queryCost) value(v ast.Value) interface{} {
+	switch v := v.(type) {
+	case *ast.Variable:
+		return c.variables[v.Name.Value]
+	case *ast.IntValue:
+		n, _ := strconv.Atoi(v.Value)
+		return n
+	case *ast.ListValue:
+		values := make([]interface{}, len(v.Values))
+		for i, value := range v.Values {
+			values[i] = c.value(value)
+		}
+		return values
+	default:
+		return v.GetValue()
+	}
+}
+
+// toInt converts an argument to an int, variables decoded from JSON are float64
+func toInt(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+func fieldDefinition(t graphql.Type, name string) *graphql.FieldDefinition {
+	switch t := graphql.GetNamed(t).(type) {
+	case *graphql.Object:
+		return t.Fields()[name]
+	case *graphql.Interface:
+		return t.Fields()[name]
+	default:
+		return nil
+	}
+}
+
+func returnsList(t graphql.Type) bool {
+	if nn, ok := t.(*graphql.NonNull); ok {
+		t = nn.OfType
+	}
+
+	_, ok := t.(*graphql.List)
+	return ok
+}
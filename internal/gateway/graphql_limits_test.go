@@ -0,0 +1,91 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckQueryLimits(t *testing.T) {
+	type testcase struct {
+		name               string
+		query              string
+		operationName      string
+		variables          map[string]interface{}
+		expectedDepth      int
+		expectedComplexity int
+	}
+
+	tests := []testcase{
+		{
+			name:               "single field",
+			query:              `{ item(id: 1) { id } }`,
+			expectedDepth:      2,
+			expectedComplexity: 2,
+		},
+		{
+			name:  "first sizes the page beneath it",
+			query: `{ stories(first: 20) { items { title author } nextCursor } }`,
+			// stories, items and nextCursor, then a title and author for each of the 20 items
+			expectedDepth:      3,
+			expectedComplexity: 1 + 2 + 20*2,
+		},
+		{
+			name:               "defaults size lists",
+			query:              `{ item(id: 1) { ... on Story { scoreHistory { score } comments { text } } } }`,
+			expectedDepth:      3,
+			expectedComplexity: 1 + 1 + 10 + 1 + 10,
+		},
+		{
+			name:               "nested lists multiply",
+			query:              `{ stories(first: 5) { items { comments(first: 4) { replies(first: 3) { text } } } } }`,
+			expectedDepth:      5,
+			expectedComplexity: 1 + 1 + 5 + 5*4 + 5*4*3,
+		},
+		{
+			name:               "variables and fragments",
+			query:              `query($n: Int, $ids: [Int!]!) { items(ids: $ids) { ...story } stories(first: $n) { items { ...story } } } fragment story on Story { title }`,
+			variables:          map[string]interface{}{"n": 3.0, "ids": []interface{}{1.0, 2.0}},
+			expectedDepth:      3,
+			expectedComplexity: 1 + 2 + 1 + 1 + 3,
+		},
+		{
+			name:               "variable defaults",
+			query:              `query($n: Int = 2) { jobs(first: $n) { items { id } } }`,
+			expectedDepth:      3,
+			expectedComplexity: 1 + 1 + 2,
+		},
+		{
+			name:               "only the executed operation",
+			query:              `query A { item(id: 1) { id } } query B { stories { items { id } } }`,
+			operationName:      "A",
+			expectedDepth:      2,
+			expectedComplexity: 2,
+		},
+		{
+			name:               "introspection is free",
+			query:              `{ __schema { types { name fields { name type { ofType { ofType { name } } } } } } item(id: 1) { __typename id } }`,
+			expectedDepth:      2,
+			expectedComplexity: 2,
+		},
+	}
+
+	schema, err := newGraphQLSchema(&hackernews.Mock{})
+	require.NoError(t, err)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: tc.query})
+			require.NoError(t, err)
+			require.True(t, graphql.ValidateDocument(&schema, doc, nil).IsValid)
+
+			assert.NoError(t, checkQueryLimits(&schema, doc, tc.operationName, tc.variables, tc.expectedDepth, tc.expectedComplexity))
+			assert.Error(t, checkQueryLimits(&schema, doc, tc.operationName, tc.variables, tc.expectedDepth-1, tc.expectedComplexity), "depth")
+			assert.Error(t, checkQueryLimits(&schema, doc, tc.operationName, tc.variables, tc.expectedDepth, tc.expectedComplexity-1), "complexity")
+		})
+	}
+}
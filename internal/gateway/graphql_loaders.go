@@ -0,0 +1,273 @@
+package gateway
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+)
+
+type loadersKey struct{}
+
+// loaders batch the calls resolvers make to the API while executing a single query. They only live for
+// the query, so every query sees the latest items
+type loaders struct {
+	client hackernews.Client
+	items  *batchLoader
+
+	mu sync.Mutex
+	// histories has a loader for each set of options score histories are asked for with, so the fields
+	// of a level share a call when their arguments match
+	histories map[hackernews.ScoreHistoryOptions]*batchLoader
+}
+
+func newLoaders(client hackernews.Client) *loaders {
+	return &loaders{
+		client:    client,
+		histories: map[hackernews.ScoreHistoryOptions]*batchLoader{},
+		items: newBatchLoader(func(ctx context.Context, ids []int) (map[int]interface{}, error) {
+			items, err := client.FetchExistingItems(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+
+			values := make(map[int]interface{}, len(items))
+			for id, item := range items {
+				values[id] = item
+			}
+			return values, nil
+		}),
+	}
+}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// item returns a thunk resolving to the item with id, or nil when it doesn't exist
+func (l *loaders) item(ctx context.Context, id int) func() (interface{}, error) {
+	if !validID(id) {
+		return func() (interface{}, error) { return nil, nil }
+	}
+
+	l.items.enqueue(id)
+
+	return func() (interface{}, error) {
+		values, err := l.items.get(ctx, id)
+		if err != nil {
+			return nil, apiError{err}
+		}
+
+		if item, ok := values[id]; ok {
+			return item, nil
+		}
+		return nil, nil
+	}
+}
+
+// itemList returns a thunk resolving to the items with ids in the same order. Items that don't exist
+// are left out unless keepMissing is set, when they are nil
+func (l *loaders) itemList(ctx context.Context, ids []int, keepMissing bool) func() (interface{}, error) {
+	valid := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if validID(id) {
+			valid = append(valid, id)
+		}
+	}
+
+	l.items.enqueue(valid...)
+
+	return func() (interface{}, error) {
+		values, err := l.items.get(ctx, valid...)
+		if err != nil {
+			return nil, apiError{err}
+		}
+
+		items := make([]interface{}, 0, len(ids))
+		for _, id := range ids {
+			if item, ok := values[id]; ok {
+				items = append(items, item)
+			} else if keepMissing {
+				items = append(items, nil)
+			}
+		}
+		return items, nil
+	}
+}
+
+// scoreHistory returns a thunk resolving to the recorded scores of the item with id that match opts,
+// oldest first
+func (l *loaders) scoreHistory(ctx context.Context, id int, opts hackernews.ScoreHistoryOptions) func() (interface{}, error) {
+	histories := l.historyLoader(opts)
+	histories.enqueue(id)
+
+	return func() (interface{}, error) {
+		values, err := histories.get(ctx, id)
+		if err != nil {
+			return nil, apiError{err}
+		}
+
+		history, _ := values[id].([]models.ScoreSample)
+		if history == nil {
+			history = []models.ScoreSample{}
+		}
+		return history, nil
+	}
+}
+
+// historyLoader returns the loader fetching score histories with opts, creating it on first use
+func (l *loaders) historyLoader(opts hackernews.ScoreHistoryOptions) *batchLoader {
+	// the same instant parsed from different offsets shares a loader
+	opts.Since = opts.Since.UTC()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if histories, ok := l.histories[opts]; ok {
+		return histories
+	}
+
+	histories := newBatchLoader(func(ctx context.Context, ids []int) (map[int]interface{}, error) {
+		histories, err := l.client.FetchScoreHistories(ctx, ids, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(map[int]interface{}, len(histories))
+		for id, h := range histories {
+			values[id] = h
+		}
+		return values, nil
+	})
+	l.histories[opts] = histories
+
+	return histories
+}
+
+// validID reports whether an item with id can exist. Ids are stored as 32-bit integers, and the API
+// rejects a whole batch when any of its ids is out of range, so other ids are never batched with them
+func validID(id int) bool {
+	return id > 0 && id <= math.MaxInt32
+}
+
+// primeItems stores items fetched by other calls, such as list pages, so they aren't fetched again
+func (l *loaders) primeItems(items []models.Item) {
+	for _, item := range items {
+		l.items.prime(item.ID, item)
+	}
+}
+
+// batchLoader collects the ids resolvers ask for and fetches every queued id with one call when the
+// first of their values is needed. The executor resolves every field of a level before the values of
+// any, so the fields of a level share a call
+type batchLoader struct {
+	fetch func(ctx context.Context, ids []int) (map[int]interface{}, error)
+
+	mu      sync.Mutex
+	pending []int
+	queued  map[int]bool
+	// loaded holds every fetched id, ids that don't exist have no value
+	loaded map[int]bool
+	values map[int]interface{}
+	errs   map[int]error
+}
+
+func newBatchLoader(fetch func(ctx context.Context, ids []int) (map[int]interface{}, error)) *batchLoader {
+	return &batchLoader{
+		fetch:  fetch,
+		queued: map[int]bool{},
+		loaded: map[int]bool{},
+		values: map[int]interface{}{},
+		errs:   map[int]error{},
+	}
+}
+
+// enqueue queues the ids that haven't been fetched or queued already for the next call
+func (l *batchLoader) enqueue(ids ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, id := range ids {
+		if !l.loaded[id] && !l.queued[id] {
+			l.pending = append(l.pending, id)
+			l.queued[id] = true
+		}
+	}
+}
+
+// get returns the values of the ids that exist, making the call for every queued id if any of ids
+// haven't been fetched. The first error of a call fetching ids is returned
+func (l *batchLoader) get(ctx context.Context, ids ...int) (map[int]interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fetch := false
+	for _, id := range ids {
+		if l.loaded[id] {
+			continue
+		}
+
+		fetch = true
+		if !l.queued[id] {
+			l.pending = append(l.pending, id)
+			l.queued[id] = true
+		}
+	}
+
+	if fetch {
+		l.flush(ctx)
+	}
+
+	values := make(map[int]interface{}, len(ids))
+	for _, id := range ids {
+		if err := l.errs[id]; err != nil {
+			return nil, err
+		}
+
+		if v, ok := l.values[id]; ok {
+			values[id] = v
+		}
+	}
+
+	return values, nil
+}
+
+// prime stores value as fetched for id
+func (l *batchLoader) prime(id int, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.loaded[id] = true
+	l.values[id] = value
+	delete(l.errs, id)
+}
+
+// flush fetches every queued id with a single call
+func (l *batchLoader) flush(ctx context.Context) {
+	ids := l.pending
+	l.pending = nil
+	l.queued = map[int]bool{}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	values, err := l.fetch(ctx, ids)
+	for _, id := range ids {
+		l.loaded[id] = true
+		if err != nil {
+			l.errs[id] = err
+			continue
+		}
+
+		if v, ok := values[id]; ok {
+			l.values[id] = v
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchLoader(t *testing.T) {
+	var calls [][]int
+	l := newBatchLoader(func(ctx context.Context, ids []int) (map[int]interface{}, error) {
+		calls = append(calls, ids)
+
+		values := map[int]interface{}{}
+		for _, id := range ids {
+			// odd ids don't exist
+			if id%2 == 0 {
+				values[id] = id * 10
+			}
+		}
+		return values, nil
+	})
+	ctx := context.Background()
+
+	l.enqueue(2, 3)
+	l.enqueue(3, 4)
+	l.prime(6, 60)
+
+	values, err := l.get(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]interface{}{2: 20}, values)
+
+	// every queued id was fetched with the first
+	values, err = l.get(ctx, 3, 4, 6)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]interface{}{4: 40, 6: 60}, values)
+	assert.Equal(t, [][]int{{2, 3, 4}}, calls)
+
+	// ids that weren't queued are fetched when needed
+	values, err = l.get(ctx, 4, 8)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]interface{}{4: 40, 8: 80}, values)
+	assert.Equal(t, [][]int{{2, 3, 4}, {8}}, calls)
+}
+
+func TestBatchLoaderError(t *testing.T) {
+	l := newBatchLoader(func(ctx context.Context, ids []int) (map[int]interface{}, error) {
+		return nil, errors.New("api unavailable")
+	})
+	ctx := context.Background()
+
+	l.enqueue(1, 2)
+	l.prime(3, 30)
+
+	_, err := l.get(ctx, 1)
+	assert.EqualError(t, err, "api unavailable")
+
+	// the error is kept for every id in the failed call
+	_, err = l.get(ctx, 2, 3)
+	assert.EqualError(t, err, "api unavailable")
+
+	values, err := l.get(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]interface{}{3: 30}, values)
+}
@@ -0,0 +1,438 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/graphql-go/graphql"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxGraphQLFirst is the most items a single list field returns
+	maxGraphQLFirst = 100
+	// defaultGraphQLFirst is how many items list fields return when first isn't given
+	defaultGraphQLFirst = 10
+)
+
+// itemPage is a page of a list of items
+type itemPage struct {
+	items []models.Item
+	next  string
+}
+
+// graphQLResolvers resolve the fields of the schema that call the API
+type graphQLResolvers struct {
+	client hackernews.Client
+}
+
+// newGraphQLSchema builds the schema of items, comments and polls. Items are fetched through the
+// request's loaders so the fields of each level of a query share a call to the API
+func newGraphQLSchema(client hackernews.Client) (graphql.Schema, error) {
+	r := &graphQLResolvers{client: client}
+
+	sortEnum := graphql.NewEnum(graphql.EnumConfig{
+		Name:        "Sort",
+		Description: "The order lists return items in",
+		Values: graphql.EnumValueConfigMap{
+			"NEWEST": {Value: hackernews.SortNewest},
+			"OLDEST": {Value: hackernews.SortOldest},
+			"TOP":    {Value: hackernews.SortTop, Description: "Highest score first"},
+		},
+	})
+
+	scoreSampleType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "ScoreSample",
+		Description: "The score of an item from when it was recorded until the next sample",
+		Fields: graphql.Fields{
+			"score": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(models.ScoreSample).Score, nil
+				},
+			},
+			"recordedAt": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.DateTime),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(models.ScoreSample).RecordedAt, nil
+				},
+			},
+		},
+	})
+
+	var (
+		storyType, jobType, commentType, pollType, pollOptionType *graphql.Object
+		itemInterface                                             *graphql.Interface
+	)
+
+	itemInterface = graphql.NewInterface(graphql.InterfaceConfig{
+		Name:        "Item",
+		Description: "A story, job, comment, poll or poll option",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return itemFields(nil)
+		}),
+		ResolveType: func(p graphql.ResolveTypeParams) *graphql.Object {
+			switch p.Value.(models.Item).Type {
+			case "story":
+				return storyType
+			case "job":
+				return jobType
+			case "comment":
+				return commentType
+			case "poll":
+				return pollType
+			case "pollopt":
+				return pollOptionType
+			default:
+				return nil
+			}
+		},
+	})
+
+	scoreHistoryField := &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(scoreSampleType))),
+		Description: "The first scores recorded for the item since a time, oldest first",
+		Args: graphql.FieldConfigArgument{
+			"first": firstArg(),
+			"since": {Type: graphql.DateTime, Description: "Only return scores recorded at or after this time"},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			first, err := firstFrom(p.Args)
+			if err != nil {
+				return nil, err
+			}
+
+			opts := hackernews.ScoreHistoryOptions{First: first}
+			opts.Since, _ = p.Args["since"].(time.Time)
+
+			return loadersFrom(p.Context).scoreHistory(p.Context, p.Source.(models.Item).ID, opts), nil
+		},
+	}
+
+	commentCountField := &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "The total number of comments, including replies",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(models.Item).Descendants, nil
+		},
+	}
+
+	commentsField := func() *graphql.Field {
+		return &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(commentType))),
+			Description: "The first direct replies in ranked order",
+			Args:        graphql.FieldConfigArgument{"first": firstArg()},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				first, err := firstFrom(p.Args)
+				if err != nil {
+					return nil, err
+				}
+
+				kids := p.Source.(models.Item).Kids
+				if len(kids) > first {
+					kids = kids[:first]
+				}
+				return loadersFrom(p.Context).itemList(p.Context, kids, false), nil
+			},
+		}
+	}
+
+	storyType = graphql.NewObject(graphql.ObjectConfig{
+		Name:       "Story",
+		Interfaces: []*graphql.Interface{itemInterface},
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return itemFields(graphql.Fields{
+				"title":        stringField(func(i models.Item) string { return i.Title }),
+				"url":          stringField(func(i models.Item) string { return i.URL }),
+				"text":         stringField(func(i models.Item) string { return i.Content }),
+				"score":        intField(func(i models.Item) int { return i.Score }),
+				"commentCount": commentCountField,
+				"comments":     commentsField(),
+				"scoreHistory": scoreHistoryField,
+			})
+		}),
+	})
+
+	jobType = graphql.NewObject(graphql.ObjectConfig{
+		Name:       "Job",
+		Interfaces: []*graphql.Interface{itemInterface},
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return itemFields(graphql.Fields{
+				"title": stringField(func(i models.Item) string { return i.Title }),
+				"url":   stringField(func(i models.Item) string { return i.URL }),
+				"text":  stringField(func(i models.Item) string { return i.Content }),
+				"score": intField(func(i models.Item) int { return i.Score }),
+			})
+		}),
+	})
+
+	commentType = graphql.NewObject(graphql.ObjectConfig{
+		Name:       "Comment",
+		Interfaces: []*graphql.Interface{itemInterface},
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return itemFields(graphql.Fields{
+				"text": stringField(func(i models.Item) string { return i.Content }),
+				"parent": &graphql.Field{
+					Type:        itemInterface,
+					Description: "The story, poll or comment replied to, null if it hasn't been stored yet",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).item(p.Context, p.Source.(models.Item).Parent), nil
+					},
+				},
+				"replies": commentsField(),
+			})
+		}),
+	})
+
+	pollType = graphql.NewObject(graphql.ObjectConfig{
+		Name:       "Poll",
+		Interfaces: []*graphql.Interface{itemInterface},
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return itemFields(graphql.Fields{
+				"title":        stringField(func(i models.Item) string { return i.Title }),
+				"text":         stringField(func(i models.Item) string { return i.Content }),
+				"score":        intField(func(i models.Item) int { return i.Score }),
+				"commentCount": commentCountField,
+				"comments":     commentsField(),
+				"scoreHistory": scoreHistoryField,
+				"options": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(pollOptionType))),
+					Description: "The options of the poll in display order",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).itemList(p.Context, p.Source.(models.Item).Parts, false), nil
+					},
+				},
+			})
+		}),
+	})
+
+	pollOptionType = graphql.NewObject(graphql.ObjectConfig{
+		Name:       "PollOption",
+		Interfaces: []*graphql.Interface{itemInterface},
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return itemFields(graphql.Fields{
+				"text":  stringField(func(i models.Item) string { return i.Content }),
+				"score": intField(func(i models.Item) int { return i.Score }),
+				"poll": &graphql.Field{
+					Type: pollType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).item(p.Context, p.Source.(models.Item).Parent), nil
+					},
+				},
+			})
+		}),
+	})
+
+	listArgs := func() graphql.FieldConfigArgument {
+		return graphql.FieldConfigArgument{
+			"first":    firstArg(),
+			"after":    {Type: graphql.String, Description: "The nextCursor of the previous page"},
+			"sort":     {Type: sortEnum},
+			"author":   {Type: graphql.String},
+			"minScore": {Type: graphql.Int},
+		}
+	}
+
+	listField := func(name string, t *graphql.Object, fetch listFunc, itemType string) *graphql.Field {
+		return &graphql.Field{
+			Type:        graphql.NewNonNull(pageType(name, t)),
+			Description: "Newest first unless sorted otherwise",
+			Args:        listArgs(),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				opts, err := listOptions(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				opts.Type = itemType
+
+				return r.page(p, fetch, opts)
+			},
+		}
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"item": &graphql.Field{
+				Type:        itemInterface,
+				Description: "The item with id, null if it doesn't exist",
+				Args: graphql.FieldConfigArgument{
+					"id": {Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersFrom(p.Context).item(p.Context, p.Args["id"].(int)), nil
+				},
+			},
+			"items": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(itemInterface)),
+				Description: "The items with ids in the same order, null for those that don't exist",
+				Args: graphql.FieldConfigArgument{
+					"ids": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.Int)))},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					args := p.Args["ids"].([]interface{})
+					if len(args) > maxGraphQLFirst {
+						return nil, apiError{echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("at most %d ids can be requested", maxGraphQLFirst))}
+					}
+
+					ids := make([]int, len(args))
+					for i, id := range args {
+						ids[i] = id.(int)
+					}
+					return loadersFrom(p.Context).itemList(p.Context, ids, true), nil
+				},
+			},
+			"stories": listField("StoryPage", storyType, r.client.FetchStories, ""),
+			"jobs":    listField("JobPage", jobType, r.client.FetchJobs, ""),
+			"polls":   listField("PollPage", pollType, r.client.FetchAll, "poll"),
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: query,
+		Types: []graphql.Type{storyType, jobType, commentType, pollType, pollOptionType},
+	})
+	if err != nil {
+		return graphql.Schema{}, errors.Wrap(err, "building graphql schema")
+	}
+
+	return schema, nil
+}
+
+// listFunc fetches a page of a list of items
+type listFunc func(ctx context.Context, opts hackernews.ListOptions) ([]models.Item, string, error)
+
+// page fetches a page of items, storing them in the request's loaders for fields that refer back to them
+func (r *graphQLResolvers) page(p graphql.ResolveParams, fetch listFunc, opts hackernews.ListOptions) (interface{}, error) {
+	items, next, err := fetch(p.Context, opts)
+	if err != nil {
+		return nil, apiError{err}
+	}
+
+	loadersFrom(p.Context).primeItems(items)
+
+	return itemPage{items: items, next: next}, nil
+}
+
+// itemFields are the fields of the Item interface along with extra fields of an implementation
+func itemFields(extra graphql.Fields) graphql.Fields {
+	fields := graphql.Fields{
+		"id": intField(func(i models.Item) int { return i.ID }),
+		"author": &graphql.Field{
+			Type:        graphql.String,
+			Description: "The username of who submitted the item, null for deleted items. Lists take it as their author argument",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if by := p.Source.(models.Item).CreatedBy; by != "" {
+					return by, nil
+				}
+				return nil, nil
+			},
+		},
+		"createdAt": timeField(func(i models.Item) time.Time { return i.CreatedAt }),
+		"updatedAt": timeField(func(i models.Item) time.Time { return i.UpdatedAt }),
+		"version": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Int),
+			Description: "Starts at 1 and increases every time the item changes",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.Item).Version, nil
+			},
+		},
+	}
+
+	for name, f := range extra {
+		fields[name] = f
+	}
+
+	return fields
+}
+
+// pageType is a page of a list of items of type t
+func pageType(name string, t graphql.Type) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name,
+		Fields: graphql.Fields{
+			"items": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(t))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(itemPage).items, nil
+				},
+			},
+			"nextCursor": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Passed as after to fetch the next page, null on the last page",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if next := p.Source.(itemPage).next; next != "" {
+						return next, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+}
+
+func stringField(get func(models.Item) string) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.String),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(models.Item)), nil
+		},
+	}
+}
+
+func intField(get func(models.Item) int) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.Int),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(models.Item)), nil
+		},
+	}
+}
+
+func timeField(get func(models.Item) time.Time) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.DateTime),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(models.Item)), nil
+		},
+	}
+}
+
+func firstArg() *graphql.ArgumentConfig {
+	return &graphql.ArgumentConfig{
+		Type:         graphql.Int,
+		DefaultValue: defaultGraphQLFirst,
+		Description:  fmt.Sprintf("How many items to return, at most %d", maxGraphQLFirst),
+	}
+}
+
+// firstFrom reads the first argument, which must be between 1 and maxGraphQLFirst
+func firstFrom(args map[string]interface{}) (int, error) {
+	first, _ := args["first"].(int)
+	if first < 1 || first > maxGraphQLFirst {
+		return 0, apiError{echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("first must be between 1 and %d", maxGraphQLFirst))}
+	}
+
+	return first, nil
+}
+
+// listOptions converts the arguments of list fields into list options
+func listOptions(args map[string]interface{}) (hackernews.ListOptions, error) {
+	first, err := firstFrom(args)
+	if err != nil {
+		return hackernews.ListOptions{}, err
+	}
+
+	opts := hackernews.ListOptions{Limit: first}
+	opts.Cursor, _ = args["after"].(string)
+	opts.Sort, _ = args["sort"].(hackernews.Sort)
+	opts.Author, _ = args["author"].(string)
+	opts.MinScore, _ = args["minScore"].(int)
+
+	return opts, nil
+}
@@ -0,0 +1,382 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// serveGraphQL posts query with variables to a GraphQL handler backed by hn
+func serveGraphQL(t *testing.T, hn *hackernews.Mock, query string, variables map[string]interface{}, opts ...GraphQLOption) *httptest.ResponseRecorder {
+	t.Helper()
+
+	h, err := NewGraphQL(hn, zap.NewNop(), opts...)
+	require.NoError(t, err)
+
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	return res
+}
+
+// sortGraphQLErrors orders the errors of a response body by path. The executor doesn't resolve the top
+// level fields of a query in a fixed order, so their errors aren't either
+func sortGraphQLErrors(t *testing.T, body string) string {
+	t.Helper()
+
+	var res map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(body), &res))
+
+	errs, _ := res["errors"].([]interface{})
+	path := func(i int) string {
+		return fmt.Sprint(errs[i].(map[string]interface{})["path"])
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return path(i) < path(j) })
+
+	sorted, err := json.Marshal(res)
+	require.NoError(t, err)
+
+	return string(sorted)
+}
+
+func TestGraphQLRequests(t *testing.T) {
+	type testcase struct {
+		name               string
+		method             string
+		target             string
+		contentType        string
+		body               string
+		expectedStatusCode int
+		expectedBody       string
+	}
+
+	tests := []testcase{
+		{
+			name:               "get",
+			method:             http.MethodGet,
+			target:             "/graphql?" + url.Values{"query": {`{ item(id: 0) { id } }`}}.Encode(),
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":{"item":null}}`,
+		},
+		{
+			name:               "get with variables and an operation",
+			method:             http.MethodGet,
+			target:             "/graphql?" + url.Values{"query": {`query A { a: item(id: 1) { id } } query B($id: Int!) { item(id: $id) { id } }`}, "variables": {`{"id":0}`}, "operationName": {"B"}}.Encode(),
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":{"item":null}}`,
+		},
+		{
+			name:               "post",
+			method:             http.MethodPost,
+			target:             "/graphql",
+			contentType:        "application/json; charset=utf-8",
+			body:               `{"query":"query($id: Int!) { item(id: $id) { id } }","variables":{"id":0}}`,
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":{"item":null}}`,
+		},
+		{
+			name:               "post without json",
+			method:             http.MethodPost,
+			target:             "/graphql",
+			contentType:        "application/graphql",
+			body:               `{ item(id: 0) { id } }`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"data":null,"errors":[{"message":"the body must be application/json","locations":[]}]}`,
+		},
+		{
+			name:               "malformed variables",
+			method:             http.MethodGet,
+			target:             "/graphql?" + url.Values{"query": {`{ item(id: 0) { id } }`}, "variables": {`[1]`}}.Encode(),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"data":null,"errors":[{"message":"variables must be a JSON object","locations":[]}]}`,
+		},
+		{
+			name:               "missing query",
+			method:             http.MethodGet,
+			target:             "/graphql",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"data":null,"errors":[{"message":"a query is required","locations":[]}]}`,
+		},
+		{
+			name:               "syntax error",
+			method:             http.MethodGet,
+			target:             "/graphql?query=%7B",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "unknown field",
+			method:             http.MethodGet,
+			target:             "/graphql?" + url.Values{"query": {`{ item(id: 1) { karma } }`}}.Encode(),
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"data":null,"errors":[{"message":"Cannot query field \"karma\" on type \"Item\".","locations":[{"line":1,"column":17}]}]}`,
+		},
+		{
+			name:               "method not allowed",
+			method:             http.MethodDelete,
+			target:             "/graphql",
+			expectedStatusCode: http.StatusMethodNotAllowed,
+			expectedBody:       `{"data":null,"errors":[{"message":"GraphQL requests must be sent with GET or POST","locations":[]}]}`,
+		},
+	}
+
+	h, err := NewGraphQL(&hackernews.Mock{}, zap.NewNop())
+	require.NoError(t, err)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tc.contentType)
+			}
+			res := httptest.NewRecorder()
+
+			h.ServeHTTP(res, req)
+
+			assert.Equal(t, tc.expectedStatusCode, res.Code)
+			assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, res.Header().Get(echo.HeaderContentType))
+			if tc.expectedBody != "" {
+				assert.JSONEq(t, tc.expectedBody, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestGraphQLBatchesCalls(t *testing.T) {
+	created := time.Date(2021, 10, 1, 9, 0, 0, 0, time.UTC)
+
+	hn := &hackernews.Mock{}
+	hn.On("FetchStories", mock.Anything, hackernews.ListOptions{Limit: 2, Sort: hackernews.SortTop}).Return([]models.Item{
+		{ID: 1, Type: "story", Title: "First", CreatedBy: "pg", Kids: []int{11, 12}, Descendants: 3},
+		{ID: 2, Type: "story", Title: "Second", CreatedBy: "dang", Kids: []int{13, 14}, Descendants: 1},
+	}, "next", nil)
+	// 14 hasn't been stored yet
+	hn.On("FetchExistingItems", mock.Anything, []int{11, 12, 13, 14}).Return(map[int]models.Item{
+		11: {ID: 11, Type: "comment", Content: "a", CreatedBy: "dang", Parent: 1, Kids: []int{21}},
+		12: {ID: 12, Type: "comment", Content: "b", CreatedBy: "pg", Parent: 1},
+		13: {ID: 13, Type: "comment", Content: "c", CreatedBy: "pg", Parent: 2},
+	}, nil)
+	hn.On("FetchExistingItems", mock.Anything, []int{21}).Return(map[int]models.Item{
+		21: {ID: 21, Type: "comment", Content: "d", CreatedBy: "tptacek", Parent: 11},
+	}, nil)
+	hn.On("FetchScoreHistories", mock.Anything, []int{1, 2}, hackernews.ScoreHistoryOptions{First: 10}).Return(map[int][]models.ScoreSample{
+		1: {{Score: 1, RecordedAt: created}, {Score: 5, RecordedAt: created.Add(time.Hour)}},
+	}, nil)
+
+	query := `{
+		stories(first: 2, sort: TOP) {
+			items {
+				title
+				author
+				commentCount
+				scoreHistory { score recordedAt }
+				comments {
+					text
+					author
+					parent { id }
+					replies { text }
+				}
+			}
+			nextCursor
+		}
+	}`
+
+	res := serveGraphQL(t, hn, query, nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"data":{"stories":{"items":[
+		{
+			"title": "First", "author": "pg", "commentCount": 3,
+			"scoreHistory": [{"score": 1, "recordedAt": "2021-10-01T09:00:00Z"}, {"score": 5, "recordedAt": "2021-10-01T10:00:00Z"}],
+			"comments": [
+				{"text": "a", "author": "dang", "parent": {"id": 1}, "replies": [{"text": "d"}]},
+				{"text": "b", "author": "pg", "parent": {"id": 1}, "replies": []}
+			]
+		},
+		{
+			"title": "Second", "author": "dang", "commentCount": 1,
+			"scoreHistory": [],
+			"comments": [{"text": "c", "author": "pg", "parent": {"id": 2}, "replies": []}]
+		}
+	], "nextCursor": "next"}}}`, res.Body.String())
+
+	// the comments of every story are fetched together, then every reply, and the stories fetched by the
+	// list aren't fetched again as parents
+	hn.AssertNumberOfCalls(t, "FetchExistingItems", 2)
+	hn.AssertNumberOfCalls(t, "FetchScoreHistories", 1)
+}
+
+func TestGraphQLItems(t *testing.T) {
+	hn := &hackernews.Mock{}
+	hn.On("FetchExistingItems", mock.Anything, []int{126809, 126810, 5}).Return(map[int]models.Item{
+		126809: {ID: 126809, Type: "poll", Title: "Poll", Parts: []int{126810, 126811}},
+		126810: {ID: 126810, Type: "pollopt", Content: "Yes", Score: 10, Parent: 126809},
+	}, nil)
+	hn.On("FetchExistingItems", mock.Anything, []int{126811}).Return(map[int]models.Item{
+		126811: {ID: 126811, Type: "pollopt", Content: "No", Score: 4, Parent: 126809},
+	}, nil)
+
+	query := `query($ids: [Int!]!) {
+		items(ids: $ids) {
+			__typename
+			id
+			... on Poll { title options { text score } }
+			... on PollOption { text poll { id } }
+		}
+	}`
+
+	res := serveGraphQL(t, hn, query, map[string]interface{}{"ids": []int{126809, 126810, 5}})
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"data":{"items":[
+		{"__typename": "Poll", "id": 126809, "title": "Poll", "options": [{"text": "Yes", "score": 10}, {"text": "No", "score": 4}]},
+		{"__typename": "PollOption", "id": 126810, "text": "Yes", "poll": {"id": 126809}},
+		null
+	]}}`, res.Body.String())
+}
+
+func TestGraphQLInvalidIDs(t *testing.T) {
+	hn := &hackernews.Mock{}
+	hn.On("FetchExistingItems", mock.Anything, []int{1}).Return(map[int]models.Item{
+		1: {ID: 1, Type: "story", Title: "Intro"},
+	}, nil)
+
+	// ids that can't exist would fail the whole batch if they were sent with the valid ones
+	res := serveGraphQL(t, hn, `{ items(ids: [1, -1, 0]) { id } item(id: -1) { id } }`, nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"data":{"items":[{"id": 1}, null, null],"item":null}}`, res.Body.String())
+	hn.AssertNumberOfCalls(t, "FetchExistingItems", 1)
+}
+
+func TestGraphQLScoreHistoryArguments(t *testing.T) {
+	since := time.Date(2021, 10, 1, 9, 0, 0, 0, time.UTC)
+
+	hn := &hackernews.Mock{}
+	hn.On("FetchExistingItems", mock.Anything, []int{1, 2}).Return(map[int]models.Item{
+		1: {ID: 1, Type: "story", Title: "First"},
+		2: {ID: 2, Type: "story", Title: "Second"},
+	}, nil)
+	hn.On("FetchScoreHistories", mock.Anything, []int{1, 2}, hackernews.ScoreHistoryOptions{First: 2, Since: since}).Return(map[int][]models.ScoreSample{
+		1: {{Score: 5, RecordedAt: since}},
+	}, nil)
+	hn.On("FetchScoreHistories", mock.Anything, []int{1, 2}, hackernews.ScoreHistoryOptions{First: 10}).Return(map[int][]models.ScoreSample{
+		1: {{Score: 1, RecordedAt: since.Add(-time.Hour)}, {Score: 5, RecordedAt: since}},
+	}, nil)
+
+	// the same instant in another offset shares the call
+	query := `{
+		items(ids: [1, 2]) {
+			... on Story {
+				recent: scoreHistory(first: 2, since: "2021-10-01T09:00:00Z") { score }
+				again: scoreHistory(first: 2, since: "2021-10-01T10:00:00+01:00") { score }
+				scoreHistory { score }
+			}
+		}
+	}`
+
+	res := serveGraphQL(t, hn, query, nil)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"data":{"items":[
+		{"recent": [{"score": 5}], "again": [{"score": 5}], "scoreHistory": [{"score": 1}, {"score": 5}]},
+		{"recent": [], "again": [], "scoreHistory": []}
+	]}}`, res.Body.String())
+	hn.AssertNumberOfCalls(t, "FetchScoreHistories", 2)
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	type testcase struct {
+		name         string
+		query        string
+		setUpMock    func(hn *hackernews.Mock)
+		expectedBody string
+	}
+
+	tests := []testcase{
+		{
+			name:  "api unavailable",
+			query: `{ stories { items { id } } }`,
+			setUpMock: func(hn *hackernews.Mock) {
+				hn.On("FetchStories", mock.Anything, mock.Anything).Return(nil, "", status.Error(codes.Unavailable, "connection refused"))
+			},
+			expectedBody: `{"data":null,"errors":[{
+				"message": "the service is temporarily unavailable",
+				"locations": [{"line": 1, "column": 3}],
+				"path": ["stories"],
+				"extensions": {"status": 503}
+			}]}`,
+		},
+		{
+			name:  "batch failure",
+			query: `{ a: item(id: 1) { id } b: item(id: 2) { id } }`,
+			setUpMock: func(hn *hackernews.Mock) {
+				// top level fields aren't resolved in a fixed order, so the ids may be fetched in either order or apart
+				hn.On("FetchExistingItems", mock.Anything, mock.Anything).Return(nil, status.Error(codes.Internal, "database is down"))
+			},
+			expectedBody: `{"data":{"a":null,"b":null},"errors":[
+				{"message": "Internal Server Error", "locations": [{"line": 1, "column": 3}], "path": ["a"], "extensions": {"status": 500}},
+				{"message": "Internal Server Error", "locations": [{"line": 1, "column": 25}], "path": ["b"], "extensions": {"status": 500}}
+			]}`,
+		},
+		{
+			name:  "first out of range",
+			query: `{ jobs(first: 101) { items { id } } }`,
+			expectedBody: `{"data":null,"errors":[{
+				"message": "first must be between 1 and 100",
+				"locations": [{"line": 1, "column": 3}],
+				"path": ["jobs"],
+				"extensions": {"status": 400}
+			}]}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hn := &hackernews.Mock{}
+			if tc.setUpMock != nil {
+				tc.setUpMock(hn)
+			}
+
+			res := serveGraphQL(t, hn, tc.query, nil)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.JSONEq(t, tc.expectedBody, sortGraphQLErrors(t, res.Body.String()))
+		})
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	hn := &hackernews.Mock{}
+
+	res := serveGraphQL(t, hn, `{ stories(first: 50) { items { comments(first: 50) { text } } } }`, nil, WithMaxComplexity(1000))
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.JSONEq(t, `{"data":null,"errors":[{"message":"the query has a complexity of at least 1053, more than the limit of 1000","locations":[]}]}`, res.Body.String())
+	hn.AssertNotCalled(t, "FetchStories", mock.Anything, mock.Anything)
+
+	res = serveGraphQL(t, hn, `{ item(id: 1) { ... on Comment { parent { ... on Comment { parent { id } } } } } }`, nil, WithMaxDepth(2))
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.JSONEq(t, `{"data":null,"errors":[{"message":"the query is 4 fields deep, more than the limit of 2","locations":[]}]}`, res.Body.String())
+}
@@ -0,0 +1,170 @@
+package hackernews
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is a circuit breaker that fails calls fast once the API has failed threshold times in a row.
+// After cooldown a single trial call is let through, closing the breaker again if it succeeds
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	// openedAt is when the breaker opened, or when the trial call started while half open
+	openedAt time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a call may be made, returning an Unavailable status with the time left until the
+// next trial call when it may not
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		remaining := b.cooldown - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return openError(remaining)
+		}
+
+		b.state = breakerHalfOpen
+		b.openedAt = b.now()
+		return nil
+	case breakerHalfOpen:
+		// a trial call is in flight, unless it never reported back, like a stream abandoned part way
+		remaining := b.cooldown - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return openError(remaining)
+		}
+
+		b.openedAt = b.now()
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the outcome of a call it allowed
+func (b *breaker) record(err error) {
+	// a cancelled call says nothing about the API's health
+	if status.Code(err) == codes.Canceled {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isFailure(err) {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// isFailure reports whether err means the API is unhealthy. Errors caused by the request, such as
+// NotFound or InvalidArgument, don't count
+func isFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+func openError(retryAfter time.Duration) error {
+	st := status.New(codes.Unavailable, "api circuit breaker is open")
+	if d, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+		st = d
+	}
+
+	return st.Err()
+}
+
+// unaryInterceptor fails unary calls fast while the breaker is open
+func (b *breaker) unaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := b.allow(); err != nil {
+			return err
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.record(err)
+
+		return err
+	}
+}
+
+// streamInterceptor fails streams fast while the breaker is open. A stream's outcome is recorded when it
+// fails to start or when it ends
+func (b *breaker) streamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := b.allow(); err != nil {
+			return nil, err
+		}
+
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			b.record(err)
+			return nil, err
+		}
+
+		return &recordedStream{ClientStream: s, breaker: b}, nil
+	}
+}
+
+type recordedStream struct {
+	grpc.ClientStream
+	breaker *breaker
+	once    sync.Once
+}
+
+func (s *recordedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.once.Do(func() {
+			if err == io.EOF {
+				s.breaker.record(nil)
+			} else {
+				s.breaker.record(err)
+			}
+		})
+	}
+
+	return err
+}
@@ -0,0 +1,135 @@
+package hackernews
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreaker(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	notFound := status.Error(codes.NotFound, "item not found")
+	cancelled := status.Error(codes.Canceled, "context canceled")
+
+	type step struct {
+		advance time.Duration
+		// result is recorded when the call is allowed, unless the call is left in flight
+		result        error
+		inFlight      bool
+		expectAllowed bool
+	}
+
+	type testcase struct {
+		name  string
+		steps []step
+	}
+
+	tests := []testcase{
+		{
+			name: "opens after consecutive failures",
+			steps: []step{
+				{result: unavailable, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{expectAllowed: false},
+			},
+		},
+		{
+			name: "a success resets the failure count",
+			steps: []step{
+				{result: unavailable, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{result: nil, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{expectAllowed: true},
+			},
+		},
+		{
+			name: "request errors are not failures",
+			steps: []step{
+				{result: notFound, expectAllowed: true},
+				{result: notFound, expectAllowed: true},
+				{result: cancelled, expectAllowed: true},
+				{result: notFound, expectAllowed: true},
+				{expectAllowed: true},
+			},
+		},
+		{
+			name: "a successful trial call closes the breaker",
+			steps: []step{
+				{result: unavailable, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{advance: 10 * time.Second, result: nil, expectAllowed: true},
+				{result: nil, expectAllowed: true},
+			},
+		},
+		{
+			name: "a failed trial call reopens the breaker",
+			steps: []step{
+				{result: unavailable, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{advance: 10 * time.Second, result: unavailable, expectAllowed: true},
+				{advance: 5 * time.Second, expectAllowed: false},
+				{advance: 5 * time.Second, result: nil, expectAllowed: true},
+			},
+		},
+		{
+			name: "one trial call at a time",
+			steps: []step{
+				{result: unavailable, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{result: unavailable, expectAllowed: true},
+				{advance: 10 * time.Second, inFlight: true, expectAllowed: true},
+				{expectAllowed: false},
+				// an abandoned trial is replaced once the cooldown passes
+				{advance: 10 * time.Second, expectAllowed: true},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			b := newBreaker(3, 10*time.Second)
+			b.now = func() time.Time { return now }
+
+			for i, s := range tc.steps {
+				now = now.Add(s.advance)
+
+				err := b.allow()
+				if !assert.Equal(t, s.expectAllowed, err == nil, "step %d", i) {
+					return
+				}
+
+				if err == nil && !s.inFlight {
+					b.record(s.result)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerOpenError(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(1, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	b.allow()
+	b.record(status.Error(codes.Unavailable, "connection refused"))
+
+	now = now.Add(4 * time.Second)
+	st := status.Convert(b.allow())
+
+	assert.Equal(t, codes.Unavailable, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		info := st.Details()[0].(*errdetails.RetryInfo)
+		assert.Equal(t, 6*time.Second, info.GetRetryDelay().AsDuration())
+	}
+}
@@ -2,27 +2,169 @@ package hackernews
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
 	"github.com/alexdunne/gs-onboarding/internal/models"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
 )
 
+// ErrNotFound is returned when a requested item does not exist
+var ErrNotFound = errors.New("item not found")
+
 // Client is a interface to expose methods to interact the internal hacker news api
 type Client interface {
-	FetchAll(ctx context.Context) ([]models.Item, error)
-	FetchStories(ctx context.Context) ([]models.Item, error)
-	FetchJobs(ctx context.Context) ([]models.Item, error)
+	FetchAll(ctx context.Context, opts ListOptions) ([]models.Item, string, error)
+	FetchStories(ctx context.Context, opts ListOptions) ([]models.Item, string, error)
+	FetchJobs(ctx context.Context, opts ListOptions) ([]models.Item, string, error)
+	Export(ctx context.Context, opts ListOptions, fn func(models.Item) error) error
+	FetchItem(ctx context.Context, id int) (models.Item, error)
+	FetchItems(ctx context.Context, ids []int) ([]models.Item, error)
+	FetchExistingItems(ctx context.Context, ids []int) (map[int]models.Item, error)
+	FetchScoreHistories(ctx context.Context, ids []int, opts ScoreHistoryOptions) (map[int][]models.ScoreSample, error)
+	Search(ctx context.Context, query string, opts SearchOptions) ([]models.SearchResult, string, error)
 }
 
+const (
+	defaultDialTimeout      = 5 * time.Second
+	defaultCallTimeout      = 10 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 10 * time.Second
+)
+
+// serviceConfig balances calls across every resolved API address and retries the read RPCs, which are
+// all idempotent, when a replica is unavailable. Retries only happen before the first response of a
+// stream is received. grpc v1.40 applies retry policies only when GRPC_GO_RETRY=on is set
+const serviceConfig = `{
+	"loadBalancingConfig": [{"round_robin": {}}],
+	"methodConfig": [{
+		"name": [
+			{"service": "api.API", "method": "ListAll"},
+			{"service": "api.API", "method": "ListStories"},
+			{"service": "api.API", "method": "ListJobs"},
+			{"service": "api.API", "method": "GetItem"},
+			{"service": "api.API", "method": "BatchGetItems"},
+			{"service": "api.API", "method": "BatchGetScoreHistory"},
+			{"service": "api.API", "method": "SearchItems"}
+		],
+		"timeout": "%.3fs",
+		"retryPolicy": {
+			"maxAttempts": 3,
+			"initialBackoff": "0.1s",
+			"maxBackoff": "1s",
+			"backoffMultiplier": 2,
+			"retryableStatusCodes": ["UNAVAILABLE"]
+		}
+	}]
+}`
+
+// staticScheme is the resolver scheme used for comma separated address lists
+const staticScheme = "static"
+
 type client struct {
 	client pb.APIClient
 	conn   *grpc.ClientConn
 }
 
-func New(addr string) (*client, error) {
-	conn, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithBlock())
+// ClientOption is an interface for a functional option
+type ClientOption func(o *clientOptions)
+
+type clientOptions struct {
+	transport        credentials.TransportCredentials
+	perRPC           credentials.PerRPCCredentials
+	dialTimeout      time.Duration
+	callTimeout      time.Duration
+	breakerThreshold int
+	breakerCooldown  time.Duration
+}
+
+// WithTransportCredentials is a functional option to connect over TLS, optionally presenting a client
+// certificate as the gateway's identity
+func WithTransportCredentials(creds credentials.TransportCredentials) ClientOption {
+	return func(o *clientOptions) {
+		o.transport = creds
+	}
+}
+
+// WithPerRPCCredentials is a functional option to attach credentials, such as a bearer token, to every call
+func WithPerRPCCredentials(creds credentials.PerRPCCredentials) ClientOption {
+	return func(o *clientOptions) {
+		o.perRPC = creds
+	}
+}
+
+// WithDialTimeout is a functional option to set how long New waits for a connection to the API
+func WithDialTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithCallTimeout is a functional option to set the deadline of calls made without a shorter one
+func WithCallTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.callTimeout = timeout
+	}
+}
+
+// WithCircuitBreaker is a functional option to fail calls fast for cooldown once threshold calls in a
+// row have failed
+func WithCircuitBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.breakerThreshold = threshold
+		o.breakerCooldown = cooldown
+	}
+}
+
+// New connects to the API, failing if no connection is made within the dial timeout. addr is any gRPC
+// target, such as dns:///api:8001 to balance across every address the name resolves to, or a comma
+// separated list of addresses. Connections are plaintext unless transport credentials are given
+func New(addr string, opts ...ClientOption) (*client, error) {
+	o := &clientOptions{
+		dialTimeout:      defaultDialTimeout,
+		callTimeout:      defaultCallTimeout,
+		breakerThreshold: defaultBreakerThreshold,
+		breakerCooldown:  defaultBreakerCooldown,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	b := newBreaker(o.breakerThreshold, o.breakerCooldown)
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(serviceConfig, o.callTimeout.Seconds())),
+		grpc.WithChainUnaryInterceptor(b.unaryInterceptor()),
+		grpc.WithChainStreamInterceptor(b.streamInterceptor()),
+	}
+	if o.transport != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(o.transport))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+
+	if o.perRPC != nil {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(o.perRPC))
+	}
+
+	if strings.Contains(addr, ",") {
+		r := manual.NewBuilderWithScheme(staticScheme)
+		r.InitialState(staticState(addr))
+		dialOpts = append(dialOpts, grpc.WithResolvers(r))
+		addr = staticScheme + ":///" + addr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.dialTimeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr, dialOpts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "connecting to grpc server")
 	}
@@ -35,6 +177,24 @@ func New(addr string) (*client, error) {
 	}, nil
 }
 
+// staticState lists the addresses in a comma separated list
+func staticState(list string) resolver.State {
+	var state resolver.State
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+		}
+	}
+
+	return state
+}
+
 func (c *client) Close() {
 	c.conn.Close()
 }
+
+// APIClient returns the underlying API client, sharing the connection's credentials, retries and
+// circuit breaker
+func (c *client) APIClient() pb.APIClient {
+	return c.client
+}
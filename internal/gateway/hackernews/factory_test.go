@@ -0,0 +1,105 @@
+package hackernews
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// countingServer counts GetItem calls and answers them with err, or an item when err is nil
+type countingServer struct {
+	pb.UnimplementedAPIServer
+	calls int64
+	err   error
+}
+
+func (s *countingServer) GetItem(ctx context.Context, req *pb.GetItemRequest) (*pb.Item, error) {
+	atomic.AddInt64(&s.calls, 1)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return &pb.Item{Id: req.GetId()}, nil
+}
+
+func (s *countingServer) count() int64 {
+	return atomic.LoadInt64(&s.calls)
+}
+
+// serve starts srv on a loopback port and returns its address
+func serve(t *testing.T, srv pb.APIServer) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := grpc.NewServer()
+	pb.RegisterAPIServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	return lis.Addr().String()
+}
+
+func TestNewDialTimeout(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	lis.Close()
+
+	start := time.Now()
+	_, err = New(addr, WithDialTimeout(200*time.Millisecond))
+
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestClientBalancing(t *testing.T) {
+	first, second := &countingServer{}, &countingServer{}
+
+	c, err := New(strings.Join([]string{serve(t, first), serve(t, second)}, ","))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// round robin only picks replicas once they are connected, so calls are spread once both are
+	assert.Eventually(t, func() bool {
+		_, err := c.FetchItem(context.Background(), 1)
+		require.NoError(t, err)
+
+		return first.count() > 0 && second.count() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	srv := &countingServer{err: status.Error(codes.Unavailable, "shutting down")}
+
+	c, err := New(serve(t, srv), WithCircuitBreaker(2, time.Minute))
+	require.NoError(t, err)
+	defer c.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := c.FetchItem(context.Background(), 1)
+		assert.Equal(t, codes.Unavailable, status.Code(errors.Cause(err)))
+	}
+
+	calls := srv.count()
+
+	_, err = c.FetchItem(context.Background(), 1)
+	assert.Equal(t, codes.Unavailable, status.Code(errors.Cause(err)))
+	assert.Contains(t, err.Error(), "circuit breaker is open")
+
+	// the open breaker fails the call without reaching the API
+	assert.Equal(t, calls, srv.count())
+
+	_, _, err = c.FetchAll(context.Background(), ListOptions{})
+	assert.Contains(t, err.Error(), "circuit breaker is open")
+}
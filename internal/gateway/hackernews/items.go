@@ -3,45 +3,370 @@ package hackernews
 import (
 	"context"
 	"io"
+	"math"
+	"strconv"
+	"time"
 
 	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
 	"github.com/alexdunne/gs-onboarding/internal/models"
 	"github.com/pkg/errors"
-	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-// FetchAll fetches and returns all items from the gRPC server
-func (c *client) FetchAll(ctx context.Context) ([]models.Item, error) {
-	clientStream, err := c.client.ListAll(ctx, &emptypb.Empty{})
+// nextPageTokenKey is the trailer key the API sends the next page token under
+const nextPageTokenKey = "next-page-token"
+
+// maxBatchSize is the most ids the API accepts in one batch request
+const maxBatchSize = 100
+
+// exportPageSize is the page size exports are fetched in. Pages larger than 500 items are streamed
+// straight from the database by the API rather than cached, and pages this small finish well within
+// the call timeout even when the export is read slowly
+const exportPageSize = 1000
+
+// Sort is the order list requests return items in
+type Sort int
+
+const (
+	// SortDefault leaves the order to the API, which returns the newest items first
+	SortDefault Sort = iota
+	SortNewest
+	SortOldest
+	SortTop
+)
+
+var sortOrders = map[Sort]pb.SortOrder{
+	SortDefault: pb.SortOrder_SORT_ORDER_UNSPECIFIED,
+	SortNewest:  pb.SortOrder_NEWEST,
+	SortOldest:  pb.SortOrder_OLDEST,
+	SortTop:     pb.SortOrder_TOP,
+}
+
+// ListOptions filter and page list requests. Zero values are left to the API's defaults
+type ListOptions struct {
+	Limit int
+	// Cursor is the next page cursor returned for a previous request with the same options
+	Cursor   string
+	Sort     Sort
+	Author   string
+	MinScore int
+	// Since and Until bound the creation time of items, Since inclusive and Until exclusive
+	Since time.Time
+	Until time.Time
+	// Type only returns items of this type, the story and job lists set it implicitly
+	Type string
+}
+
+func (o ListOptions) request() *pb.ListItemsRequest {
+	req := &pb.ListItemsRequest{
+		PageSize:  int32(o.Limit),
+		PageToken: o.Cursor,
+		Type:      o.Type,
+		Sort:      sortOrders[o.Sort],
+		Author:    o.Author,
+		MinScore:  int32(o.MinScore),
+	}
+
+	if !o.Since.IsZero() {
+		req.CreatedAfter = o.Since.Unix()
+	}
+
+	if !o.Until.IsZero() {
+		req.CreatedBefore = o.Until.Unix()
+	}
+
+	return req
+}
+
+// FetchAll fetches a page of items from the gRPC server along with the cursor for the next page
+func (c *client) FetchAll(ctx context.Context, opts ListOptions) ([]models.Item, string, error) {
+	items, next, err := listPage(ctx, func() (itemStream, error) {
+		return c.client.ListAll(ctx, opts.request())
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "streaming all items")
+		return nil, "", errors.Wrap(err, "streaming all items")
 	}
 
-	return collectStreamItems(ctx, clientStream)
+	return items, next, nil
 }
 
-// FetchAll fetches and returns all story items from the gRPC server
-func (c *client) FetchStories(ctx context.Context) ([]models.Item, error) {
-	clientStream, err := c.client.ListStories(ctx, &emptypb.Empty{})
+// FetchStories fetches a page of story items from the gRPC server along with the cursor for the next page
+func (c *client) FetchStories(ctx context.Context, opts ListOptions) ([]models.Item, string, error) {
+	items, next, err := listPage(ctx, func() (itemStream, error) {
+		return c.client.ListStories(ctx, opts.request())
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "streaming story items")
+		return nil, "", errors.Wrap(err, "streaming story items")
 	}
 
-	return collectStreamItems(ctx, clientStream)
+	return items, next, nil
 }
 
-// FetchAll fetches and returns all jobs items from the gRPC server
-func (c *client) FetchJobs(ctx context.Context) ([]models.Item, error) {
-	clientStream, err := c.client.ListJobs(ctx, &emptypb.Empty{})
+// FetchJobs fetches a page of job items from the gRPC server along with the cursor for the next page
+func (c *client) FetchJobs(ctx context.Context, opts ListOptions) ([]models.Item, string, error) {
+	items, next, err := listPage(ctx, func() (itemStream, error) {
+		return c.client.ListJobs(ctx, opts.request())
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "streaming job items")
+		return nil, "", errors.Wrap(err, "streaming job items")
 	}
 
-	return collectStreamItems(ctx, clientStream)
+	return items, next, nil
+}
+
+// Export calls fn with every item matching opts, fetching page after page from opts.Cursor. Limit caps
+// the number of items exported rather than the page size, zero exports everything. Only one page is
+// held at a time and an error from fn stops the export
+func (c *client) Export(ctx context.Context, opts ListOptions, fn func(models.Item) error) error {
+	remaining := opts.Limit
+	for {
+		req := opts.request()
+		req.PageSize = exportPageSize
+		if opts.Limit > 0 && remaining < exportPageSize {
+			req.PageSize = int32(remaining)
+		}
+
+		s, err := c.client.ListAll(ctx, req)
+		if err != nil {
+			return errors.Wrap(err, "exporting items")
+		}
+
+		for {
+			item, err := s.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return errors.Wrap(err, "receiving exported items from server")
+			}
+
+			if err := fn(models.Ptoi(item)); err != nil {
+				return err
+			}
+			remaining--
+		}
+
+		next := nextPageToken(s)
+		if next == "" || (opts.Limit > 0 && remaining <= 0) {
+			return nil
+		}
+
+		opts.Cursor = next
+	}
+}
+
+// FetchItem fetches a single item from the gRPC server, returning ErrNotFound if it does not exist
+func (c *client) FetchItem(ctx context.Context, id int) (models.Item, error) {
+	// ids are stored as 32-bit integers so larger ones can't exist
+	if id <= 0 || id > math.MaxInt32 {
+		return models.Item{}, ErrNotFound
+	}
+
+	item, err := c.client.GetItem(ctx, &pb.GetItemRequest{Id: int32(id)})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return models.Item{}, ErrNotFound
+		}
+
+		return models.Item{}, errors.Wrap(err, "fetching item")
+	}
+
+	return models.Ptoi(item), nil
+}
+
+// FetchItems fetches a collection of items from the gRPC server, returning ErrNotFound if any do not exist
+func (c *client) FetchItems(ctx context.Context, ids []int) ([]models.Item, error) {
+	req := &pb.BatchGetItemsRequest{Ids: make([]int32, len(ids))}
+	for i, id := range ids {
+		if id <= 0 || id > math.MaxInt32 {
+			return nil, ErrNotFound
+		}
+		req.Ids[i] = int32(id)
+	}
+
+	res, err := c.client.BatchGetItems(ctx, req)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrNotFound
+		}
+
+		return nil, errors.Wrap(err, "fetching items")
+	}
+
+	items := make([]models.Item, len(res.GetItems()))
+	for i, item := range res.GetItems() {
+		items[i] = models.Ptoi(item)
+	}
+
+	return items, nil
+}
+
+// FetchExistingItems fetches the items out of ids that exist, keyed by id. Unlike FetchItems, missing
+// items aren't an error as replies may not have been stored yet. Ids are requested in batches of the
+// most the API accepts
+func (c *client) FetchExistingItems(ctx context.Context, ids []int) (map[int]models.Item, error) {
+	items := make(map[int]models.Item, len(ids))
+	for _, batch := range batchIDs(ids) {
+		res, err := c.client.BatchGetItems(ctx, &pb.BatchGetItemsRequest{Ids: batch})
+		if status.Code(err) == codes.NotFound {
+			// the API names the missing items, so the rest are requested again without them
+			if batch = withoutMissing(batch, err); len(batch) == 0 {
+				continue
+			}
+
+			res, err = c.client.BatchGetItems(ctx, &pb.BatchGetItemsRequest{Ids: batch})
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "fetching items")
+		}
+
+		for _, item := range res.GetItems() {
+			items[int(item.GetId())] = models.Ptoi(item)
+		}
+	}
+
+	return items, nil
+}
+
+type ScoreHistoryOptions struct {
+	// First is the most scores to fetch for each item, the API applies its default when unset
+	First int
+	// Since only fetches scores recorded at or after this time
+	Since time.Time
+}
+
+// FetchScoreHistories fetches the recorded scores of each item, oldest first. Items without any
+// recorded scores are left out
+func (c *client) FetchScoreHistories(ctx context.Context, ids []int, opts ScoreHistoryOptions) (map[int][]models.ScoreSample, error) {
+	histories := make(map[int][]models.ScoreSample, len(ids))
+	for _, batch := range batchIDs(ids) {
+		req := &pb.BatchGetScoreHistoryRequest{Ids: batch, MaxSamples: int32(opts.First)}
+		if !opts.Since.IsZero() {
+			req.RecordedAfter = opts.Since.Unix()
+		}
+
+		res, err := c.client.BatchGetScoreHistory(ctx, req)
+		if err != nil {
+			return nil, errors.Wrap(err, "fetching score histories")
+		}
+
+		for _, h := range res.GetHistories() {
+			for _, sample := range h.GetSamples() {
+				histories[int(h.GetItemId())] = append(histories[int(h.GetItemId())], models.ScoreSample{
+					Score:      int(sample.GetScore()),
+					RecordedAt: time.Unix(sample.GetRecordedAt(), 0),
+				})
+			}
+		}
+	}
+
+	return histories, nil
+}
+
+// batchIDs splits ids into batches of at most maxBatchSize
+func batchIDs(ids []int) [][]int32 {
+	var batches [][]int32
+	for start := 0; start < len(ids); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		batch := make([]int32, end-start)
+		for i, id := range ids[start:end] {
+			batch[i] = int32(id)
+		}
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// withoutMissing removes the items a NOT_FOUND status reports missing from ids
+func withoutMissing(ids []int32, err error) []int32 {
+	missing := map[int32]bool{}
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ResourceInfo); ok {
+			id, err := strconv.Atoi(info.GetResourceName())
+			if err == nil {
+				missing[int32(id)] = true
+			}
+		}
+	}
+
+	var found []int32
+	for _, id := range ids {
+		if !missing[id] {
+			found = append(found, id)
+		}
+	}
+
+	return found
+}
+
+// SearchOptions narrow and page a search
+type SearchOptions struct {
+	Limit int
+	// Cursor is the next page cursor returned for a previous search with the same query and options
+	Cursor string
+	// Type only returns items of this type
+	Type string
+}
+
+// Search performs a full-text search and returns a page of results along with the cursor for the next page
+func (c *client) Search(ctx context.Context, query string, opts SearchOptions) ([]models.SearchResult, string, error) {
+	res, err := c.client.SearchItems(ctx, &pb.SearchItemsRequest{
+		Query:     query,
+		PageSize:  int32(opts.Limit),
+		PageToken: opts.Cursor,
+		Type:      opts.Type,
+	})
+	if err != nil {
+		return nil, "", errors.Wrap(err, "searching items")
+	}
+
+	results := make([]models.SearchResult, len(res.GetResults()))
+	for i, r := range res.GetResults() {
+		results[i] = models.SearchResult{
+			Item:    models.Ptoi(r.GetItem()),
+			Snippet: r.GetSnippet(),
+			Rank:    r.GetRank(),
+		}
+	}
+
+	return results, res.GetNextPageToken(), nil
 }
 
 type itemStream interface {
 	Recv() (*pb.Item, error)
+	Trailer() metadata.MD
+}
+
+// listPage streams a single page of items and returns it with the token of the following page, if any
+func listPage(ctx context.Context, list func() (itemStream, error)) ([]models.Item, string, error) {
+	s, err := list()
+	if err != nil {
+		return nil, "", err
+	}
+
+	items, err := collectStreamItems(ctx, s)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return items, nextPageToken(s), nil
+}
+
+// nextPageToken reads the token for the following page from a finished stream
+func nextPageToken(s itemStream) string {
+	if values := s.Trailer().Get(nextPageTokenKey); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
 }
 
 func collectStreamItems(ctx context.Context, s itemStream) ([]models.Item, error) {
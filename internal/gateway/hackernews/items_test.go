@@ -0,0 +1,404 @@
+package hackernews
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// pagingServer records list requests and answers with items and a next page token
+type pagingServer struct {
+	pb.UnimplementedAPIServer
+	requests chan *pb.ListItemsRequest
+	items    []*pb.Item
+	next     string
+}
+
+func (s *pagingServer) ListStories(req *pb.ListItemsRequest, stream pb.API_ListStoriesServer) error {
+	s.requests <- req
+
+	for _, item := range s.items {
+		if err := stream.Send(item); err != nil {
+			return err
+		}
+	}
+
+	if s.next != "" {
+		stream.SetTrailer(metadata.Pairs(nextPageTokenKey, s.next))
+	}
+
+	return nil
+}
+
+func TestFetchStories(t *testing.T) {
+	since := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	type testcase struct {
+		name            string
+		opts            ListOptions
+		next            string
+		expectedRequest *pb.ListItemsRequest
+	}
+
+	tests := []testcase{
+		{
+			name:            "defaults",
+			opts:            ListOptions{},
+			expectedRequest: &pb.ListItemsRequest{},
+		},
+		{
+			name: "every option",
+			opts: ListOptions{
+				Limit:    20,
+				Cursor:   "abc",
+				Sort:     SortTop,
+				Author:   "pg",
+				MinScore: 100,
+				Since:    since,
+				Until:    until,
+			},
+			next: "def",
+			expectedRequest: &pb.ListItemsRequest{
+				PageSize:      20,
+				PageToken:     "abc",
+				Sort:          pb.SortOrder_TOP,
+				Author:        "pg",
+				MinScore:      100,
+				CreatedAfter:  since.Unix(),
+				CreatedBefore: until.Unix(),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := &pagingServer{
+				requests: make(chan *pb.ListItemsRequest, 1),
+				items:    []*pb.Item{{Id: 1, Type: "story"}, {Id: 2, Type: "story"}},
+				next:     tc.next,
+			}
+
+			c, err := New(serve(t, srv))
+			require.NoError(t, err)
+			defer c.Close()
+
+			items, next, err := c.FetchStories(context.Background(), tc.opts)
+			require.NoError(t, err)
+
+			assert.Len(t, items, 2)
+			assert.Equal(t, tc.next, next)
+			assert.True(t, proto.Equal(tc.expectedRequest, <-srv.requests))
+		})
+	}
+}
+
+// exportServer lists total items in pages, using the offset of the next page as its token
+type exportServer struct {
+	pb.UnimplementedAPIServer
+	total    int
+	requests []*pb.ListItemsRequest
+}
+
+func (s *exportServer) ListAll(req *pb.ListItemsRequest, stream pb.API_ListAllServer) error {
+	s.requests = append(s.requests, req)
+
+	offset := 0
+	if req.GetPageToken() != "" {
+		offset, _ = strconv.Atoi(req.GetPageToken())
+	}
+
+	end := offset + int(req.GetPageSize())
+	if end > s.total {
+		end = s.total
+	}
+
+	for id := offset; id < end; id++ {
+		if err := stream.Send(&pb.Item{Id: int32(id), Type: req.GetType()}); err != nil {
+			return err
+		}
+	}
+
+	if end < s.total {
+		stream.SetTrailer(metadata.Pairs(nextPageTokenKey, strconv.Itoa(end)))
+	}
+
+	return nil
+}
+
+func TestExport(t *testing.T) {
+	type testcase struct {
+		name              string
+		total             int
+		opts              ListOptions
+		stopAfter         int
+		expectedCount     int
+		expectedPageSizes []int32
+		expectedErr       bool
+	}
+
+	tests := []testcase{
+		{
+			name:              "every page",
+			total:             2500,
+			opts:              ListOptions{Type: "story", Author: "pg"},
+			expectedCount:     2500,
+			expectedPageSizes: []int32{1000, 1000, 1000},
+		},
+		{
+			name:              "limit spanning pages",
+			total:             2500,
+			opts:              ListOptions{Limit: 1500},
+			expectedCount:     1500,
+			expectedPageSizes: []int32{1000, 500},
+		},
+		{
+			name:              "from a cursor",
+			total:             1500,
+			opts:              ListOptions{Cursor: "1000"},
+			expectedCount:     500,
+			expectedPageSizes: []int32{1000},
+		},
+		{
+			name:              "no items",
+			expectedPageSizes: []int32{1000},
+		},
+		{
+			name:              "stopped by the callback",
+			total:             2500,
+			stopAfter:         10,
+			expectedCount:     10,
+			expectedPageSizes: []int32{1000},
+			expectedErr:       true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := &exportServer{total: tc.total}
+
+			c, err := New(serve(t, srv))
+			require.NoError(t, err)
+			defer c.Close()
+
+			count := 0
+			err = c.Export(context.Background(), tc.opts, func(item models.Item) error {
+				if tc.stopAfter > 0 && count == tc.stopAfter {
+					return errors.New("client went away")
+				}
+
+				assert.Equal(t, tc.opts.Type, item.Type)
+				count++
+				return nil
+			})
+
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedCount, count)
+
+			var pageSizes []int32
+			for _, req := range srv.requests {
+				pageSizes = append(pageSizes, req.GetPageSize())
+				assert.Equal(t, tc.opts.Author, req.GetAuthor(), "filters must be sent with every page")
+			}
+			assert.Equal(t, tc.expectedPageSizes, pageSizes)
+		})
+	}
+}
+
+// batchServer stores items by id and answers batch requests the way the API does, failing with the
+// missing ids when any item doesn't exist
+type batchServer struct {
+	pb.UnimplementedAPIServer
+	items    map[int32]*pb.Item
+	scores   map[int32][]*pb.ScoreSample
+	requests [][]int32
+	// scoreRequests records the score history requests
+	scoreRequests []*pb.BatchGetScoreHistoryRequest
+}
+
+func (s *batchServer) BatchGetItems(ctx context.Context, req *pb.BatchGetItemsRequest) (*pb.BatchGetItemsResponse, error) {
+	s.requests = append(s.requests, req.GetIds())
+
+	res := &pb.BatchGetItemsResponse{}
+	st := status.New(codes.NotFound, "items not found")
+	for _, id := range req.GetIds() {
+		item, ok := s.items[id]
+		if !ok {
+			var err error
+			if st, err = st.WithDetails(&errdetails.ResourceInfo{ResourceType: "item", ResourceName: strconv.Itoa(int(id))}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		res.Items = append(res.Items, item)
+	}
+
+	if len(st.Details()) > 0 {
+		return nil, st.Err()
+	}
+
+	return res, nil
+}
+
+func (s *batchServer) BatchGetScoreHistory(ctx context.Context, req *pb.BatchGetScoreHistoryRequest) (*pb.BatchGetScoreHistoryResponse, error) {
+	s.requests = append(s.requests, req.GetIds())
+	s.scoreRequests = append(s.scoreRequests, req)
+
+	res := &pb.BatchGetScoreHistoryResponse{}
+	for _, id := range req.GetIds() {
+		res.Histories = append(res.Histories, &pb.ScoreHistory{ItemId: id, Samples: s.scores[id]})
+	}
+
+	return res, nil
+}
+
+func TestFetchExistingItems(t *testing.T) {
+	stored := map[int32]*pb.Item{}
+	for id := int32(1); id <= 150; id++ {
+		// every tenth item hasn't been stored
+		if id%10 != 0 {
+			stored[id] = &pb.Item{Id: id, Type: "comment"}
+		}
+	}
+
+	type testcase struct {
+		name             string
+		ids              []int
+		expectedIDs      []int
+		expectedRequests [][]int32
+	}
+
+	tests := []testcase{
+		{
+			name:             "every item exists",
+			ids:              []int{3, 1},
+			expectedIDs:      []int{1, 3},
+			expectedRequests: [][]int32{{3, 1}},
+		},
+		{
+			name:             "missing items are left out",
+			ids:              []int{1, 10, 2, 20},
+			expectedIDs:      []int{1, 2},
+			expectedRequests: [][]int32{{1, 10, 2, 20}, {1, 2}},
+		},
+		{
+			name:             "no items exist",
+			ids:              []int{10, 20},
+			expectedRequests: [][]int32{{10, 20}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := &batchServer{items: stored}
+
+			c, err := New(serve(t, srv))
+			require.NoError(t, err)
+			defer c.Close()
+
+			items, err := c.FetchExistingItems(context.Background(), tc.ids)
+			require.NoError(t, err)
+
+			var ids []int
+			for id, item := range items {
+				assert.Equal(t, id, item.ID)
+				ids = append(ids, id)
+			}
+			assert.ElementsMatch(t, tc.expectedIDs, ids)
+			assert.Equal(t, tc.expectedRequests, srv.requests)
+		})
+	}
+
+	t.Run("batches large requests", func(t *testing.T) {
+		srv := &batchServer{items: stored}
+
+		c, err := New(serve(t, srv))
+		require.NoError(t, err)
+		defer c.Close()
+
+		ids := make([]int, 150)
+		for i := range ids {
+			ids[i] = i + 1
+		}
+
+		items, err := c.FetchExistingItems(context.Background(), ids)
+		require.NoError(t, err)
+		assert.Len(t, items, 135)
+
+		// each batch is retried without its missing items
+		require.Len(t, srv.requests, 4)
+		assert.Len(t, srv.requests[0], 100)
+		assert.Len(t, srv.requests[1], 90)
+		assert.Len(t, srv.requests[2], 50)
+		assert.Len(t, srv.requests[3], 45)
+	})
+}
+
+func TestFetchScoreHistories(t *testing.T) {
+	srv := &batchServer{scores: map[int32][]*pb.ScoreSample{
+		1: {{Score: 1, RecordedAt: 1633046400}, {Score: 12, RecordedAt: 1633050000}},
+	}}
+
+	c, err := New(serve(t, srv))
+	require.NoError(t, err)
+	defer c.Close()
+
+	histories, err := c.FetchScoreHistories(context.Background(), []int{1, 2}, ScoreHistoryOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[int][]models.ScoreSample{
+		1: {
+			{Score: 1, RecordedAt: time.Unix(1633046400, 0)},
+			{Score: 12, RecordedAt: time.Unix(1633050000, 0)},
+		},
+	}, histories)
+	assert.Equal(t, [][]int32{{1, 2}}, srv.requests)
+
+	t.Run("sends the options", func(t *testing.T) {
+		srv := &batchServer{}
+
+		c, err := New(serve(t, srv))
+		require.NoError(t, err)
+		defer c.Close()
+
+		_, err = c.FetchScoreHistories(context.Background(), []int{1}, ScoreHistoryOptions{First: 5, Since: time.Unix(1633046400, 0)})
+		require.NoError(t, err)
+
+		require.Len(t, srv.scoreRequests, 1)
+		assert.Equal(t, int32(5), srv.scoreRequests[0].GetMaxSamples())
+		assert.Equal(t, int64(1633046400), srv.scoreRequests[0].GetRecordedAfter())
+	})
+}
+
+func TestFetchItemsBeyond32Bits(t *testing.T) {
+	srv := &batchServer{items: map[int32]*pb.Item{1: {Id: 1}}}
+
+	c, err := New(serve(t, srv))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// 2^32+1 would wrap to 1 if it were sent
+	_, err = c.FetchItem(context.Background(), 1<<32+1)
+	assert.Equal(t, ErrNotFound, err)
+
+	_, err = c.FetchItems(context.Background(), []int{1, 1<<32 + 1})
+	assert.Equal(t, ErrNotFound, err)
+	assert.Empty(t, srv.requests)
+}
@@ -11,35 +11,104 @@ type Mock struct {
 	mock.Mock
 }
 
-func (m *Mock) FetchAll(ctx context.Context) ([]models.Item, error) {
-	args := m.Called(ctx)
+func (m *Mock) FetchAll(ctx context.Context, opts ListOptions) ([]models.Item, string, error) {
+	args := m.Called(ctx, opts)
 
 	itemsArg, ok := args.Get(0).([]models.Item)
 	if !ok {
-		return nil, nil
+		return nil, "", args.Error(2)
 	}
 
-	return itemsArg, args.Error(1)
+	return itemsArg, args.String(1), args.Error(2)
 }
 
-func (m *Mock) FetchStories(ctx context.Context) ([]models.Item, error) {
-	args := m.Called(ctx)
+func (m *Mock) FetchStories(ctx context.Context, opts ListOptions) ([]models.Item, string, error) {
+	args := m.Called(ctx, opts)
 
 	itemsArg, ok := args.Get(0).([]models.Item)
 	if !ok {
-		return nil, nil
+		return nil, "", args.Error(2)
 	}
 
-	return itemsArg, args.Error(1)
+	return itemsArg, args.String(1), args.Error(2)
+}
+
+func (m *Mock) FetchJobs(ctx context.Context, opts ListOptions) ([]models.Item, string, error) {
+	args := m.Called(ctx, opts)
+
+	itemsArg, ok := args.Get(0).([]models.Item)
+	if !ok {
+		return nil, "", args.Error(2)
+	}
+
+	return itemsArg, args.String(1), args.Error(2)
+}
+
+// Export calls fn with the items returned by the expectation, then returns its error
+func (m *Mock) Export(ctx context.Context, opts ListOptions, fn func(models.Item) error) error {
+	args := m.Called(ctx, opts)
+
+	items, _ := args.Get(0).([]models.Item)
+	for _, item := range items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+
+	return args.Error(1)
+}
+
+func (m *Mock) FetchItem(ctx context.Context, id int) (models.Item, error) {
+	args := m.Called(ctx, id)
+
+	itemArg, ok := args.Get(0).(models.Item)
+	if !ok {
+		return models.Item{}, args.Error(1)
+	}
+
+	return itemArg, args.Error(1)
 }
 
-func (m *Mock) FetchJobs(ctx context.Context) ([]models.Item, error) {
-	args := m.Called(ctx)
+func (m *Mock) FetchItems(ctx context.Context, ids []int) ([]models.Item, error) {
+	args := m.Called(ctx, ids)
 
 	itemsArg, ok := args.Get(0).([]models.Item)
 	if !ok {
-		return nil, nil
+		return nil, args.Error(1)
 	}
 
 	return itemsArg, args.Error(1)
 }
+
+func (m *Mock) FetchExistingItems(ctx context.Context, ids []int) (map[int]models.Item, error) {
+	args := m.Called(ctx, ids)
+
+	itemsArg, ok := args.Get(0).(map[int]models.Item)
+	if !ok {
+		return nil, args.Error(1)
+	}
+
+	return itemsArg, args.Error(1)
+}
+
+func (m *Mock) FetchScoreHistories(ctx context.Context, ids []int, opts ScoreHistoryOptions) (map[int][]models.ScoreSample, error) {
+	args := m.Called(ctx, ids, opts)
+
+	historiesArg, ok := args.Get(0).(map[int][]models.ScoreSample)
+	if !ok {
+		return nil, args.Error(1)
+	}
+
+	return historiesArg, args.Error(1)
+}
+
+func (m *Mock) Search(ctx context.Context, query string, opts SearchOptions) ([]models.SearchResult, string, error) {
+	args := m.Called(ctx, query, opts)
+
+	resultsArg, ok := args.Get(0).([]models.SearchResult)
+	if !ok {
+		return nil, "", args.Error(2)
+	}
+
+	return resultsArg, args.String(1), args.Error(2)
+}
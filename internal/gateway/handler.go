@@ -1,48 +1,174 @@
 package gateway
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/alexdunne/gs-onboarding/internal/models"
 	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
 )
 
+// maxGetItems is the most ids GET /items accepts, the most the API returns in one batch
+const maxGetItems = 100
+
 type Handler struct {
 	HNClient hackernews.Client
+	// CacheControl is sent with successful responses, DefaultCacheControl when empty
+	CacheControl string
 }
 
 // GetAllItems handles requests to GET /all
 func (h *Handler) GetAllItems(c echo.Context) error {
-	items, err := h.HNClient.FetchAll(c.Request().Context())
+	return h.list(c, h.HNClient.FetchAll)
+}
+
+// GetStories handles requests to GET /stories
+func (h *Handler) GetStories(c echo.Context) error {
+	return h.list(c, h.HNClient.FetchStories)
+}
+
+// GetJobs handles requests to GET /jobs
+func (h *Handler) GetJobs(c echo.Context) error {
+	return h.list(c, h.HNClient.FetchJobs)
+}
+
+type fetchPage func(ctx context.Context, opts hackernews.ListOptions) ([]models.Item, string, error)
+
+// list responds with a page of items filtered and ordered by the query parameters
+func (h *Handler) list(c echo.Context, fetch fetchPage) error {
+	opts, err := parseListParams(c)
 	if err != nil {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"items": items,
+	items, next, err := fetch(c.Request().Context(), opts)
+	if err != nil {
+		return err
+	}
+
+	setPageLinks(c, next)
+
+	return h.respond(c, pageValidators(items, next), map[string]interface{}{
+		"items":       items,
+		"next_cursor": next,
 	})
 }
 
-// GetAllItems handles requests to GET /stories
-func (h *Handler) GetStories(c echo.Context) error {
-	items, err := h.HNClient.FetchStories(c.Request().Context())
+// GetItem handles requests to GET /items/:id
+func (h *Handler) GetItem(c echo.Context) error {
+	id, ok := parseItemID(c.Param("id"))
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "id must be a positive 32-bit integer")
+	}
+
+	item, err := h.HNClient.FetchItem(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, hackernews.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("item %d not found", id))
+		}
+
+		return err
+	}
+
+	return h.respond(c, itemValidators([]models.Item{item}), item)
+}
+
+// GetItems handles requests to GET /items?ids=1,2,3
+func (h *Handler) GetItems(c echo.Context) error {
+	param := c.QueryParam("ids")
+	if param == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "ids is required")
+	}
+
+	values := strings.Split(param, ",")
+	if len(values) > maxGetItems {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("at most %d ids can be requested at once", maxGetItems))
+	}
+
+	ids := make([]int, len(values))
+	for i, v := range values {
+		id, ok := parseItemID(strings.TrimSpace(v))
+		if !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "ids must be a comma separated list of positive 32-bit integers")
+		}
+
+		ids[i] = id
+	}
+
+	items, err := h.HNClient.FetchItems(c.Request().Context(), ids)
 	if err != nil {
+		if errors.Is(err, hackernews.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "one or more items not found")
+		}
+
 		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
+	return h.respond(c, itemValidators(items), map[string]interface{}{
 		"items": items,
 	})
 }
 
-// GetAllItems handles requests to GET /jobs
-func (h *Handler) GetJobs(c echo.Context) error {
-	items, err := h.HNClient.FetchJobs(c.Request().Context())
+// parseItemID parses an item id, which the API stores as a 32-bit integer
+func parseItemID(v string) (int, bool) {
+	id, err := strconv.ParseInt(v, 10, 32)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+
+	return int(id), true
+}
+
+// searchTypes are the item types search results can be narrowed to
+var searchTypes = map[string]bool{"story": true, "job": true, "comment": true, "poll": true, "pollopt": true}
+
+// Search handles requests to GET /search?q=
+func (h *Handler) Search(c echo.Context) error {
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "q is required")
+	}
+
+	opts := hackernews.SearchOptions{Cursor: c.QueryParam("cursor")}
+	if v := c.QueryParam("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be a positive integer")
+		}
+
+		opts.Limit = l
+	}
+
+	if v := c.QueryParam("type"); v != "" {
+		if !searchTypes[v] {
+			return echo.NewHTTPError(http.StatusBadRequest, "type must be one of story, job, comment, poll or pollopt")
+		}
+
+		opts.Type = v
+	}
+
+	results, next, err := h.HNClient.Search(c.Request().Context(), query, opts)
 	if err != nil {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"items": items,
+	setPageLinks(c, next)
+
+	// ranks decay with age so they are part of the version of the results
+	items := make([]models.Item, len(results))
+	extra := []interface{}{next}
+	for i, r := range results {
+		items[i] = r.Item
+		extra = append(extra, r.Rank)
+	}
+
+	return h.respond(c, pageValidators(items, extra...), map[string]interface{}{
+		"results":     results,
+		"next_cursor": next,
 	})
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
@@ -32,7 +33,7 @@ func TestGetAllItems(t *testing.T) {
 			name: "no items",
 			hn:   &hackernews.Mock{},
 			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
-				hn.On("FetchAll", mock.Anything).Return([]models.Item{}, nil)
+				hn.On("FetchAll", mock.Anything, hackernews.ListOptions{}).Return([]models.Item{}, "", nil)
 
 			},
 			expectedStatusCode: 200,
@@ -42,7 +43,7 @@ func TestGetAllItems(t *testing.T) {
 			name: "one item",
 			hn:   &hackernews.Mock{},
 			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
-				hn.On("FetchAll", mock.Anything).Return([]models.Item{{ID: 1}}, nil)
+				hn.On("FetchAll", mock.Anything, hackernews.ListOptions{}).Return([]models.Item{{ID: 1}}, "", nil)
 
 			},
 			expectedStatusCode: 200,
@@ -52,7 +53,7 @@ func TestGetAllItems(t *testing.T) {
 			name: "two items",
 			hn:   &hackernews.Mock{},
 			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
-				hn.On("FetchAll", mock.Anything).Return([]models.Item{{ID: 1}, {ID: 2}}, nil)
+				hn.On("FetchAll", mock.Anything, hackernews.ListOptions{}).Return([]models.Item{{ID: 1}, {ID: 2}}, "", nil)
 
 			},
 			expectedStatusCode: 200,
@@ -99,7 +100,7 @@ func TestGetStories(t *testing.T) {
 			name: "no items",
 			hn:   &hackernews.Mock{},
 			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
-				hn.On("FetchStories", mock.Anything).Return([]models.Item{}, nil)
+				hn.On("FetchStories", mock.Anything, hackernews.ListOptions{}).Return([]models.Item{}, "", nil)
 
 			},
 			expectedStatusCode: 200,
@@ -109,7 +110,7 @@ func TestGetStories(t *testing.T) {
 			name: "one item",
 			hn:   &hackernews.Mock{},
 			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
-				hn.On("FetchStories", mock.Anything).Return([]models.Item{{ID: 1}}, nil)
+				hn.On("FetchStories", mock.Anything, hackernews.ListOptions{}).Return([]models.Item{{ID: 1}}, "", nil)
 
 			},
 			expectedStatusCode: 200,
@@ -119,7 +120,7 @@ func TestGetStories(t *testing.T) {
 			name: "two items",
 			hn:   &hackernews.Mock{},
 			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
-				hn.On("FetchStories", mock.Anything).Return([]models.Item{{ID: 1}, {ID: 2}}, nil)
+				hn.On("FetchStories", mock.Anything, hackernews.ListOptions{}).Return([]models.Item{{ID: 1}, {ID: 2}}, "", nil)
 
 			},
 			expectedStatusCode: 200,
@@ -166,7 +167,7 @@ func TestGetJobs(t *testing.T) {
 			name: "no items",
 			hn:   &hackernews.Mock{},
 			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
-				hn.On("FetchJobs", mock.Anything).Return([]models.Item{}, nil)
+				hn.On("FetchJobs", mock.Anything, hackernews.ListOptions{}).Return([]models.Item{}, "", nil)
 
 			},
 			expectedStatusCode: 200,
@@ -176,7 +177,7 @@ func TestGetJobs(t *testing.T) {
 			name: "one item",
 			hn:   &hackernews.Mock{},
 			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
-				hn.On("FetchJobs", mock.Anything).Return([]models.Item{{ID: 1}}, nil)
+				hn.On("FetchJobs", mock.Anything, hackernews.ListOptions{}).Return([]models.Item{{ID: 1}}, "", nil)
 
 			},
 			expectedStatusCode: 200,
@@ -186,7 +187,7 @@ func TestGetJobs(t *testing.T) {
 			name: "two items",
 			hn:   &hackernews.Mock{},
 			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
-				hn.On("FetchJobs", mock.Anything).Return([]models.Item{{ID: 1}, {ID: 2}}, nil)
+				hn.On("FetchJobs", mock.Anything, hackernews.ListOptions{}).Return([]models.Item{{ID: 1}, {ID: 2}}, "", nil)
 
 			},
 			expectedStatusCode: 200,
@@ -219,6 +220,255 @@ func TestGetJobs(t *testing.T) {
 	}
 }
 
+func TestGetItem(t *testing.T) {
+	type testcase struct {
+		name               string
+		hn                 *hackernews.Mock
+		id                 string
+		expectMocks        func(t *testing.T, hn *hackernews.Mock)
+		expectedStatusCode int
+	}
+
+	tests := []testcase{
+		{
+			name: "existing item",
+			hn:   &hackernews.Mock{},
+			id:   "1",
+			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
+				hn.On("FetchItem", mock.Anything, 1).Return(models.Item{ID: 1}, nil)
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			name: "missing item",
+			hn:   &hackernews.Mock{},
+			id:   "2",
+			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
+				hn.On("FetchItem", mock.Anything, 2).Return(nil, hackernews.ErrNotFound)
+			},
+			expectedStatusCode: 404,
+		},
+		{
+			name:               "invalid id",
+			hn:                 &hackernews.Mock{},
+			id:                 "abc",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "id larger than 32 bits",
+			hn:                 &hackernews.Mock{},
+			id:                 "4294967297",
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expectMocks != nil {
+				tt.expectMocks(t, tt.hn)
+			}
+
+			context, res := setUpRequest(http.MethodGet, "/items/"+tt.id)
+			context.SetParamNames("id")
+			context.SetParamValues(tt.id)
+
+			h := Handler{
+				HNClient: tt.hn,
+			}
+
+			err := h.GetItem(context)
+
+			assert.Equal(t, tt.expectedStatusCode, statusCode(err, res))
+			tt.hn.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetItems(t *testing.T) {
+	type testcase struct {
+		name               string
+		hn                 *hackernews.Mock
+		query              string
+		expectMocks        func(t *testing.T, hn *hackernews.Mock)
+		expectedStatusCode int
+		expectedItems      int
+	}
+
+	tests := []testcase{
+		{
+			name:  "two items",
+			hn:    &hackernews.Mock{},
+			query: "ids=1,2",
+			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
+				hn.On("FetchItems", mock.Anything, []int{1, 2}).Return([]models.Item{{ID: 1}, {ID: 2}}, nil)
+			},
+			expectedStatusCode: 200,
+			expectedItems:      2,
+		},
+		{
+			name:  "missing item",
+			hn:    &hackernews.Mock{},
+			query: "ids=1,2",
+			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
+				hn.On("FetchItems", mock.Anything, []int{1, 2}).Return(nil, hackernews.ErrNotFound)
+			},
+			expectedStatusCode: 404,
+		},
+		{
+			name:               "no ids",
+			hn:                 &hackernews.Mock{},
+			query:              "",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "invalid ids",
+			hn:                 &hackernews.Mock{},
+			query:              "ids=1,abc",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "id larger than 32 bits",
+			hn:                 &hackernews.Mock{},
+			query:              "ids=1,2147483648",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "too many ids",
+			hn:                 &hackernews.Mock{},
+			query:              "ids=" + strings.TrimSuffix(strings.Repeat("1,", maxGetItems+1), ","),
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expectMocks != nil {
+				tt.expectMocks(t, tt.hn)
+			}
+
+			context, res := setUpRequest(http.MethodGet, "/items?"+tt.query)
+
+			h := Handler{
+				HNClient: tt.hn,
+			}
+
+			err := h.GetItems(context)
+
+			assert.Equal(t, tt.expectedStatusCode, statusCode(err, res))
+			if tt.expectedStatusCode == http.StatusOK {
+				var resBody itemsResponse
+				err = json.Unmarshal(res.Body.Bytes(), &resBody)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedItems, len(resBody.Items))
+			}
+			tt.hn.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	type testcase struct {
+		name               string
+		hn                 *hackernews.Mock
+		query              string
+		expectMocks        func(t *testing.T, hn *hackernews.Mock)
+		expectedStatusCode int
+		expectedResults    int
+		expectedNextCursor string
+	}
+
+	tests := []testcase{
+		{
+			name:  "one result",
+			hn:    &hackernews.Mock{},
+			query: "q=compiler&limit=1",
+			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
+				hn.On("Search", mock.Anything, "compiler", hackernews.SearchOptions{Limit: 1}).
+					Return([]models.SearchResult{{Item: models.Item{ID: 1}, Snippet: "<mark>compiler</mark>"}}, "next", nil)
+			},
+			expectedStatusCode: 200,
+			expectedResults:    1,
+			expectedNextCursor: "next",
+		},
+		{
+			name:  "with cursor",
+			hn:    &hackernews.Mock{},
+			query: "q=compiler&cursor=next",
+			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
+				hn.On("Search", mock.Anything, "compiler", hackernews.SearchOptions{Cursor: "next"}).Return([]models.SearchResult{}, "", nil)
+			},
+			expectedStatusCode: 200,
+			expectedResults:    0,
+		},
+		{
+			name:  "with type",
+			hn:    &hackernews.Mock{},
+			query: "q=compiler&type=job",
+			expectMocks: func(t *testing.T, hn *hackernews.Mock) {
+				hn.On("Search", mock.Anything, "compiler", hackernews.SearchOptions{Type: "job"}).Return([]models.SearchResult{}, "", nil)
+			},
+			expectedStatusCode: 200,
+			expectedResults:    0,
+		},
+		{
+			name:               "invalid type",
+			hn:                 &hackernews.Mock{},
+			query:              "q=compiler&type=article",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "missing query",
+			hn:                 &hackernews.Mock{},
+			query:              "",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "invalid limit",
+			hn:                 &hackernews.Mock{},
+			query:              "q=compiler&limit=-1",
+			expectedStatusCode: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expectMocks != nil {
+				tt.expectMocks(t, tt.hn)
+			}
+
+			context, res := setUpRequest(http.MethodGet, "/search?"+tt.query)
+
+			h := Handler{
+				HNClient: tt.hn,
+			}
+
+			err := h.Search(context)
+
+			assert.Equal(t, tt.expectedStatusCode, statusCode(err, res))
+			if tt.expectedStatusCode == http.StatusOK {
+				var resBody struct {
+					Results    []models.SearchResult `json:"results"`
+					NextCursor string                `json:"next_cursor"`
+				}
+				err = json.Unmarshal(res.Body.Bytes(), &resBody)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedResults, len(resBody.Results))
+				assert.Equal(t, tt.expectedNextCursor, resBody.NextCursor)
+			}
+			tt.hn.AssertExpectations(t)
+		})
+	}
+}
+
+// statusCode returns the status code echo would respond with for a handler's result
+func statusCode(err error, res *httptest.ResponseRecorder) int {
+	if he, ok := err.(*echo.HTTPError); ok {
+		return he.Code
+	}
+
+	return res.Code
+}
+
 func setUpRequest(method string, endpoint string) (echo.Context, *httptest.ResponseRecorder) {
 	router := echo.New()
 
@@ -0,0 +1,19 @@
+package gateway
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OpenAPISpec is the OpenAPI 3 document describing the /v1 routes. Tests check it matches the routes
+// and their responses, so it must be updated with them
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+// GetOpenAPI handles requests to GET /v1/openapi.json
+func (h *Handler) GetOpenAPI(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, OpenAPISpec)
+}
@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/labstack/echo/v4"
+)
+
+// maxListLimit is the largest page list endpoints return
+const maxListLimit = 1000
+
+var sortParams = map[string]hackernews.Sort{
+	"newest": hackernews.SortNewest,
+	"oldest": hackernews.SortOldest,
+	"top":    hackernews.SortTop,
+}
+
+// parseListParams converts the query parameters of list endpoints into list options, reporting every
+// invalid parameter rather than only the first
+func parseListParams(c echo.Context) (hackernews.ListOptions, error) {
+	var invalid invalidParams
+
+	params := c.QueryParams()
+
+	limit := 0
+	if v := params.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			invalid = append(invalid, InvalidParam{Name: "limit", Reason: fmt.Sprintf("must be an integer between 1 and %d", maxListLimit)})
+		}
+	}
+
+	opts, filterInvalid := parseFilterParams(params)
+	invalid = append(invalid, filterInvalid...)
+
+	opts.Limit = limit
+	opts.Cursor = params.Get("cursor")
+
+	if len(invalid) > 0 {
+		return opts, invalid
+	}
+
+	return opts, nil
+}
+
+// parseFilterParams parses the parameters that filter and order items, shared by every route listing them
+func parseFilterParams(params url.Values) (hackernews.ListOptions, invalidParams) {
+	var (
+		opts    hackernews.ListOptions
+		invalid invalidParams
+	)
+
+	if v := params.Get("sort"); v != "" {
+		sort, ok := sortParams[v]
+		if !ok {
+			invalid = append(invalid, InvalidParam{Name: "sort", Reason: "must be one of newest, oldest or top"})
+		}
+
+		opts.Sort = sort
+	}
+
+	if _, ok := params["author"]; ok {
+		opts.Author = strings.TrimSpace(params.Get("author"))
+		if opts.Author == "" {
+			invalid = append(invalid, InvalidParam{Name: "author", Reason: "must not be empty"})
+		}
+	}
+
+	if v := params.Get("min_score"); v != "" {
+		score, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			invalid = append(invalid, InvalidParam{Name: "min_score", Reason: "must be an integer"})
+		}
+
+		opts.MinScore = int(score)
+	}
+
+	var sinceOK, untilOK bool
+	if v := params.Get("since"); v != "" {
+		opts.Since, sinceOK = parseTimeParam(v)
+		if !sinceOK {
+			invalid = append(invalid, InvalidParam{Name: "since", Reason: "must be an RFC 3339 timestamp or unix time in seconds"})
+		}
+	}
+
+	if v := params.Get("until"); v != "" {
+		opts.Until, untilOK = parseTimeParam(v)
+		if !untilOK {
+			invalid = append(invalid, InvalidParam{Name: "until", Reason: "must be an RFC 3339 timestamp or unix time in seconds"})
+		}
+	}
+
+	if sinceOK && untilOK && !opts.Until.After(opts.Since) {
+		invalid = append(invalid, InvalidParam{Name: "until", Reason: "must be after since"})
+	}
+
+	return opts, invalid
+}
+
+// parseTimeParam accepts RFC 3339 timestamps and unix times in seconds
+func parseTimeParam(v string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil && secs >= 0 {
+		return time.Unix(secs, 0).UTC(), true
+	}
+
+	return time.Time{}, false
+}
+
+// setPageLinks sets RFC 8288 Link headers to the first page, when this isn't it, and the next page,
+// when there is one. The links keep the request's other query parameters
+func setPageLinks(c echo.Context, next string) {
+	var links []string
+	if c.QueryParam("cursor") != "" {
+		links = append(links, pageLink(c, "", "first"))
+	}
+
+	if next != "" {
+		links = append(links, pageLink(c, next, "next"))
+	}
+
+	if len(links) > 0 {
+		c.Response().Header().Add("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageLink links to the current request with its cursor replaced. The target is relative to the
+// request so the links work behind proxies that rewrite the host
+func pageLink(c echo.Context, cursor, rel string) string {
+	u := *c.Request().URL
+
+	params := u.Query()
+	if cursor == "" {
+		params.Del("cursor")
+	} else {
+		params.Set("cursor", cursor)
+	}
+
+	u.RawQuery = params.Encode()
+
+	return fmt.Sprintf("<%s>; rel=%q", u.RequestURI(), rel)
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alexdunne/gs-onboarding/internal/gateway/hackernews"
+	"github.com/alexdunne/gs-onboarding/internal/models"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListParams(t *testing.T) {
+	type testcase struct {
+		name            string
+		query           string
+		expectedOptions hackernews.ListOptions
+		expectedInvalid []string
+	}
+
+	tests := []testcase{
+		{
+			name:            "no parameters",
+			query:           "",
+			expectedOptions: hackernews.ListOptions{},
+		},
+		{
+			name:  "every parameter",
+			query: "limit=20&cursor=abc&sort=top&author=pg&min_score=-5&since=2021-09-01T00:00:00Z&until=1633046400",
+			expectedOptions: hackernews.ListOptions{
+				Limit:    20,
+				Cursor:   "abc",
+				Sort:     hackernews.SortTop,
+				Author:   "pg",
+				MinScore: -5,
+				Since:    time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC),
+				Until:    time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:            "limit out of range",
+			query:           "limit=1001",
+			expectedInvalid: []string{"limit"},
+		},
+		{
+			name:            "every invalid parameter is reported",
+			query:           "limit=abc&sort=random&author=%20&min_score=1.5&since=yesterday&until=-1",
+			expectedInvalid: []string{"limit", "sort", "author", "min_score", "since", "until"},
+		},
+		{
+			name:            "until before since",
+			query:           "since=2021-10-01T00:00:00Z&until=2021-09-01T00:00:00Z",
+			expectedInvalid: []string{"until"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := setUpRequest(http.MethodGet, "/all?"+tc.query)
+
+			opts, err := parseListParams(c)
+
+			if tc.expectedInvalid != nil {
+				var invalid invalidParams
+				require.True(t, errors.As(err, &invalid))
+
+				names := make([]string, len(invalid))
+				for i, p := range invalid {
+					names[i] = p.Name
+				}
+				assert.Equal(t, tc.expectedInvalid, names)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOptions, opts)
+		})
+	}
+}
+
+func TestListPageLinks(t *testing.T) {
+	type testcase struct {
+		name               string
+		target             string
+		next               string
+		expectedLink       string
+		expectedNextCursor string
+	}
+
+	tests := []testcase{
+		{
+			name:               "first page",
+			target:             "/stories?limit=2&sort=top",
+			next:               "abc",
+			expectedLink:       `</stories?cursor=abc&limit=2&sort=top>; rel="next"`,
+			expectedNextCursor: "abc",
+		},
+		{
+			name:               "middle page",
+			target:             "/stories?limit=2&cursor=abc",
+			next:               "def",
+			expectedLink:       `</stories?limit=2>; rel="first", </stories?cursor=def&limit=2>; rel="next"`,
+			expectedNextCursor: "def",
+		},
+		{
+			name:         "last page",
+			target:       "/stories?cursor=def",
+			expectedLink: `</stories>; rel="first"`,
+		},
+		{
+			name:   "only page",
+			target: "/stories",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hn := &hackernews.Mock{}
+			hn.On("FetchStories", mock.Anything, mock.Anything).Return([]models.Item{{ID: 1}}, tc.next, nil)
+
+			c, res := setUpRequest(http.MethodGet, tc.target)
+
+			h := Handler{HNClient: hn}
+			require.NoError(t, h.GetStories(c))
+
+			assert.Equal(t, tc.expectedLink, res.Header().Get("Link"))
+
+			var body struct {
+				NextCursor string `json:"next_cursor"`
+			}
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+			assert.Equal(t, tc.expectedNextCursor, body.NextCursor)
+		})
+	}
+}
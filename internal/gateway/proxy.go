@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/textproto"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// nextPageTokenTrailer is the trailer list streams send the token of the next page in
+const nextPageTokenTrailer = "next-page-token"
+
+// forwardedHeaders are the request headers passed on to the API as metadata. Credentials are not
+// forwarded as the gateway calls the API with its own identity
+var forwardedHeaders = map[string]bool{
+	"X-Request-Id": true,
+}
+
+// NewProxy returns a reverse proxy serving every RPC at the path given by its HTTP rule in api.proto.
+// Responses use the proto field names and errors are problem details, as on the hand-written routes.
+// List streams end with a {"next_page_token": ...} document when there is a following page
+func NewProxy(ctx context.Context, client pb.APIClient, logger *zap.Logger) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{OrigName: true, EmitDefaults: true}),
+		runtime.WithIncomingHeaderMatcher(matchForwardedHeader),
+		runtime.WithProtoErrorHandler(proxyErrorHandler(logger)),
+		runtime.WithStreamErrorHandler(proxyStreamErrorHandler),
+	)
+
+	if err := pb.RegisterAPIHandlerClient(ctx, mux, trailerClient{client}); err != nil {
+		return nil, errors.Wrap(err, "registering api handlers")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var trailer metadata.MD
+		r = r.Clone(context.WithValue(r.Context(), trailerContextKey{}, &trailer))
+		// the runtime forwards Authorization regardless of the header matcher
+		r.Header.Del("Authorization")
+
+		mux.ServeHTTP(w, r)
+
+		// the body has been sent by the time the trailer arrives so the token follows the last item
+		if tokens := trailer.Get(nextPageTokenTrailer); len(tokens) > 0 && tokens[0] != "" {
+			if err := json.NewEncoder(w).Encode(map[string]string{"next_page_token": tokens[0]}); err != nil {
+				logger.Warn("writing next page token", zap.Error(err))
+			}
+		}
+	}), nil
+}
+
+type trailerContextKey struct{}
+
+// trailerClient records the trailer of list streams in the metadata stored in the request context,
+// which the generated handlers don't read
+type trailerClient struct {
+	pb.APIClient
+}
+
+func (c trailerClient) ListAll(ctx context.Context, in *pb.ListItemsRequest, opts ...grpc.CallOption) (pb.API_ListAllClient, error) {
+	return c.APIClient.ListAll(ctx, in, withTrailer(ctx, opts)...)
+}
+
+func (c trailerClient) ListStories(ctx context.Context, in *pb.ListItemsRequest, opts ...grpc.CallOption) (pb.API_ListStoriesClient, error) {
+	return c.APIClient.ListStories(ctx, in, withTrailer(ctx, opts)...)
+}
+
+func (c trailerClient) ListJobs(ctx context.Context, in *pb.ListItemsRequest, opts ...grpc.CallOption) (pb.API_ListJobsClient, error) {
+	return c.APIClient.ListJobs(ctx, in, withTrailer(ctx, opts)...)
+}
+
+func withTrailer(ctx context.Context, opts []grpc.CallOption) []grpc.CallOption {
+	if md, ok := ctx.Value(trailerContextKey{}).(*metadata.MD); ok {
+		opts = append(opts, grpc.Trailer(md))
+	}
+
+	return opts
+}
+
+func matchForwardedHeader(key string) (string, bool) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	return key, forwardedHeaders[key]
+}
+
+// proxyErrorHandler writes errors returned before a response is started as problem details
+func proxyErrorHandler(logger *zap.Logger) runtime.ProtoErrorHandlerFunc {
+	return func(ctx context.Context, mux *runtime.ServeMux, m runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+		// the proxy reports paths without a rule, and methods other than the rule's, as unimplemented
+		p := problemForStatus(status.Convert(err), nil)
+		if errors.Is(err, runtime.ErrUnknownURI) {
+			p = newProblem(http.StatusNotFound, "")
+		}
+
+		// trailers announced for streams are never sent once the response fails
+		w.Header().Del("Trailer")
+
+		writeProblem(w, r, p, err, logger)
+	}
+}
+
+// proxyStreamErrorHandler converts errors ending a stream into its final message, hiding the detail
+// of server side failures as problems do
+func proxyStreamErrorHandler(ctx context.Context, err error) *runtime.StreamError {
+	st := status.Convert(err)
+	p := problemForStatus(st, nil)
+
+	return &runtime.StreamError{
+		GrpcCode:   int32(st.Code()),
+		HttpCode:   int32(p.Status),
+		HttpStatus: p.Title,
+		Message:    p.Detail,
+	}
+}
@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/alexdunne/gs-onboarding/internal/api/protobufs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type stubServer struct {
+	pb.UnimplementedAPIServer
+	listRequests chan *pb.ListItemsRequest
+	metadata     chan metadata.MD
+}
+
+func (s *stubServer) GetItem(ctx context.Context, req *pb.GetItemRequest) (*pb.Item, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.metadata <- md
+
+	switch req.GetId() {
+	case 404:
+		return nil, status.Error(codes.NotFound, "item 404 not found")
+	case 500:
+		return nil, status.Error(codes.Internal, "scanning item: connection reset")
+	}
+
+	return &pb.Item{Id: req.GetId(), Type: "story", CreatedBy: "pg"}, nil
+}
+
+func (s *stubServer) ListStories(req *pb.ListItemsRequest, stream pb.API_ListStoriesServer) error {
+	s.listRequests <- req
+
+	for _, id := range []int32{1, 2} {
+		if err := stream.Send(&pb.Item{Id: id, Type: "story"}); err != nil {
+			return err
+		}
+	}
+
+	if req.GetPageToken() == "" {
+		stream.SetTrailer(metadata.Pairs("next-page-token", "abc"))
+	}
+
+	return nil
+}
+
+// newTestProxy serves the proxy in front of srv over an in-memory connection
+func newTestProxy(t *testing.T, srv pb.APIServer) http.Handler {
+	lis := bufconn.Listen(1 << 20)
+
+	s := grpc.NewServer()
+	pb.RegisterAPIServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	proxy, err := NewProxy(context.Background(), pb.NewAPIClient(conn), zap.NewNop())
+	require.NoError(t, err)
+
+	return proxy
+}
+
+func TestProxy(t *testing.T) {
+	type testcase struct {
+		name                string
+		target              string
+		expectedStatusCode  int
+		expectedContentType string
+		expectedBody        string
+	}
+
+	tests := []testcase{
+		{
+			name:                "proto field names with defaults",
+			target:              "/v2/items/1",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        `{"id":1,"type":"story","content":"","url":"","score":0,"title":"","created_at":"0","created_by":"pg","version":0,"updated_at":"0","parent":0,"kids":[],"parts":[],"descendants":0}`,
+		},
+		{
+			name:                "not found",
+			target:              "/v2/items/404",
+			expectedStatusCode:  http.StatusNotFound,
+			expectedContentType: MIMEApplicationProblemJSON,
+			expectedBody:        `{"type":"about:blank","title":"Not Found","status":404,"detail":"item 404 not found","instance":"/v2/items/404"}`,
+		},
+		{
+			name:                "internal hides the cause",
+			target:              "/v2/items/500",
+			expectedStatusCode:  http.StatusInternalServerError,
+			expectedContentType: MIMEApplicationProblemJSON,
+			expectedBody:        `{"type":"about:blank","title":"Internal Server Error","status":500,"instance":"/v2/items/500"}`,
+		},
+		{
+			name:                "invalid path parameter",
+			target:              "/v2/items/abc",
+			expectedStatusCode:  http.StatusBadRequest,
+			expectedContentType: MIMEApplicationProblemJSON,
+		},
+		{
+			name:                "path without a rule",
+			target:              "/v2/users/1",
+			expectedStatusCode:  http.StatusNotFound,
+			expectedContentType: MIMEApplicationProblemJSON,
+			expectedBody:        `{"type":"about:blank","title":"Not Found","status":404,"instance":"/v2/users/1"}`,
+		},
+	}
+
+	srv := &stubServer{metadata: make(chan metadata.MD, len(tests))}
+	proxy := newTestProxy(t, srv)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.Equal(t, tc.expectedContentType, rec.Header().Get("Content-Type"))
+			if tc.expectedBody != "" {
+				assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxyStream(t *testing.T) {
+	srv := &stubServer{listRequests: make(chan *pb.ListItemsRequest, 2)}
+	proxy := newTestProxy(t, srv)
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/stories?page_size=2&author=pg&sort=TOP&created_after=1633046400", nil)
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	listReq := <-srv.listRequests
+	assert.Equal(t, int32(2), listReq.GetPageSize())
+	assert.Equal(t, "pg", listReq.GetAuthor())
+	assert.Equal(t, pb.SortOrder_TOP, listReq.GetSort())
+	assert.Equal(t, int64(1633046400), listReq.GetCreatedAfter())
+
+	// each message is a separate JSON document wrapped in a result field, followed by the next page token
+	ids, next := decodeProxyStream(t, rec.Body.Bytes())
+	assert.Equal(t, []int32{1, 2}, ids)
+	assert.Equal(t, "abc", next)
+
+	req = httptest.NewRequest(http.MethodGet, "/v2/stories?page_size=2&page_token=abc", nil)
+	rec = httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "abc", (<-srv.listRequests).GetPageToken())
+
+	ids, next = decodeProxyStream(t, rec.Body.Bytes())
+	assert.Equal(t, []int32{1, 2}, ids)
+	assert.Empty(t, next, "the last page has no token")
+}
+
+func decodeProxyStream(t *testing.T, body []byte) ([]int32, string) {
+	var ids []int32
+	var next string
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for dec.More() {
+		var msg struct {
+			Result *struct {
+				ID int32 `json:"id"`
+			} `json:"result"`
+			NextPageToken string `json:"next_page_token"`
+		}
+		require.NoError(t, dec.Decode(&msg))
+
+		if msg.Result != nil {
+			ids = append(ids, msg.Result.ID)
+		}
+		if msg.NextPageToken != "" {
+			next = msg.NextPageToken
+		}
+	}
+
+	return ids, next
+}
+
+func TestProxyForwardedHeaders(t *testing.T) {
+	srv := &stubServer{metadata: make(chan metadata.MD, 1)}
+	proxy := newTestProxy(t, srv)
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/items/1", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	req.Header.Set("Authorization", "Bearer client-token")
+	req.Header.Set("Cookie", "session=1")
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	md := <-srv.metadata
+	assert.Equal(t, []string{"abc"}, md.Get("x-request-id"))
+	assert.Empty(t, md.Get("authorization"))
+	assert.Empty(t, md.Get("cookie"))
+}
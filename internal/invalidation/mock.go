@@ -0,0 +1,16 @@
+package invalidation
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type Mock struct {
+	mock.Mock
+}
+
+func (m *Mock) Publish(ctx context.Context, ids []int) error {
+	args := m.Called(ctx, ids)
+	return args.Error(0)
+}
@@ -0,0 +1,66 @@
+package invalidation
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// Channel is the redis pub/sub channel invalidation messages are sent on
+const Channel = "items:invalidate"
+
+// Message lists items that have changed and should be evicted from caches
+type Message struct {
+	IDs []int `json:"ids"`
+}
+
+// Decode parses the payload of an invalidation message
+func Decode(payload string) (Message, error) {
+	var m Message
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		return Message{}, errors.Wrap(err, "decoding invalidation message")
+	}
+
+	return m, nil
+}
+
+// Publisher is a interface to expose methods to announce changed items
+type Publisher interface {
+	Publish(ctx context.Context, ids []int) error
+}
+
+type publisher struct {
+	client *redis.Client
+}
+
+// New creates a publisher sending messages through the redis instance at addr. The connection is made lazily
+func New(addr string) *publisher {
+	return &publisher{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+	}
+}
+
+// Publish announces that the items with the given ids have changed
+func (p *publisher) Publish(ctx context.Context, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(Message{IDs: ids})
+	if err != nil {
+		return errors.Wrap(err, "encoding invalidation message")
+	}
+
+	if err := p.client.Publish(ctx, Channel, b).Err(); err != nil {
+		return errors.Wrap(err, "publishing invalidation message")
+	}
+
+	return nil
+}
+
+// Close closes the redis connection
+func (p *publisher) Close() error {
+	return p.client.Close()
+}
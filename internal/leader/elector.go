@@ -0,0 +1,125 @@
+package leader
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Locker is a interface to expose methods to take and give up named leases
+type Locker interface {
+	AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name string, holder string) error
+}
+
+// Elector campaigns for a named lease so only one instance at a time acts as the leader
+type Elector struct {
+	locker        Locker
+	name          string
+	holder        string
+	ttl           time.Duration
+	renewInterval time.Duration
+	logger        *zap.Logger
+}
+
+// ElectorOption is an interface for a functional option
+type ElectorOption func(e *Elector)
+
+// WithLeaseTTL is a functional option to configure how long a lease is held without being renewed.
+// This is the longest it takes for another instance to take over when the leader dies
+func WithLeaseTTL(ttl time.Duration) ElectorOption {
+	return func(e *Elector) {
+		e.ttl = ttl
+	}
+}
+
+// NewElector creates a new elector campaigning for the lease name on behalf of holder
+func NewElector(locker Locker, name string, holder string, logger *zap.Logger, opts ...ElectorOption) *Elector {
+	e := &Elector{
+		locker: locker,
+		name:   name,
+		holder: holder,
+		ttl:    15 * time.Second,
+		logger: logger.With(zap.String("lease", name), zap.String("holder", holder)),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	// renew well before expiry so a single slow round trip doesn't cost us the lease
+	e.renewInterval = e.ttl / 3
+
+	return e
+}
+
+// Run campaigns for leadership until ctx is cancelled. While this instance holds the lease, lead is
+// run with a context that is cancelled as soon as leadership is lost. If lead returns on its own the
+// lease is released so another instance can take over
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+
+	var (
+		cancelLead context.CancelFunc
+		done       chan struct{}
+	)
+
+	stepDown := func() {
+		if cancelLead == nil {
+			return
+		}
+
+		cancelLead()
+		<-done
+		cancelLead = nil
+
+		// the parent context may already be cancelled, the release should still reach the database
+		releaseCtx, cancel := context.WithTimeout(context.Background(), e.renewInterval)
+		defer cancel()
+
+		if err := e.locker.ReleaseLease(releaseCtx, e.name, e.holder); err != nil {
+			e.logger.Error("releasing lease", zap.Error(err))
+		}
+	}
+	defer stepDown()
+
+	for ctx.Err() == nil {
+		if cancelLead != nil {
+			select {
+			case <-done:
+				e.logger.Info("leader finished, stepping down")
+				stepDown()
+			default:
+			}
+		}
+
+		acquired, err := e.locker.AcquireLease(ctx, e.name, e.holder, e.ttl)
+		if err != nil {
+			e.logger.Error("acquiring lease", zap.Error(err))
+		}
+
+		switch {
+		case acquired && cancelLead == nil:
+			e.logger.Info("elected leader")
+
+			leadCtx, cancel := context.WithCancel(ctx)
+			cancelLead = cancel
+			done = make(chan struct{})
+
+			go func(done chan struct{}) {
+				defer close(done)
+				lead(leadCtx)
+			}(done)
+		case !acquired && cancelLead != nil:
+			e.logger.Warn("lost leadership")
+			stepDown()
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
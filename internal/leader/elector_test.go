@@ -0,0 +1,111 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type stubLocker struct {
+	mu     sync.Mutex
+	holder string
+}
+
+func (s *stubLocker) AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.holder == "" || s.holder == holder {
+		s.holder = holder
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (s *stubLocker) ReleaseLease(ctx context.Context, name string, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.holder == holder {
+		s.holder = ""
+	}
+
+	return nil
+}
+
+func (s *stubLocker) steal(holder string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.holder = holder
+}
+
+func TestElectorRun(t *testing.T) {
+	logger := zap.NewNop()
+
+	t.Run("only one instance leads", func(t *testing.T) {
+		locker := &stubLocker{}
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var mu sync.Mutex
+		leaders := map[string]int{}
+
+		wg := &sync.WaitGroup{}
+		for _, holder := range []string{"consumer-1", "consumer-2", "consumer-3"} {
+			wg.Add(1)
+			go func(holder string) {
+				defer wg.Done()
+
+				e := NewElector(locker, "seeder", holder, logger, WithLeaseTTL(30*time.Millisecond))
+				e.Run(ctx, func(ctx context.Context) {
+					mu.Lock()
+					leaders[holder]++
+					mu.Unlock()
+
+					<-ctx.Done()
+				})
+			}(holder)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		mu.Lock()
+		assert.Len(t, leaders, 1)
+		mu.Unlock()
+
+		cancel()
+		wg.Wait()
+
+		assert.Equal(t, "", locker.holder, "expected the lease to be released on shutdown")
+	})
+
+	t.Run("steps down when the lease is lost", func(t *testing.T) {
+		locker := &stubLocker{}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		elected := make(chan struct{})
+		stopped := make(chan struct{})
+
+		e := NewElector(locker, "seeder", "consumer-1", logger, WithLeaseTTL(30*time.Millisecond))
+		go e.Run(ctx, func(ctx context.Context) {
+			close(elected)
+			<-ctx.Done()
+			close(stopped)
+		})
+
+		<-elected
+		locker.steal("consumer-2")
+
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("expected the leader to stop after losing the lease")
+		}
+	})
+}
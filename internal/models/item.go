@@ -16,30 +16,129 @@ type Item struct {
 	Title     string    `json:"title"`
 	CreatedAt time.Time `json:"createdAt"`
 	CreatedBy string    `json:"createdBy"`
+	// Version starts at 1 and increases every time the item changes
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Parent is the item a comment replies to or the poll an option belongs to, 0 for top level items
+	Parent int `json:"parent,omitempty"`
+	// Kids are the ids of the replies to the item, in ranked display order
+	Kids []int `json:"kids,omitempty"`
+	// Parts are the ids of the options of a poll
+	Parts []int `json:"parts,omitempty"`
+	// Descendants is the total number of comments on a story or poll
+	Descendants int `json:"descendants,omitempty"`
 }
 
+// ScoreSample is the score of an item from when it was recorded until the next sample
+type ScoreSample struct {
+	Score      int       `json:"score"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// SearchResult is an item matching a search along with a highlighted extract of the matching text
+type SearchResult struct {
+	Item    Item    `json:"item"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// ItemEvent represents a change to an item
+type ItemEvent struct {
+	ID int64 `json:"id"`
+	// TxID is the transaction that recorded the event. Transactions commit out of order, so events
+	// become visible in order of TxID and then ID rather than ID alone
+	TxID      int64     `json:"txId"`
+	Kind      string    `json:"kind"`
+	ItemID    int       `json:"itemId"`
+	Item      *Item     `json:"item,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Position returns where the event is in the stream of events
+func (e ItemEvent) Position() EventPosition {
+	return EventPosition{TxID: e.TxID, ID: e.ID}
+}
+
+// EventPosition is a point in the stream of item events, which is ordered by transaction and then id
+type EventPosition struct {
+	TxID int64
+	ID   int64
+}
+
+// After reports whether p is later in the stream than o
+func (p EventPosition) After(o EventPosition) bool {
+	return p.TxID > o.TxID || (p.TxID == o.TxID && p.ID > o.ID)
+}
+
+const (
+	// ItemCreated is the kind of event recorded when an item is first stored
+	ItemCreated = "created"
+	// ItemUpdated is the kind of event recorded when a stored item changes
+	ItemUpdated = "updated"
+	// ItemDeleted is the kind of event recorded when an item is removed
+	ItemDeleted = "deleted"
+)
+
 func Itop(item Item) *pb.Item {
 	return &pb.Item{
-		Id:        int32(item.ID),
-		Type:      item.Type,
-		Content:   item.Content,
-		Url:       item.URL,
-		Score:     int32(item.Score),
-		Title:     item.Title,
-		CreatedAt: item.CreatedAt.Unix(),
-		CreatedBy: item.CreatedBy,
+		Id:          int32(item.ID),
+		Type:        item.Type,
+		Content:     item.Content,
+		Url:         item.URL,
+		Score:       int32(item.Score),
+		Title:       item.Title,
+		CreatedAt:   item.CreatedAt.Unix(),
+		CreatedBy:   item.CreatedBy,
+		Version:     int32(item.Version),
+		UpdatedAt:   item.UpdatedAt.Unix(),
+		Parent:      int32(item.Parent),
+		Kids:        toInt32s(item.Kids),
+		Parts:       toInt32s(item.Parts),
+		Descendants: int32(item.Descendants),
 	}
 }
 
 func Ptoi(item *pb.Item) Item {
 	return Item{
-		ID:        int(item.Id),
-		Type:      item.Type,
-		Content:   item.Content,
-		URL:       item.Url,
-		Score:     int(item.Score),
-		Title:     item.Title,
-		CreatedAt: time.Unix(item.CreatedAt, 0),
-		CreatedBy: item.CreatedBy,
+		ID:          int(item.Id),
+		Type:        item.Type,
+		Content:     item.Content,
+		URL:         item.Url,
+		Score:       int(item.Score),
+		Title:       item.Title,
+		CreatedAt:   time.Unix(item.CreatedAt, 0),
+		CreatedBy:   item.CreatedBy,
+		Version:     int(item.Version),
+		UpdatedAt:   time.Unix(item.UpdatedAt, 0),
+		Parent:      int(item.Parent),
+		Kids:        toInts(item.Kids),
+		Parts:       toInts(item.Parts),
+		Descendants: int(item.Descendants),
+	}
+}
+
+func toInt32s(ids []int) []int32 {
+	if len(ids) == 0 {
+		return nil
 	}
+
+	res := make([]int32, len(ids))
+	for i, id := range ids {
+		res[i] = int32(id)
+	}
+
+	return res
+}
+
+func toInts(ids []int32) []int {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	res := make([]int, len(ids))
+	for i, id := range ids {
+		res[i] = int(id)
+	}
+
+	return res
 }
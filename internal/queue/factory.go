@@ -3,6 +3,9 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net"
+	"os"
 
 	"github.com/pkg/errors"
 	"github.com/streadway/amqp"
@@ -12,6 +15,38 @@ import (
 // Message represents the structure of the messages being sent
 type Message struct {
 	ID int `json:"id"`
+
+	delivery *amqp.Delivery
+}
+
+// Ack acknowledges the delivery of the message. Messages that were not received from a queue are a no-op
+func (m *Message) Ack() error {
+	if m.delivery == nil {
+		return nil
+	}
+
+	return m.delivery.Ack(false)
+}
+
+// Nack negatively acknowledges the delivery of the message, optionally returning it to the queue
+func (m *Message) Nack(requeue bool) error {
+	if m.delivery == nil {
+		return nil
+	}
+
+	return m.delivery.Nack(false, requeue)
+}
+
+// IsTransient reports whether err is a failure talking to the queue that may succeed when retried,
+// such as a closed channel or a lost connection
+func IsTransient(err error) bool {
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) {
+		return amqpErr == amqp.ErrClosed || amqpErr.Recover
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
 }
 
 // Queue is a interface to expose methods to interact with a queue
@@ -21,14 +56,26 @@ type Queue interface {
 }
 
 type client struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
-	queue   amqp.Queue
-	logger  *zap.Logger
+	conn        *amqp.Connection
+	channel     *amqp.Channel
+	queue       amqp.Queue
+	consumerTag string
+	prefetch    int
+	logger      *zap.Logger
+}
+
+// ClientOption is an interface for a functional option
+type ClientOption func(c *client)
+
+// WithPrefetch is a functional option to limit the number of unacknowledged deliveries held by the consumer
+func WithPrefetch(prefetch int) ClientOption {
+	return func(c *client) {
+		c.prefetch = prefetch
+	}
 }
 
 // New creates a connection to a RMQ instance and configures the necessary queues
-func New(connStr string, queueName string, logger *zap.Logger) (*client, error) {
+func New(connStr string, queueName string, logger *zap.Logger, opts ...ClientOption) (*client, error) {
 	conn, err := amqp.Dial(connStr)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to connect to rabbitmq")
@@ -52,10 +99,21 @@ func New(connStr string, queueName string, logger *zap.Logger) (*client, error)
 	}
 
 	c := &client{
-		conn:    conn,
-		channel: amqpChan,
-		queue:   q,
-		logger:  logger,
+		conn:        conn,
+		channel:     amqpChan,
+		queue:       q,
+		consumerTag: fmt.Sprintf("%s-%d", queueName, os.Getpid()),
+		logger:      logger,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.prefetch > 0 {
+		if err := amqpChan.Qos(c.prefetch, 0, false); err != nil {
+			return nil, errors.Wrap(err, "failed to set prefetch")
+		}
 	}
 
 	return c, nil
@@ -92,16 +150,18 @@ func (c *client) Publish(msg *Message) error {
 		})
 }
 
-// Consumer continuously receives messages from a queue and sends them to a returned channel
+// Consume continuously receives messages from a queue and sends them to a returned channel.
+// Messages must be acknowledged by the receiver. Once ctx is cancelled the consumer stops
+// receiving new deliveries, requeues anything that was not handed out and closes the channel.
 func (c *client) Consume(ctx context.Context) (<-chan *Message, error) {
 	msgs, err := c.channel.Consume(
 		c.queue.Name,
-		"",    // consumer
-		true,  // auto-ack
-		false, // exclusive
-		false, // no-local
-		false, // no-wait
-		nil,   // args
+		c.consumerTag, // consumer
+		false,         // auto-ack
+		false,         // exclusive
+		false,         // no-local
+		false,         // no-wait
+		nil,           // args
 	)
 	if err != nil {
 		return nil, err
@@ -117,23 +177,44 @@ func (c *client) Consume(ctx context.Context) (<-chan *Message, error) {
 		for {
 			select {
 			case <-ctx.Done():
+				c.drain(msgs)
 				return
 			case in, ok := <-msgs:
 				if !ok {
 					return
 				}
 
-				var msg *Message
-				if err := json.Unmarshal(in.Body, &msg); err != nil {
+				msg := &Message{delivery: &in}
+				if err := json.Unmarshal(in.Body, msg); err != nil {
 					c.logger.Info("failed to convert incoming message Message struct")
-					in.Nack(false, true)
+					in.Nack(false, false)
 					continue
 				}
 
-				messages <- msg
+				select {
+				case <-ctx.Done():
+					in.Nack(false, true)
+					c.drain(msgs)
+					return
+				case messages <- msg:
+				}
 			}
 		}
 	}()
 
 	return messages, nil
 }
+
+// drain cancels the consumer and requeues any deliveries that were already sent to it
+func (c *client) drain(msgs <-chan amqp.Delivery) {
+	c.logger.Info("stopping consumer")
+
+	if err := c.channel.Cancel(c.consumerTag, false); err != nil {
+		c.logger.Error("failed to cancel consumer", zap.Error(err))
+		return
+	}
+
+	for in := range msgs {
+		in.Nack(false, true)
+	}
+}
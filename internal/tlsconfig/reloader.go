@@ -0,0 +1,233 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
+)
+
+// reloadDelay batches the several events written while a certificate is replaced into one reload
+const reloadDelay = 100 * time.Millisecond
+
+// Files are the paths of a certificate, its key and the CA used to verify the other side. Any may be
+// empty, a client without a certificate or a server that doesn't verify clients for example
+type Files struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// Reloader holds the certificate and CA pool loaded from Files and reloads them when the files change
+type Reloader struct {
+	files  Files
+	logger *zap.Logger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+// NewReloader loads the files, failing if any of them is invalid
+func NewReloader(files Files, logger *zap.Logger) (*Reloader, error) {
+	r := &Reloader{files: files, logger: logger}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// reload reads the files and swaps them in. The previous certificate is kept if any file is invalid
+func (r *Reloader) reload() error {
+	var cert *tls.Certificate
+	if r.files.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+		if err != nil {
+			return errors.Wrap(err, "loading certificate")
+		}
+
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.files.CAFile != "" {
+		pem, err := os.ReadFile(r.files.CAFile)
+		if err != nil {
+			return errors.Wrap(err, "reading ca")
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("ca contains no certificates")
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = cert
+	r.pool = pool
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the files whenever they change until ctx is cancelled. The directories are watched
+// rather than the files so replacements by rename, as done for mounted secrets, are seen
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "creating watcher")
+	}
+	defer watcher.Close()
+
+	dirs := map[string]bool{}
+	for _, f := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if f != "" {
+			dirs[filepath.Dir(f)] = true
+		}
+	}
+
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return errors.Wrapf(err, "watching %s", dir)
+		}
+	}
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+				timer.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			r.logger.Warn("watching certificates", zap.Error(err))
+		case <-timer.C:
+			if err := r.reload(); err != nil {
+				r.logger.Error("reloading certificates, keeping the previous ones", zap.Error(err))
+				continue
+			}
+
+			r.logger.Info("reloaded certificates")
+		}
+	}
+}
+
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, r.pool
+}
+
+// ServerConfig returns a config serving the current certificate. When a CA is configured client
+// certificates are verified against it, and required when requireClientCert is set
+func (r *Reloader) ServerConfig(requireClientCert bool) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			if cert == nil {
+				return nil, errors.New("no server certificate loaded")
+			}
+
+			c := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				// the returned config replaces the outer one so the protocols grpc negotiates are repeated
+				NextProtos: []string{"h2"},
+			}
+
+			if pool != nil {
+				c.ClientCAs = pool
+				c.ClientAuth = tls.VerifyClientCertIfGiven
+				if requireClientCert {
+					c.ClientAuth = tls.RequireAndVerifyClientCert
+				}
+			}
+
+			return c, nil
+		},
+	}
+}
+
+// ClientConfig returns a config presenting the current certificate, if any, and verifying the server
+// against the current CA, or the system roots when no CA is configured. The CA is fixed when the config
+// is built, use ClientCredentials to pick up a reloaded CA on every connection
+func (r *Reloader) ClientConfig() *tls.Config {
+	_, pool := r.current()
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			if cert == nil {
+				return &tls.Certificate{}, nil
+			}
+
+			return cert, nil
+		},
+	}
+}
+
+// ClientCredentials returns gRPC transport credentials that build a ClientConfig for every handshake,
+// so reloaded files are used by new connections while crypto/tls still verifies the server name
+func (r *Reloader) ClientCredentials() credentials.TransportCredentials {
+	return &reloadingCredentials{reloader: r}
+}
+
+type reloadingCredentials struct {
+	reloader   *Reloader
+	serverName string
+}
+
+func (c *reloadingCredentials) creds() credentials.TransportCredentials {
+	cfg := c.reloader.ClientConfig()
+	cfg.ServerName = c.serverName
+
+	return credentials.NewTLS(cfg)
+}
+
+func (c *reloadingCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.creds().ClientHandshake(ctx, authority, conn)
+}
+
+func (c *reloadingCredentials) ServerHandshake(net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("client credentials can't serve connections")
+}
+
+func (c *reloadingCredentials) Info() credentials.ProtocolInfo {
+	return c.creds().Info()
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingCredentials{reloader: c.reloader, serverName: c.serverName}
+}
+
+func (c *reloadingCredentials) OverrideServerName(name string) error {
+	c.serverName = name
+	return nil
+}
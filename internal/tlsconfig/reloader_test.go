@@ -0,0 +1,365 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newAuthority(t *testing.T) *authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &authority{cert: cert, key: key}
+}
+
+func (a *authority) writeCA(t *testing.T, path string) {
+	writePEM(t, path, "CERTIFICATE", a.cert.Raw)
+}
+
+// issue writes a certificate for name signed by the authority, and its key, to certFile and keyFile
+func (a *authority) issue(t *testing.T, name string, serial int64, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &key.PublicKey, a.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	// the key is written first so a watcher never pairs the new certificate with the old key
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	writePEM(t, certFile, "CERTIFICATE", der)
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600))
+}
+
+// handshake connects client to server over loopback and returns the connection state each side saw, or
+// the server's error before the client's as with TLS 1.3 the client finishes before being rejected
+func handshake(t *testing.T, server, client *tls.Config) (*tls.ConnectionState, *tls.ConnectionState, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	type result struct {
+		state tls.ConnectionState
+		err   error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer conn.Close()
+
+		srv := tls.Server(conn, server)
+		err = srv.Handshake()
+		results <- result{state: srv.ConnectionState(), err: err}
+	}()
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cli := tls.Client(conn, client)
+	clientErr := cli.Handshake()
+	if clientErr != nil {
+		// unblocks a server still waiting on the client
+		conn.Close()
+	}
+
+	res := <-results
+	if res.err != nil {
+		return nil, nil, res.err
+	}
+	if clientErr != nil {
+		return nil, nil, clientErr
+	}
+
+	clientState := cli.ConnectionState()
+
+	return &res.state, &clientState, nil
+}
+
+type fixture struct {
+	ca         *authority
+	serverCert Files
+	clientCert Files
+}
+
+func newFixture(t *testing.T) *fixture {
+	serverDir, clientDir := t.TempDir(), t.TempDir()
+	ca := newAuthority(t)
+
+	f := &fixture{
+		ca: ca,
+		serverCert: Files{
+			CertFile: filepath.Join(serverDir, "tls.crt"),
+			KeyFile:  filepath.Join(serverDir, "tls.key"),
+			CAFile:   filepath.Join(serverDir, "ca.crt"),
+		},
+		clientCert: Files{
+			CertFile: filepath.Join(clientDir, "tls.crt"),
+			KeyFile:  filepath.Join(clientDir, "tls.key"),
+			CAFile:   filepath.Join(clientDir, "ca.crt"),
+		},
+	}
+
+	ca.writeCA(t, f.serverCert.CAFile)
+	ca.writeCA(t, f.clientCert.CAFile)
+	ca.issue(t, "api", 10, f.serverCert.CertFile, f.serverCert.KeyFile)
+	ca.issue(t, "gateway", 20, f.clientCert.CertFile, f.clientCert.KeyFile)
+
+	return f
+}
+
+func TestReloaderHandshake(t *testing.T) {
+	type testcase struct {
+		name              string
+		requireClientCert bool
+		withoutClientCert bool
+		untrustedServer   bool
+		serverName        string
+		expectedErr       bool
+		expectedClient    string
+	}
+
+	tests := []testcase{
+		{
+			name:           "mutual tls",
+			serverName:     "api",
+			expectedClient: "gateway",
+		},
+		{
+			name:              "client certificate is optional by default",
+			withoutClientCert: true,
+			serverName:        "api",
+		},
+		{
+			name:              "client certificate is required",
+			requireClientCert: true,
+			withoutClientCert: true,
+			serverName:        "api",
+			expectedErr:       true,
+		},
+		{
+			name:        "server name does not match",
+			serverName:  "billing",
+			expectedErr: true,
+		},
+		{
+			name:        "server name is an ip address",
+			serverName:  "127.0.0.1",
+			expectedErr: true,
+		},
+		{
+			name:        "no server name",
+			expectedErr: true,
+		},
+		{
+			name:            "server signed by another ca",
+			untrustedServer: true,
+			serverName:      "api",
+			expectedErr:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+
+			if tc.untrustedServer {
+				newAuthority(t).issue(t, "api", 11, f.serverCert.CertFile, f.serverCert.KeyFile)
+			}
+
+			clientFiles := f.clientCert
+			if tc.withoutClientCert {
+				clientFiles = Files{CAFile: f.clientCert.CAFile}
+			}
+
+			server, err := NewReloader(f.serverCert, zap.NewNop())
+			require.NoError(t, err)
+
+			client, err := NewReloader(clientFiles, zap.NewNop())
+			require.NoError(t, err)
+
+			clientConfig := client.ClientConfig()
+			clientConfig.ServerName = tc.serverName
+
+			serverState, _, err := handshake(t, server.ServerConfig(tc.requireClientCert), clientConfig)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			var clientName string
+			if len(serverState.VerifiedChains) > 0 {
+				clientName = serverState.VerifiedChains[0][0].Subject.CommonName
+			}
+			assert.Equal(t, tc.expectedClient, clientName)
+		})
+	}
+}
+
+func TestReloaderWatch(t *testing.T) {
+	f := newFixture(t)
+
+	server, err := NewReloader(f.serverCert, zap.NewNop())
+	require.NoError(t, err)
+
+	client, err := NewReloader(f.clientCert, zap.NewNop())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go server.Watch(ctx)
+
+	serverSerial := func() int64 {
+		clientConfig := client.ClientConfig()
+		clientConfig.ServerName = "api"
+
+		_, clientState, err := handshake(t, server.ServerConfig(true), clientConfig)
+		if err != nil {
+			return 0
+		}
+
+		return clientState.PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	require.Equal(t, int64(10), serverSerial())
+
+	// give the watcher time to start before rotating the certificate
+	time.Sleep(50 * time.Millisecond)
+	f.ca.issue(t, "api", 12, f.serverCert.CertFile, f.serverCert.KeyFile)
+
+	assert.Eventually(t, func() bool { return serverSerial() == 12 }, 5*time.Second, 50*time.Millisecond)
+
+	// an invalid certificate is ignored and the last good one kept
+	require.NoError(t, os.WriteFile(f.serverCert.CertFile, []byte("not a certificate"), 0o600))
+	time.Sleep(3 * reloadDelay)
+
+	assert.Equal(t, int64(12), serverSerial())
+}
+
+func TestReloaderClientCredentials(t *testing.T) {
+	type testcase struct {
+		name        string
+		authority   string
+		serverName  string
+		expectedErr bool
+	}
+
+	tests := []testcase{
+		{
+			name:      "authority matches the certificate",
+			authority: "api:8001",
+		},
+		{
+			name:        "authority is an ip address",
+			authority:   "127.0.0.1:8001",
+			expectedErr: true,
+		},
+		{
+			name:       "overridden server name",
+			authority:  "127.0.0.1:8001",
+			serverName: "api",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+
+			server, err := NewReloader(f.serverCert, zap.NewNop())
+			require.NoError(t, err)
+
+			client, err := NewReloader(f.clientCert, zap.NewNop())
+			require.NoError(t, err)
+
+			creds := client.ClientCredentials()
+			if tc.serverName != "" {
+				require.NoError(t, creds.OverrideServerName(tc.serverName))
+			}
+
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer lis.Close()
+
+			go func() {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				tls.Server(conn, server.ServerConfig(false)).Handshake()
+			}()
+
+			conn, err := net.Dial("tcp", lis.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			_, _, err = creds.ClientHandshake(context.Background(), tc.authority, conn)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
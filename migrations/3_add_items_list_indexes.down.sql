@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS items_created_at_id_idx;
+DROP INDEX IF EXISTS items_score_id_idx;
+DROP INDEX IF EXISTS items_type_created_at_id_idx;
+DROP INDEX IF EXISTS items_created_by_idx;
@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS items_created_at_id_idx ON items (created_at, id);
+CREATE INDEX IF NOT EXISTS items_score_id_idx ON items (score, id);
+CREATE INDEX IF NOT EXISTS items_type_created_at_id_idx ON items (type, created_at, id);
+CREATE INDEX IF NOT EXISTS items_created_by_idx ON items (created_by);
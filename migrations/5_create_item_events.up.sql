@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS item_events (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(10) NOT NULL,
+    item_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS item_events_created_at_idx ON item_events (created_at);
+
+-- record every change to an item and wake up any listeners. the notification only carries
+-- the event id as payloads are size limited, listeners read the events table to catch up
+CREATE OR REPLACE FUNCTION record_item_event() RETURNS trigger AS $$
+DECLARE
+    event_id BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO item_events (kind, item_id) VALUES ('deleted', OLD.id) RETURNING id INTO event_id;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO item_events (kind, item_id) VALUES ('updated', NEW.id) RETURNING id INTO event_id;
+    ELSE
+        INSERT INTO item_events (kind, item_id) VALUES ('created', NEW.id) RETURNING id INTO event_id;
+    END IF;
+
+    PERFORM pg_notify('item_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS items_record_event ON items;
+CREATE TRIGGER items_record_event
+    AFTER INSERT OR UPDATE OR DELETE ON items
+    FOR EACH ROW EXECUTE FUNCTION record_item_event();
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS items_bump_version ON items;
+DROP FUNCTION IF EXISTS bump_item_version;
+ALTER TABLE items DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE items DROP COLUMN IF EXISTS version;
@@ -0,0 +1,17 @@
+-- existing items start at version 1, last modified when the migration ran
+ALTER TABLE items ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE items ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT now();
+
+-- every update produces a new version so the gateway can tell clients whether their copy is current
+CREATE OR REPLACE FUNCTION bump_item_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    NEW.updated_at := now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS items_bump_version ON items;
+CREATE TRIGGER items_bump_version
+    BEFORE UPDATE ON items
+    FOR EACH ROW EXECUTE FUNCTION bump_item_version();
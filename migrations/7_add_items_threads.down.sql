@@ -0,0 +1,4 @@
+ALTER TABLE items DROP COLUMN IF EXISTS descendants;
+ALTER TABLE items DROP COLUMN IF EXISTS parts;
+ALTER TABLE items DROP COLUMN IF EXISTS kids;
+ALTER TABLE items DROP COLUMN IF EXISTS parent;
@@ -0,0 +1,7 @@
+-- comments reply to a story or another comment and poll options belong to a poll, both through
+-- parent, which is 0 for top level items. kids are the replies in ranked display order and parts the
+-- options of a poll, both NULL when the item has none
+ALTER TABLE items ADD COLUMN IF NOT EXISTS parent INT NOT NULL DEFAULT 0;
+ALTER TABLE items ADD COLUMN IF NOT EXISTS kids INT[];
+ALTER TABLE items ADD COLUMN IF NOT EXISTS parts INT[];
+ALTER TABLE items ADD COLUMN IF NOT EXISTS descendants INT NOT NULL DEFAULT 0;
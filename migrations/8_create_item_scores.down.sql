@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS items_record_score ON items;
+DROP FUNCTION IF EXISTS record_item_score;
+DROP TABLE IF EXISTS item_scores;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS item_scores (
+    id BIGSERIAL PRIMARY KEY,
+    item_id INT NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+    score INT NOT NULL,
+    recorded_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS item_scores_item_id_idx ON item_scores (item_id, recorded_at);
+
+-- sample the score whenever an item is stored or its score changes, so the history of an item is
+-- every score it was stored with
+CREATE OR REPLACE FUNCTION record_item_score() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.score IS DISTINCT FROM OLD.score THEN
+        INSERT INTO item_scores (item_id, score) VALUES (NEW.id, coalesce(NEW.score, 0));
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS items_record_score ON items;
+CREATE TRIGGER items_record_score
+    AFTER INSERT OR UPDATE OF score ON items
+    FOR EACH ROW EXECUTE FUNCTION record_item_score();
+
+-- items stored before now start their history with their current score
+INSERT INTO item_scores (item_id, score, recorded_at)
+SELECT id, coalesce(score, 0), updated_at FROM items
+WHERE NOT EXISTS (SELECT 1 FROM item_scores s WHERE s.item_id = items.id);
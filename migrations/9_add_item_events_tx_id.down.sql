@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS item_events_tx_id_idx;
+ALTER TABLE item_events DROP COLUMN IF EXISTS tx_id;
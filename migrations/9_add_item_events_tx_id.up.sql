@@ -0,0 +1,5 @@
+-- transactions commit out of event id order, so watchers follow events by the transaction that
+-- recorded them and only read events of transactions older than any still in progress
+ALTER TABLE item_events ADD COLUMN IF NOT EXISTS tx_id BIGINT NOT NULL DEFAULT txid_current();
+
+CREATE INDEX IF NOT EXISTS item_events_tx_id_idx ON item_events (tx_id, id);
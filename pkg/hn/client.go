@@ -1,6 +1,7 @@
 package hn
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,12 +9,13 @@ import (
 
 // Client is a interface to expose methods to interact with the hacker news api
 type Client interface {
-	FetchTopStories() ([]int, error)
-	FetchItem(id int) (*Item, error)
+	FetchTopStories(ctx context.Context) ([]int, error)
+	FetchItem(ctx context.Context, id int) (*Item, error)
 }
 
 type client struct {
-	baseUrl string
+	baseUrl    string
+	httpClient *http.Client
 }
 
 // ClientOption is an interface for a functional option
@@ -29,7 +31,8 @@ func WithBaseUrl(baseUrl string) ClientOption {
 // New creates a client
 func New(opts ...ClientOption) *client {
 	c := &client{
-		baseUrl: "https://hacker-news.firebaseio.com/v0",
+		baseUrl:    "https://hacker-news.firebaseio.com/v0",
+		httpClient: http.DefaultClient,
 	}
 
 	for _, opt := range opts {
@@ -40,15 +43,9 @@ func New(opts ...ClientOption) *client {
 }
 
 // FetchTopStories fetches the ids of the current top hacker news stories
-func (c *client) FetchTopStories() ([]int, error) {
-	resp, err := http.Get(c.baseUrl + "/topstories.json")
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
+func (c *client) FetchTopStories(ctx context.Context) ([]int, error) {
 	var res []int
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+	if err := c.get(ctx, c.baseUrl+"/topstories.json", &res); err != nil {
 		return nil, err
 	}
 
@@ -56,17 +53,27 @@ func (c *client) FetchTopStories() ([]int, error) {
 }
 
 // FetchItem fetches item information for a given id from the hacker news api
-func (c *client) FetchItem(id int) (*Item, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/item/%d.json", c.baseUrl, id))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
+func (c *client) FetchItem(ctx context.Context, id int) (*Item, error) {
 	var res Item
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+	if err := c.get(ctx, fmt.Sprintf("%s/item/%d.json", c.baseUrl, id), &res); err != nil {
 		return nil, err
 	}
 
 	return &res, nil
 }
+
+// get performs a GET request bound to ctx and decodes the JSON body into v
+func (c *client) get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -14,4 +14,14 @@ type Item struct {
 	CreatedBy string    `json:"createdBy"`
 	Dead      bool      `json:"dead"`
 	Deleted   bool      `json:"deleted"`
+	// Parent is the item a comment replies to
+	Parent int `json:"parent"`
+	// Poll is the poll a poll option belongs to
+	Poll int `json:"poll"`
+	// Kids are the ids of the replies to the item, in ranked display order
+	Kids []int `json:"kids"`
+	// Parts are the ids of the options of a poll
+	Parts []int `json:"parts"`
+	// Descendants is the total number of comments on a story or poll
+	Descendants int `json:"descendants"`
 }
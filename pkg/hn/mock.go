@@ -1,13 +1,17 @@
 package hn
 
-import "github.com/stretchr/testify/mock"
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
 
 type Mock struct {
 	mock.Mock
 }
 
-func (m *Mock) FetchTopStories() ([]int, error) {
-	args := m.Called()
+func (m *Mock) FetchTopStories(ctx context.Context) ([]int, error) {
+	args := m.Called(ctx)
 
 	idsArg, ok := args.Get(0).([]int)
 	if !ok {
@@ -17,8 +21,8 @@ func (m *Mock) FetchTopStories() ([]int, error) {
 	return idsArg, args.Error(1)
 }
 
-func (m *Mock) FetchItem(id int) (*Item, error) {
-	args := m.Called(id)
+func (m *Mock) FetchItem(ctx context.Context, id int) (*Item, error) {
+	args := m.Called(ctx, id)
 
 	itemArg, ok := args.Get(0).(*Item)
 	if !ok {